@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the Runalyze login session",
+	Long: `Log in and out of Runalyze and check the stored session, e.g. from cron before a nightly
+download, so an expiring session is noticed before the run fails.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to Runalyze and store the session",
+	Long:  `Log in with the configured username and password, even if the stored session is still valid.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, sw.AuthLogin)
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Log out of Runalyze and wipe the stored session",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, sw.AuthLogout)
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the stored session cookies and whether the session is valid",
+	Long: `Show the stored session cookies with their expiry, the REMEMBERME cookie included, and check
+with Runalyze whether the session is still valid. Nothing is logged in.
+
+Exits with an error if the session is invalid or the REMEMBERME cookie expires within --warn-days.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, sw.AuthStatus)
+	},
+}
+
+var authWhoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the account the stored session belongs to",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, sw.AuthWhoAmI)
+	},
+}
+
+// runAuth runs an auth command with the configuration from the flags
+func runAuth(cmd *cobra.Command, run func(ctx context.Context, config sw.AuthConfig) error) error {
+	jsonMode, _ := cmd.Flags().GetBool("json")
+	warnDays, _ := cmd.Flags().GetInt("warn-days")
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return run(ctx, sw.AuthConfig{
+		ClientConfig: getClientConfig(cmd),
+		WarnBefore:   time.Duration(warnDays) * 24 * time.Hour,
+		JSONMode:     jsonMode,
+	})
+}
+
+func init() {
+	authStatusCmd.Flags().Int("warn-days", sw.DefaultSessionWarnDays, "Fail if the REMEMBERME cookie expires within this many days (0 disables)")
+
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd, authWhoamiCmd)
+	rootCmd.AddCommand(authCmd)
+}
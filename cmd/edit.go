@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit [activity-id]",
+	Short: "Edit activity metadata on Runalyze",
+	Long: `Change the title, notes, sport, training type, equipment or privacy of an activity,
+or of every activity in a CSV file.
+
+The CSV needs an id column and a column per field to change (title, notes, sport, type,
+equipment, privacy); empty cells are left as they are. Sports, types and equipment are
+given by name, equipment as a comma separated list. Use --dry-run to see what would change.`,
+	Example: `  syncwich edit 135061341 --title "Morning run" --type "Long run"
+  syncwich edit 135061341 --equipment "Pegasus 40" --privacy private
+  syncwich edit --csv edits.csv --dry-run`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		csvPath, _ := cmd.Flags().GetString("csv")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		config := sw.EditConfig{
+			ClientConfig: getClientConfig(cmd),
+			CSVPath:      csvPath,
+			DryRun:       dryRun,
+			JSONMode:     jsonMode,
+			Changes:      make(map[sw.EditField]string),
+		}
+		for _, field := range sw.EditFields {
+			if cmd.Flags().Changed(string(field)) {
+				config.Changes[field], _ = cmd.Flags().GetString(string(field))
+			}
+		}
+		switch {
+		case csvPath != "" && (len(args) > 0 || len(config.Changes) > 0):
+			return fmt.Errorf("--csv can't be combined with an activity ID or field flags")
+		case csvPath == "" && len(args) == 0:
+			return fmt.Errorf("an activity ID or --csv is required")
+		case len(args) > 0:
+			config.ActivityID = args[0]
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return sw.Edit(ctx, config)
+	},
+}
+
+func init() {
+	editCmd.Flags().String("title", "", "New title")
+	editCmd.Flags().String("notes", "", "New notes")
+	editCmd.Flags().String("sport", "", "New sport, by name (e.g. 'Running')")
+	editCmd.Flags().String("type", "", "New training type, by name (e.g. 'Long run'); empty to remove")
+	editCmd.Flags().String("equipment", "", "Comma separated equipment names; empty to remove all")
+	editCmd.Flags().String("privacy", "", "public or private")
+	editCmd.Flags().String("csv", "", "Apply the edits in this CSV file")
+	editCmd.Flags().Bool("dry-run", false, "Show what would change without saving")
+
+	rootCmd.AddCommand(editCmd)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var equipmentCmd = &cobra.Command{
+	Use:   "equipment",
+	Short: "List gear with its mileage from the local archive",
+	Long: `List the shoes, bikes and other gear in equipment.json with the distance Runalyze counts and
+the distance of the activities in the local archive, and warn about shoes that are worn out.
+Run 'syncwich equipment sync' to update equipment.json.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		return sw.ListEquipment(sw.EquipmentConfig{
+			SaveDir:    viper.GetString("save_dir"),
+			ShoeWarnKm: getShoeWarnKm(cmd),
+			JSONMode:   jsonMode,
+		})
+	},
+}
+
+var equipmentSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Update equipment.json from Runalyze",
+	Long: `Fetch the equipment overview and the gear used for each activity in the date range into
+equipment.json in the save directory. Activities already in equipment.json are not fetched again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return sw.SyncEquipment(ctx, sw.EquipmentConfig{
+			ClientConfig:  getClientConfig(cmd),
+			UntilStr:      until,
+			SinceStr:      since,
+			SaveDir:       viper.GetString("save_dir"),
+			ShoeWarnKm:    getShoeWarnKm(cmd),
+			PrefetchWeeks: viper.GetInt("prefetch_weeks"),
+			JSONMode:      jsonMode,
+		})
+	},
+}
+
+// getShoeWarnKm returns --warn-km if given, otherwise equipment.shoe_warn_km
+func getShoeWarnKm(cmd *cobra.Command) float64 {
+	if cmd.Flags().Changed("warn-km") {
+		warnKm, _ := cmd.Flags().GetFloat64("warn-km")
+		return warnKm
+	}
+	return viper.GetFloat64("equipment.shoe_warn_km")
+}
+
+func init() {
+	equipmentCmd.PersistentFlags().Float64("warn-km", sw.DefaultShoeWarnKm, "Warn about shoes in use past this distance")
+	equipmentSyncCmd.Flags().String("since", "4w", "Read the gear of activities since this date (e.g., '2023-12-01', '30d', '4w')")
+	equipmentSyncCmd.Flags().String("until", "", "Read the gear of activities until this date (optional)")
+
+	equipmentCmd.AddCommand(equipmentSyncCmd)
+	rootCmd.AddCommand(equipmentCmd)
+}
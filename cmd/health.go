@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Back up daily health notes from Runalyze",
+	Long:  `Back up the daily body data Runalyze keeps in its health notes: resting heart rate, weight, sleep, HRV and notes.`,
+}
+
+var healthDownloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download health notes into a local timeline",
+	Long: `Download the health note of every day in the date range into health.jsonl (or health.csv)
+in the save directory. Days already in the timeline are skipped, and today is left for a later run.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		format, _ := cmd.Flags().GetString("format")
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return sw.DownloadHealth(ctx, sw.HealthConfig{
+			ClientConfig: getClientConfig(cmd),
+			UntilStr:     until,
+			SinceStr:     since,
+			SaveDir:      viper.GetString("save_dir"),
+			Format:       format,
+			JSONMode:     jsonMode,
+		})
+	},
+}
+
+func init() {
+	healthDownloadCmd.Flags().String("since", "4w", "Download health notes since this date (e.g., '2023-12-01', '30d', '4w')")
+	healthDownloadCmd.Flags().String("until", "", "Download health notes until this date (optional)")
+	healthDownloadCmd.Flags().String("format", "jsonl", "Timeline format: jsonl or csv")
+
+	healthCmd.AddCommand(healthDownloadCmd)
+	rootCmd.AddCommand(healthCmd)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var reorganizeCmd = &cobra.Command{
+	Use:   "reorganize",
+	Short: "Move the archive from one layout to another",
+	Long: `Move the exports in the save directory from one layout to another. Files are found by the
+--from layout and moved to where the --to layout puts them, which defaults to the layout in the
+config. The date, sport and other fields of the new layout come from the activity catalog;
+activities that were downloaded before the catalog existed only have their date, so their sport
+is "unknown". Files of activities missing from the catalog keep the date and sport their --from
+path shows, with sport "unknown" otherwise, and are left in place if the new layout needs a date
+their path doesn't have. Use --dry-run to see what would move.
+
+Layouts are templates with the fields {id}, {ext}, {date}, {year}, {month}, {day} and {sport},
+and must contain {id} and {ext}.`,
+	Example: `  syncwich reorganize --to '{year}/{month}/{date}_{sport}_{id}.{ext}' --dry-run
+  syncwich reorganize --from '{year}/{month}/{date}_{sport}_{id}.{ext}' --to '{id}.{ext}'`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		return sw.Reorganize(sw.ReorganizeConfig{
+			SaveDir:     viper.GetString("save_dir"),
+			CatalogPath: viper.GetString("catalog_path"),
+			From:        from,
+			To:          getConfigValue(to, "layout"),
+			DryRun:      dryRun,
+			JSONMode:    jsonMode,
+		})
+	},
+}
+
+func init() {
+	reorganizeCmd.Flags().String("from", sw.DefaultLayout, "Layout the archive is in now")
+	reorganizeCmd.Flags().String("to", "", "Layout to move the archive to (default: layout from the config)")
+	reorganizeCmd.Flags().Bool("dry-run", false, "Show what would move without moving anything")
+
+	rootCmd.AddCommand(reorganizeCmd)
+}
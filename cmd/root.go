@@ -1,19 +1,25 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/roessland/syncwich/pkg/errs"
+	"github.com/roessland/syncwich/runalyze"
 	"github.com/roessland/syncwich/sw"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	cookiePath string
-	cfgFile    string
+	cookiePath  string
+	cookieStore string
+	cfgFile     string
 )
 
 var rootCmd = &cobra.Command{
@@ -32,31 +38,118 @@ var downloadCmd = &cobra.Command{
 		since, _ := cmd.Flags().GetString("since")
 		until, _ := cmd.Flags().GetString("until")
 		jsonMode, _ := cmd.Flags().GetBool("json")
+		formats, _ := cmd.Flags().GetString("formats")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		onRemoteDelete, _ := cmd.Flags().GetString("on-remote-delete")
+
+		// Ctrl-C / SIGTERM cancel the context so the in-flight request is
+		// aborted and the partial summary is still printed.
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
 
 		// Gather configuration from flags and viper
 		config := sw.DownloadConfig{
-			Username:   getConfigValue("", "username"),
-			Password:   getConfigValue("", "password"),
-			CookiePath: getConfigValue(cookiePath, "cookie_path"),
-			UntilStr:   until,
-			SinceStr:   since,
-			SaveDir:    viper.GetString("save_dir"),
-			JSONMode:   jsonMode,
+			ClientConfig:     getClientConfig(cmd),
+			UntilStr:         until,
+			SinceStr:         since,
+			SaveDir:          viper.GetString("save_dir"),
+			Formats:          getConfigValue(formats, "formats"),
+			Layout:           viper.GetString("layout"),
+			CatalogPath:      getCatalogPath(cmd),
+			SinceLastOverlap: viper.GetDuration("since_last_overlap"),
+			OnRemoteDelete:   getConfigValue(onRemoteDelete, "on_remote_delete"),
+			Concurrency:      getConcurrency(cmd),
+			PrefetchWeeks:    viper.GetInt("prefetch_weeks"),
+			JSONMode:         jsonMode,
 		}
 
 		// Call the business logic
-		return sw.Download(config)
+		return sw.Download(ctx, config)
 	},
 }
 
-// getConfigValue returns the flag value if non-empty, otherwise returns the viper config value
+// getClientConfig gathers the Runalyze connection settings shared by all
+// commands from the persistent flags and viper
+func getClientConfig(cmd *cobra.Command) sw.ClientConfig {
+	unsafeTrace, _ := cmd.Flags().GetBool("unsafe-trace")
+	recordDir, _ := cmd.Flags().GetString("record")
+	replayDir, _ := cmd.Flags().GetString("replay")
+
+	return sw.ClientConfig{
+		BaseURL:           viper.GetString("base_url"),
+		Username:          getConfigValue("", "username"),
+		Password:          getConfigValue("", "password"),
+		CookiePath:        getConfigValue(cookiePath, "cookie_path"),
+		CookieStore:       getConfigValue(cookieStore, "cookie_store"),
+		PassphraseCommand: viper.GetString("cookie_passphrase_command"),
+		RateLimit:         getRateLimit(),
+		UnsafeTrace:       unsafeTrace,
+		RecordDir:         recordDir,
+		ReplayDir:         replayDir,
+	}
+}
+
+// getConfigValue returns the flag value if non-empty, otherwise returns the viper config value.
+// Config values given as YAML lists are joined with commas.
 func getConfigValue(flagValue, viperKey string) string {
 	if flagValue != "" {
 		return flagValue
 	}
+	if list, ok := viper.Get(viperKey).([]any); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
 	return viper.GetString(viperKey)
 }
 
+// getCatalogPath returns --catalog_path if given, otherwise catalog_path
+// from the config. A replay only gets a catalog file if --catalog_path is
+// given, so replayed activities stay out of the real catalog.
+func getCatalogPath(cmd *cobra.Command) string {
+	if cmd.Flags().Changed("catalog_path") {
+		catalogPath, _ := cmd.Flags().GetString("catalog_path")
+		return catalogPath
+	}
+	if replayDir, _ := cmd.Flags().GetString("replay"); replayDir != "" {
+		return ""
+	}
+	return viper.GetString("catalog_path")
+}
+
+// getConcurrency returns --concurrency if given, otherwise concurrency from
+// the config
+func getConcurrency(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("concurrency") {
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		return concurrency
+	}
+	return viper.GetInt("concurrency")
+}
+
+// getRateLimit reads the rate_limit section of the config, falling back to
+// runalyze.DefaultRateLimit for unset keys
+func getRateLimit() runalyze.RateLimit {
+	limit := runalyze.DefaultRateLimit
+	if viper.IsSet("rate_limit.requests_per_second") {
+		limit.RequestsPerSecond = viper.GetFloat64("rate_limit.requests_per_second")
+	}
+	if viper.IsSet("rate_limit.burst") {
+		limit.Burst = viper.GetInt("rate_limit.burst")
+	}
+	if viper.IsSet("rate_limit.cooldown") {
+		limit.Cooldown = viper.GetDuration("rate_limit.cooldown")
+	}
+	return limit
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
@@ -71,22 +164,40 @@ func init() {
 	// Viper defaults
 	viper.SetDefault("save_dir", "~/.syncwich/activities")
 	viper.SetDefault("cookie_path", "~/.syncwich/runalyze-cookie.json")
+	viper.SetDefault("catalog_path", sw.DefaultCatalogPath)
+	viper.SetDefault("layout", sw.DefaultLayout)
+	viper.SetDefault("since_last_overlap", sw.DefaultSinceLastOverlap)
+	viper.SetDefault("concurrency", 1)
+	viper.SetDefault("prefetch_weeks", sw.DefaultPrefetchWeeks)
 
 	// Here you will define your flags and configuration settings.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.syncwich/syncwich.yaml)")
 	rootCmd.PersistentFlags().String("save_dir", "", "Directory to save downloaded files (default: ~/.syncwich/activities)")
+	rootCmd.PersistentFlags().StringVar(&cookiePath, "cookie-path", "", "Path to cookie file (default: ~/.syncwich/runalyze-cookie.json)")
+	rootCmd.PersistentFlags().StringVar(&cookieStore, "cookie-store", "", "Where to keep the login session: file, encrypted or memory (default: file)")
+	rootCmd.PersistentFlags().Bool("json", false, "Output structured JSON logs instead of interactive mode")
+	rootCmd.PersistentFlags().Bool("unsafe-trace", false, "Include passwords, CSRF tokens and cookie values in LOG_LEVEL=trace logs (never share these logs)")
+	rootCmd.PersistentFlags().String("record", "", "Record all HTTP traffic to this cassette directory, with secrets masked")
+	rootCmd.PersistentFlags().String("replay", "", "Replay a cassette directory recorded with --record instead of contacting Runalyze")
 
 	// Download command flags
-	downloadCmd.Flags().String("since", "4w", "Download activities since this date (e.g., '2023-12-01', '30d', '4w')")
+	downloadCmd.Flags().String("since", "4w", "Download activities since this date (e.g., '2023-12-01', '30d', '4w'), or 'last' to continue from the previous complete run")
 	downloadCmd.Flags().String("until", "", "Download activities until this date (optional)")
-	downloadCmd.Flags().StringVar(&cookiePath, "cookie-path", "", "Path to cookie file (default: ~/.syncwich/runalyze-cookie.json)")
-	downloadCmd.Flags().Bool("json", false, "Output structured JSON logs instead of interactive mode")
+	downloadCmd.Flags().String("formats", "", "Export formats to download, comma-separated; use '|' for fallbacks (default: fit-original|tcx)")
+	downloadCmd.Flags().Duration("timeout", 0, "Abort the download after this long, e.g. '30m' (default: no limit)")
+	downloadCmd.Flags().Int("concurrency", 1, "Number of activities to download at once; all of them share the rate limit")
+	downloadCmd.Flags().String("catalog_path", "", "Activity catalog file (default: ~/.syncwich/catalog.jsonl); with --replay the catalog is kept in memory unless this is given")
+	downloadCmd.Flags().String("on-remote-delete", "", "What to do with local files of activities deleted in Runalyze: keep, trash or report (default: keep)")
+
+	// Bind flags
+	errs.Check(viper.BindPFlag("save_dir", rootCmd.PersistentFlags().Lookup("save_dir")))
 
 	// Bind environment variables
 	errs.Check(viper.BindEnv("username", "SW_RUNALYZE_USERNAME"))
 	errs.Check(viper.BindEnv("password", "SW_RUNALYZE_PASSWORD"))
 	errs.Check(viper.BindEnv("cookie_path", "SW_RUNALYZE_COOKIE_PATH"))
 	errs.Check(viper.BindEnv("save_dir", "SW_RUNALYZE_SAVE_DIR"))
+	errs.Check(viper.BindEnv("cookie_store", "SW_RUNALYZE_COOKIE_STORE"))
 
 	// Add download command to root
 	rootCmd.AddCommand(downloadCmd)
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestSaveDirFlag(t *testing.T) {
+	flag := rootCmd.PersistentFlags().Lookup("save_dir")
+	t.Cleanup(func() {
+		flag.Value.Set("")
+		flag.Changed = false
+	})
+
+	if err := rootCmd.PersistentFlags().Set("save_dir", "/tmp/activities"); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.GetString("save_dir"); got != "/tmp/activities" {
+		t.Errorf("save_dir = %q, want the --save_dir value", got)
+	}
+}
+
+func TestGetCatalogPath(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"config", nil, sw.DefaultCatalogPath},
+		{"flag", []string{"--catalog_path", "/tmp/catalog.jsonl"}, "/tmp/catalog.jsonl"},
+		{"replay keeps it in memory", []string{"--replay", "/tmp/cassette"}, ""},
+		{"replay with flag", []string{"--replay", "/tmp/cassette", "--catalog_path", "/tmp/catalog.jsonl"}, "/tmp/catalog.jsonl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("replay", "", "")
+			cmd.Flags().String("catalog_path", "", "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if got := getCatalogPath(cmd); got != tt.want {
+				t.Errorf("getCatalogPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
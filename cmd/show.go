@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show <activity-id>",
+	Short: "Show the details of an activity",
+	Long: `Show the details Runalyze keeps about an activity: title, notes, sport, training type,
+equipment, elevation, VO2max, laps and the export formats on offer.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return sw.Show(ctx, sw.ShowConfig{
+			ClientConfig: getClientConfig(cmd),
+			ActivityID:   args[0],
+			JSONMode:     jsonMode,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+}
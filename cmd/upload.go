@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/roessland/syncwich/sw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var uploadCmd = &cobra.Command{
+	Use:   "upload <files|dir>...",
+	Short: "Upload FIT/TCX/GPX files to Runalyze",
+	Long: `Upload activity files to Runalyze and report whether each was imported, was a duplicate
+or was rejected. Directories are searched for .fit, .tcx and .gpx files, skipping trash/, versions/ and hidden
+directories. Files named after an
+activity ID, like those syncwich downloads in the configured layout, are skipped while that
+activity still exists.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jsonMode, _ := cmd.Flags().GetBool("json")
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return sw.Upload(ctx, sw.UploadConfig{
+			ClientConfig: getClientConfig(cmd),
+			Paths:        args,
+			Layout:       viper.GetString("layout"),
+			JSONMode:     jsonMode,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uploadCmd)
+}
@@ -30,6 +30,8 @@ type UserOutput interface {
 	Status(format string, args ...any)
 	// Result shows final results/summaries
 	Result(format string, args ...any)
+	// Warning shows user-facing warnings
+	Warning(format string, args ...any)
 	// Error shows user-facing errors
 	Error(format string, args ...any)
 	// JSON outputs structured data (only in JSON mode)
@@ -53,6 +55,7 @@ type Logger interface {
 // OutputLogger handles both user output and structured logging
 type OutputLogger struct {
 	Logger
+	slog     *slog.Logger
 	jsonMode bool
 }
 
@@ -75,13 +78,15 @@ const (
 	StateDownloaded
 	StateError
 	StateNotAvailable // New state for files that don't exist on server
+	StateUpdated      // downloaded again after the activity changed upstream
 )
 
 // FileInfo represents information about a downloaded file
 type FileInfo struct {
 	Type     string // "FIT" or "TCX"
 	State    DownloadState
-	Progress int // 0-100
+	Progress int   // 0-100, or -1 if the size is unknown
+	Bytes    int64 // bytes received so far while downloading
 }
 
 // MultiFileInfo represents information about multiple file attempts for one activity
@@ -131,10 +136,22 @@ func New(jsonMode bool) (*OutputLogger, error) {
 
 	return &OutputLogger{
 		Logger:   logger,
+		slog:     slogLogger,
 		jsonMode: jsonMode,
 	}, nil
 }
 
+// JSONMode reports whether output is structured JSON rather than the TUI
+func (ol *OutputLogger) JSONMode() bool {
+	return ol.jsonMode
+}
+
+// Slog returns the underlying structured logger, for libraries that log
+// through *slog.Logger directly (e.g. the Runalyze client)
+func (ol *OutputLogger) Slog() *slog.Logger {
+	return ol.slog
+}
+
 // getLogLevel returns the log level from LOG_LEVEL env var, defaulting to debug
 func getLogLevel() slog.Level {
 	level := os.Getenv("LOG_LEVEL")
@@ -243,6 +260,8 @@ func (ol *OutputLogger) formatFileDisplay(fileInfo FileInfo) string {
 		return pterm.NewStyle(pterm.BgRed, pterm.FgWhite).Sprint(fileInfo.Type)
 	case StateNotAvailable:
 		return pterm.NewStyle(pterm.FgGray).Sprintf("%s (not available)", fileInfo.Type)
+	case StateUpdated:
+		return pterm.NewStyle(pterm.BgCyan, pterm.FgBlack).Sprint(fileInfo.Type)
 	default:
 		return fileInfo.Type
 	}
@@ -254,6 +273,9 @@ func (ol *OutputLogger) formatStatusDisplay(fileInfo FileInfo) string {
 	case StateExists:
 		return pterm.NewStyle(pterm.FgGreen).Sprint("✅ Already downloaded")
 	case StateDownloading:
+		if fileInfo.Progress < 0 {
+			return fmt.Sprintf("Downloading... %s", formatBytes(fileInfo.Bytes))
+		}
 		return fmt.Sprintf("Downloading... %d%%", fileInfo.Progress)
 	case StateDownloaded:
 		return pterm.NewStyle(pterm.FgGreen).Sprint("✅ Downloaded")
@@ -261,11 +283,27 @@ func (ol *OutputLogger) formatStatusDisplay(fileInfo FileInfo) string {
 		return pterm.NewStyle(pterm.FgRed).Sprint("❌ Error")
 	case StateNotAvailable:
 		return pterm.NewStyle(pterm.FgRed).Sprint("❌ Not available")
+	case StateUpdated:
+		return pterm.NewStyle(pterm.FgCyan).Sprint("🔄 Updated, earlier version kept")
 	default:
 		return ""
 	}
 }
 
+// formatBytes renders a byte count as e.g. "512 B" or "1.4 MB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // UpdateActivityLine updates an existing activity line
 func (ol *OutputLogger) UpdateActivityLine(area *pterm.AreaPrinter, emoji, activityID string, fileInfo FileInfo) {
 	ol.UpdateActivityLineMulti(area, emoji, activityID, MultiFileInfo{Primary: fileInfo})
@@ -292,7 +330,8 @@ func (ol *OutputLogger) UpdateActivityLineMulti(area *pterm.AreaPrinter, emoji,
 	area.Update(line)
 
 	// If download is complete or error, stop the area printer and add newline
-	if multiFileInfo.Primary.State == StateDownloaded || multiFileInfo.Primary.State == StateError || multiFileInfo.Primary.State == StateNotAvailable {
+	switch multiFileInfo.Primary.State {
+	case StateExists, StateDownloaded, StateUpdated, StateError, StateNotAvailable:
 		_ = area.Stop()
 		pterm.Println() // Add newline after stopping area printer
 	}
@@ -325,6 +364,15 @@ func (ol *OutputLogger) Result(format string, args ...any) {
 	}
 }
 
+// Warning shows user-facing warnings
+func (ol *OutputLogger) Warning(format string, args ...any) {
+	if ol.jsonMode {
+		ol.Logger.Warn("user_warning", "message", fmt.Sprintf(format, args...))
+	} else {
+		pterm.Warning.Printf(format+"\n", args...)
+	}
+}
+
 // Error shows user-facing errors
 func (ol *OutputLogger) Error(format string, args ...any) {
 	if ol.jsonMode {
@@ -345,6 +393,15 @@ func (ol *OutputLogger) JSON(data any) error {
 	return encoder.Encode(data)
 }
 
+// Table renders rows as a table, the first row being the header (only in
+// interactive mode)
+func (ol *OutputLogger) Table(rows [][]string) {
+	if ol.jsonMode {
+		return
+	}
+	_ = pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
+
 // LogAndShowError logs an error with full context and shows a user-friendly message
 func (ol *OutputLogger) LogAndShowError(err error, userMsg string, args ...any) {
 	// Log the full error with context
@@ -0,0 +1,263 @@
+package runalyze
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// CassetteMode selects whether a cassette records or replays HTTP traffic.
+type CassetteMode int
+
+const (
+	// CassetteRecord sends requests to the server and writes every
+	// request/response pair to the cassette directory.
+	CassetteRecord CassetteMode = iota + 1
+	// CassetteReplay answers requests from the cassette directory without
+	// touching the network.
+	CassetteReplay
+)
+
+// cassetteRedactor sanitizes what goes into a cassette. It ignores
+// WithUnsafeTrace: cassettes are meant to be attached to bug reports.
+var cassetteRedactor = redactor{}
+
+// cassetteFormFieldRe matches form fields that are masked in recorded
+// request bodies on top of the fields the trace redactor masks
+var cassetteFormFieldRe = regexp.MustCompile(`(^|&)(_?username)=[^&]*`)
+
+// cassetteInteraction is one request/response pair, stored as a JSON file
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"` // path and query; the host is not matched
+	Header http.Header `json:"header"`
+	cassetteBody
+}
+
+type cassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	cassetteBody
+}
+
+// cassetteBody keeps text bodies readable and binary ones (FIT files) intact
+type cassetteBody struct {
+	Body       string `json:"body,omitempty"`
+	BodyBase64 []byte `json:"body_base64,omitempty"`
+}
+
+func newCassetteBody(b []byte) cassetteBody {
+	if utf8.Valid(b) {
+		return cassetteBody{Body: string(b)}
+	}
+	return cassetteBody{BodyBase64: b}
+}
+
+func (b cassetteBody) bytes() []byte {
+	if b.BodyBase64 != nil {
+		return b.BodyBase64
+	}
+	return []byte(b.Body)
+}
+
+// recordingTransport passes requests to next and writes each exchange to dir
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+
+	mu sync.Mutex
+	n  int
+}
+
+// newRecordingTransport records into dir, which must be empty or not exist
+// so that runs don't get mixed up
+func newRecordingTransport(dir string, next http.RoundTripper) (*recordingTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("cassette directory %s is not empty", dir)
+	}
+	return &recordingTransport{next: next, dir: dir}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := cassetteInteraction{
+		Request: cassetteRequest{
+			Method:       req.Method,
+			URL:          req.URL.RequestURI(),
+			Header:       cassetteRedactor.header(req.Header),
+			cassetteBody: newCassetteBody(sanitizeCassetteBody(req.Header.Get("Content-Type"), reqBody)),
+		},
+		Response: cassetteResponse{
+			StatusCode:   resp.StatusCode,
+			Header:       cassetteRedactor.header(resp.Header),
+			cassetteBody: newCassetteBody(sanitizeCassetteBody(resp.Header.Get("Content-Type"), respBody)),
+		},
+	}
+	if err := t.write(interaction); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sanitizeCassetteBody masks secrets in text and multipart bodies; binary
+// bodies are kept
+func sanitizeCassetteBody(contentType string, body []byte) []byte {
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		// Uploads mix form fields with binary files
+		return redactMultipart(body)
+	}
+	if len(body) == 0 || !utf8.Valid(body) {
+		return body
+	}
+	sanitized := cassetteRedactor.body(contentType, body)
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		sanitized = cassetteFormFieldRe.ReplaceAllString(sanitized, "${1}${2}=%5BREDACTED%5D")
+	}
+	return []byte(sanitized)
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// write stores interaction as NNNN-METHOD-path.json
+func (t *recordingTransport) write(interaction cassetteInteraction) error {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette interaction: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n++
+
+	path, _, _ := strings.Cut(interaction.Request.URL, "?")
+	slug := strings.Trim(unsafeNameChars.ReplaceAllString(path, "-"), "-")
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+	name := fmt.Sprintf("%04d-%s-%s.json", t.n, interaction.Request.Method, slug)
+	return writeFileAtomic(filepath.Join(t.dir, name), data, 0600)
+}
+
+// replayTransport answers requests from a recorded cassette
+type replayTransport struct {
+	mu           sync.Mutex
+	interactions map[string][]cassetteInteraction // by "METHOD /path?query"
+	served       map[string]int
+}
+
+// newReplayTransport loads every interaction in dir, in recording order
+func newReplayTransport(dir string) (*replayTransport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("cassette directory %s has no recordings", dir)
+	}
+	sort.Strings(paths)
+
+	t := &replayTransport{
+		interactions: make(map[string][]cassetteInteraction),
+		served:       make(map[string]int),
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var interaction cassetteInteraction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		key := interaction.Request.Method + " " + interaction.Request.URL
+		t.interactions[key] = append(t.interactions[key], interaction)
+	}
+	return t, nil
+}
+
+// RoundTrip serves recorded responses for a request in the order they were
+// recorded, repeating the last one once they run out
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	key := req.Method + " " + req.URL.RequestURI()
+
+	t.mu.Lock()
+	recorded := t.interactions[key]
+	i := t.served[key]
+	if i < len(recorded)-1 {
+		t.served[key]++
+	}
+	t.mu.Unlock()
+
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("cassette has no recorded response for %s", key)
+	}
+
+	rec := recorded[i].Response
+	body := rec.bytes()
+	header := rec.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package runalyze
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCassette_RecordThenReplay records a login, a databrowser week and a
+// FIT export against a server, then replays the same calls with the server
+// gone.
+func TestCassette_RecordThenReplay(t *testing.T) {
+	fit := []byte{0x0e, 0x10, 0xd9, 0x07, 0xff, 0x00, '.', 'F', 'I', 'T'}
+	week := time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login" && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "session-secret", Path: "/"})
+			_, _ = w.Write([]byte(`<input type="hidden" name="_csrf_token" value="csrf-secret">`))
+		case r.URL.Path == "/login":
+			http.SetCookie(w, &http.Cookie{Name: "REMEMBERME", Value: "remember-secret", Path: "/"})
+			w.Header().Set("Location", "/dashboard")
+			w.WriteHeader(http.StatusFound)
+		case r.URL.Path == "/databrowser":
+			_, _ = w.Write([]byte("<table>week</table>"))
+		case strings.HasSuffix(r.URL.Path, "/export/file/fit-original"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="42.fit"`)
+			_, _ = w.Write(fit)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	dir := filepath.Join(t.TempDir(), "cassette")
+	run := func(mode CassetteMode) {
+		t.Helper()
+		client, err := NewClient(
+			WithBaseURL(srv.URL),
+			WithCredentials("runner", "hunter2-password"),
+			WithCassette(dir, mode),
+			WithRateLimit(RateLimit{}),
+		)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		if err := client.Login(); err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		page, err := client.GetDataBrowser(week)
+		if err != nil || string(page) != "<table>week</table>" {
+			t.Fatalf("GetDataBrowser = %q, %v", page, err)
+		}
+		got, _, err := client.GetFit("42")
+		if err != nil || !bytes.Equal(got, fit) {
+			t.Fatalf("GetFit = %v, %v; want %v", got, err, fit)
+		}
+		if _, _, err := client.GetTcx("42"); !IsNotFound(err) {
+			t.Fatalf("GetTcx: err = %v, want 404", err)
+		}
+	}
+
+	run(CassetteRecord)
+	srv.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 5 {
+		t.Fatalf("recorded %d interactions, want 5", len(files))
+	}
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		for _, secret := range []string{"hunter2-password", "runner", "csrf-secret", "session-secret", "remember-secret"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s leaks %q", filepath.Base(f), secret)
+			}
+		}
+	}
+
+	run(CassetteReplay)
+}
+
+func TestCassette_ReplayMiss(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0001-GET-login.json"), []byte(`{"request":{"method":"GET","url":"/login"},"response":{"status_code":200}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(WithCassette(dir, CassetteReplay), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetActivityPage("1"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Fatalf("err = %v, want a cassette miss", err)
+	}
+}
+
+func TestCassette_RecordRefusesNonEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient(WithCassette(dir, CassetteRecord)); err == nil {
+		t.Fatal("expected error recording into a non-empty directory")
+	}
+}
@@ -2,10 +2,11 @@ package runalyze
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,26 +16,45 @@ import (
 	"time"
 
 	"github.com/mitchellh/go-homedir"
-	"github.com/spf13/viper"
 )
 
 const (
 	// FitFormat and TcxFormat are the export-URL format segments Runalyze
 	// serves from /activity/{id}/export/file/{format}. Kept exported so
 	// tests can cross-check them against a real activity page's link set.
-	FitFormat = "fit-original"
-	TcxFormat = "tcx"
+	FitFormat    = "fit-original"
+	TcxFormat    = "tcx"
+	GpxFormat    = "gpx"
+	KmlFormat    = "kml"
+	CsvFormat    = "csv"
+	FitlogFormat = "fitlog"
 )
 
-// baseURL is a var (not const) so tests can point the client at httptest.
-var baseURL = "https://runalyze.com"
+// ExportFormats lists every format segment the activity page's export menu
+// advertises, in menu order.
+var ExportFormats = []string{FitFormat, TcxFormat, GpxFormat, CsvFormat, KmlFormat, FitlogFormat}
+
+const (
+	// DefaultBaseURL is where NewClient points unless WithBaseURL is given.
+	DefaultBaseURL = "https://runalyze.com"
+
+	// DefaultCookiePath is where New persists the session if no path is given.
+	DefaultCookiePath = "~/.syncwich/runalyze-cookie.json"
+
+	// DefaultUserAgent matches the Chrome build the other browser headers mimic.
+	DefaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/147.0.0.0 Safari/537.36"
+)
+
+// LevelTrace is the slog level for full request/response dumps, one step
+// below debug. It matches the "trace" LOG_LEVEL of the CLI.
+const LevelTrace = slog.LevelDebug - 4
 
 var (
 	// commonHeaders are sent on every request regardless of mode. Per-call
 	// helpers layer on document- vs XHR-specific headers (sec-fetch-*,
-	// accept, etc.) — keep those out of here.
+	// accept, etc.) — keep those out of here. The user-agent is per client,
+	// see WithUserAgent.
 	commonHeaders = map[string]string{
-		"user-agent":         "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/147.0.0.0 Safari/537.36",
 		"accept-language":    "en-GB,en;q=0.9,nb-NO;q=0.8,nb;q=0.7,sv-SE;q=0.6,sv;q=0.5,en-US;q=0.4",
 		"sec-ch-ua":          `"Google Chrome";v="147", "Not.A/Brand";v="8", "Chromium";v="147"`,
 		"sec-ch-ua-mobile":   "?0",
@@ -46,11 +66,17 @@ var (
 	ErrRedirectedToLogin = errors.New("redirected to login page")
 )
 
-// setDocumentHeaders mirrors what Chrome sends on a top-level navigation.
-func setDocumentHeaders(req *http.Request) {
+// setCommonHeaders sets the headers shared by document and XHR requests.
+func (c *Client) setCommonHeaders(req *http.Request) {
 	for k, v := range commonHeaders {
 		req.Header.Set(k, v)
 	}
+	req.Header.Set("user-agent", c.userAgent)
+}
+
+// setDocumentHeaders mirrors what Chrome sends on a top-level navigation.
+func (c *Client) setDocumentHeaders(req *http.Request) {
+	c.setCommonHeaders(req)
 	req.Header.Set("accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
 	req.Header.Set("sec-fetch-dest", "document")
 	req.Header.Set("sec-fetch-mode", "navigate")
@@ -63,182 +89,363 @@ func setDocumentHeaders(req *http.Request) {
 // WAF returns 502 if document-only headers (sec-fetch-user,
 // upgrade-insecure-requests) leak into an XHR, so this helper does NOT set
 // them — callers must not add them either.
-func setXHRHeaders(req *http.Request) {
-	for k, v := range commonHeaders {
-		req.Header.Set(k, v)
-	}
+func (c *Client) setXHRHeaders(req *http.Request) {
+	c.setCommonHeaders(req)
 	req.Header.Set("accept", "text/html, */*; q=0.01")
 	req.Header.Set("sec-fetch-dest", "empty")
 	req.Header.Set("sec-fetch-mode", "cors")
 	req.Header.Set("sec-fetch-site", "same-origin")
 	req.Header.Set("x-requested-with", "XMLHttpRequest")
 	req.Header.Set("priority", "u=1, i")
-	req.Header.Set("referer", baseURL+"/dashboard")
+	req.Header.Set("referer", c.baseURL+"/dashboard")
 }
 
-// Client represents a Runalyze API client
+// Client represents a Runalyze API client. Create one with NewClient.
 type Client struct {
 	httpClient *http.Client
+	baseURL    string
+	userAgent  string
 	username   string
 	password   string
-	cookiePath string
-	logger     *log.Logger
-	logLevel   string
+	store      CookieStore
+	logger     *slog.Logger
+	redact     redactor
+	retry      RetryPolicy
+	limiter    *rateLimiter
+
+	// Only consulted while NewClient applies options
+	transport    http.RoundTripper
+	rateLimit    RateLimit
+	cassetteDir  string
+	cassetteMode CassetteMode
 }
 
-// New creates a new Runalyze client
+// New creates a Runalyze client the way the syncwich CLI uses it: the
+// session is persisted to a JSON file at cookiePath (DefaultCookiePath if
+// empty) and logs go to stderr at the level named by LOG_LEVEL. It is a thin
+// wrapper around NewClient.
 func New(username, password, cookiePath string) (*Client, error) {
+	store, err := NewFileCookieStoreAt(cookiePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(
+		WithCredentials(username, password),
+		WithCookieStore(store),
+		WithSlogLogger(NewStderrLogger(os.Getenv("LOG_LEVEL"))),
+	)
+}
+
+// NewFileCookieStoreAt returns a FileCookieStore for cookiePath after
+// expanding "~" and creating its directory. An empty path means
+// DefaultCookiePath.
+func NewFileCookieStoreAt(cookiePath string) (*FileCookieStore, error) {
+	expandedPath, err := prepareCookiePath(cookiePath)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileCookieStore(expandedPath), nil
+}
+
+// NewEncryptedFileCookieStoreAt is NewFileCookieStoreAt for an
+// EncryptedFileCookieStore.
+func NewEncryptedFileCookieStoreAt(cookiePath string, passphrase PassphraseFunc) (*EncryptedFileCookieStore, error) {
+	expandedPath, err := prepareCookiePath(cookiePath)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedFileCookieStore(expandedPath, passphrase), nil
+}
+
+// prepareCookiePath expands "~" in cookiePath (default DefaultCookiePath)
+// and creates its directory
+func prepareCookiePath(cookiePath string) (string, error) {
 	if cookiePath == "" {
-		cookiePath = viper.GetString("cookie_path")
+		cookiePath = DefaultCookiePath
 	}
 
 	// Expand home directory if present
 	expandedPath, err := homedir.Expand(cookiePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to expand cookie path: %w", err)
+		return "", fmt.Errorf("failed to expand cookie path: %w", err)
 	}
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(expandedPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create cookie directory: %w", err)
+		return "", fmt.Errorf("failed to create cookie directory: %w", err)
 	}
 
-	// Create logger first so we can pass it to the cookie jar
-	logger := log.New(os.Stderr, "[runalyze] ", log.LstdFlags)
-	logLevel := viper.GetString("log_level")
+	return expandedPath, nil
+}
 
-	// Create shouldLog function for the cookie jar
-	shouldLogFn := func(level string) bool {
-		levels := map[string]int{
-			"trace": 0,
-			"debug": 1,
-			"info":  2,
-			"warn":  3,
-			"error": 4,
-		}
+// NewStderrLogger returns a text logger on stderr filtering at the named
+// level ("trace", "debug", "info", "warn" or "error"; default "info").
+func NewStderrLogger(level string) *slog.Logger {
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: ParseLevel(level)})
+	return slog.New(handler).With("component", "runalyze")
+}
 
-		configuredLevel := logLevel
-		if configuredLevel == "" {
-			configuredLevel = "info" // Default to info if not set
-		}
+// ParseLevel maps a LOG_LEVEL name to a slog level, defaulting to info.
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "trace":
+		return LevelTrace
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// NewClient creates a Runalyze client configured by opts. Without options it
+// talks to DefaultBaseURL, keeps cookies in memory only, logs nothing,
+// retries with DefaultRetryPolicy and rate-limits with DefaultRateLimit.
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		baseURL:   DefaultBaseURL,
+		userAgent: DefaultUserAgent,
+		logger:    slog.New(slog.DiscardHandler),
+		retry:     DefaultRetryPolicy,
+		rateLimit: DefaultRateLimit,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
 
-		return levels[level] >= levels[configuredLevel]
+	c.baseURL = strings.TrimRight(c.baseURL, "/")
+	base, err := url.Parse(c.baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", c.baseURL)
 	}
 
-	// Create persistent cookie jar with logger
-	jar, err := newPersistentCookieJar(expandedPath, logger, shouldLogFn)
+	jar, err := newPersistentCookieJar(c.store, base, c.logger, c.redact)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
 	}
 
-	// Clone the stdlib default transport so we inherit proxy-from-env,
-	// connection pooling, and dial defaults — only override what we need.
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	insecure := insecureTLSEnabled()
-	transport.TLSClientConfig = buildTLSConfig(insecure)
-	if insecure {
-		logger.Printf("WARNING: SW_INSECURE_TLS is set — TLS certificate verification is DISABLED")
+	// Start from the caller's http.Client (if any) so its timeout and
+	// transport carry over, but the jar and redirect policy are ours.
+	httpClient := &http.Client{}
+	if c.httpClient != nil {
+		*httpClient = *c.httpClient
 	}
-
-	client := &http.Client{
-		Transport: transport,
-		Jar:       jar,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse // Don't follow redirects
-		},
+	if c.transport != nil {
+		httpClient.Transport = c.transport
+	}
+	switch c.cassetteMode {
+	case CassetteReplay:
+		replay, err := newReplayTransport(c.cassetteDir)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = replay
+		c.rateLimit = RateLimit{} // nothing to protect
+	case CassetteRecord:
+		if httpClient.Transport == nil {
+			httpClient.Transport = c.defaultTransport()
+		}
+		recorder, err := newRecordingTransport(c.cassetteDir, httpClient.Transport)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = recorder
 	}
+	if httpClient.Transport == nil {
+		httpClient.Transport = c.defaultTransport()
+	}
+	httpClient.Jar = jar
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse // Don't follow redirects
+	}
+	c.httpClient = httpClient
 
-	return &Client{
-		httpClient: client,
-		username:   username,
-		password:   password,
-		cookiePath: expandedPath,
-		logger:     logger,
-		logLevel:   logLevel,
-	}, nil
+	c.limiter = newRateLimiter(c.rateLimit)
+	c.transport = nil
+	return c, nil
 }
 
-// shouldLog returns true if the given log level should be logged based on the configured log level
-func (c *Client) shouldLog(level string) bool {
-	levels := map[string]int{
-		"trace": 0,
-		"debug": 1,
-		"info":  2,
-		"warn":  3,
-		"error": 4,
-	}
-
-	configuredLevel := c.logLevel
-	if configuredLevel == "" {
-		configuredLevel = "info" // Default to info if not set
+// defaultTransport clones the stdlib default transport so we inherit
+// proxy-from-env, connection pooling, and dial defaults — only overriding
+// what we need.
+func (c *Client) defaultTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	insecure := insecureTLSEnabled()
+	transport.TLSClientConfig = buildTLSConfig(insecure)
+	if insecure {
+		c.logger.Warn("SW_INSECURE_TLS is set — TLS certificate verification is DISABLED")
 	}
+	return transport
+}
 
-	return levels[level] >= levels[configuredLevel]
+// shouldLog returns true if the logger is enabled for the given level
+func (c *Client) shouldLog(ctx context.Context, level slog.Level) bool {
+	return c.logger.Enabled(ctx, level)
 }
 
 // logRequest logs the request details if log level is trace
 func (c *Client) logRequest(req *http.Request, body []byte) {
-	if !c.shouldLog("trace") {
+	ctx := req.Context()
+	if !c.shouldLog(ctx, LevelTrace) {
 		return
 	}
-	c.logger.Printf("Request Headers:")
-	for k, v := range req.Header {
-		c.logger.Printf("  %s: %s", k, strings.Join(v, ", "))
-	}
+	c.logger.Log(ctx, LevelTrace, "request headers", "url", req.URL.String(), "headers", flattenHeader(c.redact.header(req.Header)))
 	if len(body) > 0 {
-		c.logger.Printf("Request Body: %s", string(body))
+		c.logger.Log(ctx, LevelTrace, "request body", "url", req.URL.String(), "body", c.redact.body(req.Header.Get("Content-Type"), body))
 	}
 }
 
 // logResponse logs the response details if log level is trace
 func (c *Client) logResponse(resp *http.Response, body []byte) {
-	if !c.shouldLog("trace") {
+	ctx := resp.Request.Context()
+	if !c.shouldLog(ctx, LevelTrace) {
 		return
 	}
-	c.logger.Printf("Response Headers:")
-	for k, v := range resp.Header {
-		c.logger.Printf("  %s: %s", k, strings.Join(v, ", "))
-	}
+	c.logger.Log(ctx, LevelTrace, "response headers", "url", resp.Request.URL.String(), "headers", flattenHeader(c.redact.header(resp.Header)))
 	if len(body) > 0 {
-		preview := string(body)
+		preview := c.redact.body(resp.Header.Get("Content-Type"), body)
 		if len(preview) > 512 {
 			preview = preview[:512]
 		}
-		c.logger.Printf("Response Body Preview: %s", preview)
+		c.logger.Log(ctx, LevelTrace, "response body preview", "url", resp.Request.URL.String(), "body", preview)
 	}
 }
 
-// doRequest performs an HTTP request with logging
-func (c *Client) doRequest(req *http.Request) (*http.Response, []byte, error) {
-	// Log request method and URL at debug level
-	if c.shouldLog("debug") {
-		c.logger.Printf("Request: %s %s", req.Method, req.URL)
+// flattenHeader renders headers as "Key: v1, v2" lines for logging
+func flattenHeader(h http.Header) string {
+	lines := make([]string, 0, len(h))
+	for k, v := range h {
+		lines = append(lines, k+": "+strings.Join(v, ", "))
 	}
+	return strings.Join(lines, "\n")
+}
+
+// doRequest performs an HTTP request with logging. Transient failures (see
+// RetryPolicy) are retried with backoff; once the policy gives up, the last
+// response or error is returned to the caller as-is.
+func (c *Client) doRequest(req *http.Request) (*http.Response, []byte, error) {
+	return c.doRequestRetrying(req, false, true)
+}
+
+// doUnsafeRequest is doRequest for requests that change something, like an
+// upload or an edit. A 502, a 503 without Retry-After or a dropped
+// connection can come after Runalyze acted on the request, so only 429s
+// and 503s with Retry-After, which say it wasn't processed, are retried.
+func (c *Client) doUnsafeRequest(req *http.Request) (*http.Response, []byte, error) {
+	return c.doRequestRetrying(req, false, false)
+}
+
+// doStreamRequest is doRequest for large downloads: a 2xx response is
+// returned with its body unread, for the caller to stream and close. Other
+// responses are read as usual and returned with their body.
+func (c *Client) doStreamRequest(req *http.Request) (*http.Response, []byte, error) {
+	return c.doRequestRetrying(req, true, true)
+}
 
-	// Log request
+// doRequestRetrying implements doRequest, doUnsafeRequest and
+// doStreamRequest
+func (c *Client) doRequestRetrying(req *http.Request, stream, idempotent bool) (*http.Response, []byte, error) {
+	ctx := req.Context()
+
+	// Buffer the request body so it can be replayed on retries
 	var bodyBytes []byte
 	if req.Body != nil {
 		bodyBytes, _ = io.ReadAll(req.Body)
-		req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		req.Body.Close()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if stats := RequestStatsFromContext(ctx); stats != nil {
+			stats.Attempts++
+		}
+
+		attemptReq := req.Clone(ctx)
+		if bodyBytes != nil {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			attemptReq.ContentLength = int64(len(bodyBytes))
+		}
+
+		resp, respBody, err := c.doRequestOnce(attemptReq, bodyBytes, stream)
+
+		var retryAfter time.Duration
+		var reason string
+		switch {
+		case err != nil && idempotent && isRetryableError(err):
+			reason = err.Error()
+		case err == nil && idempotent && isRetryableStatus(resp.StatusCode),
+			err == nil && !idempotent && isUnprocessedStatus(resp):
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			reason = resp.Status
+		default:
+			return resp, respBody, err
+		}
+
+		if attempt >= c.retry.MaxAttempts {
+			if err != nil {
+				return nil, nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return resp, respBody, nil
+		}
+
+		delay := c.retry.backoff(attempt, retryAfter)
+		c.logger.Info("retrying request",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"delay", delay,
+			"attempt", attempt+1,
+			"max_attempts", c.retry.MaxAttempts,
+			"reason", reason)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, nil, fmt.Errorf("failed to send request: %w", err)
+		}
 	}
+}
+
+// doRequestOnce sends a single attempt of a request and reads the response,
+// unless stream is set and the response is a 2xx
+func (c *Client) doRequestOnce(req *http.Request, bodyBytes []byte, stream bool) (*http.Response, []byte, error) {
+	// Log request method and URL at debug level
+	c.logger.Debug("request", "method", req.Method, "url", req.URL.String())
 	c.logRequest(req, bodyBytes)
 
+	// Every request type shares one budget
+	if err := c.limiter.Wait(req.Context()); err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
 	// Do request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
+	// Let the limiter cool down while the server is throttling us
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusBadGateway {
+		pause := c.limiter.Throttle(parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		if pause > 0 {
+			c.logger.Info("server is throttling, pausing all requests", "status", resp.Status, "pause", pause)
+		}
+	} else {
+		c.limiter.Recover()
+	}
+
 	// Log response status at debug level
-	if c.shouldLog("debug") {
-		c.logger.Printf("Response: %s %s", resp.Status, req.URL)
+	c.logger.Debug("response", "status", resp.Status, "url", req.URL.String())
+
+	if stream && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		c.logResponse(resp, nil)
+		return resp, nil, nil
 	}
 
 	// Read and log response
 	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
 	if err != nil {
-		resp.Body.Close()
 		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 	resp.Body = io.NopCloser(bytes.NewBuffer(respBody))
@@ -249,12 +456,17 @@ func (c *Client) doRequest(req *http.Request) (*http.Response, []byte, error) {
 
 // Login performs the login process
 func (c *Client) Login() error {
-	csrfToken, err := c.doGetLogin()
+	return c.LoginContext(context.Background())
+}
+
+// LoginContext performs the login process, aborting if ctx is cancelled
+func (c *Client) LoginContext(ctx context.Context) error {
+	csrfToken, err := c.doGetLogin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get login page: %w", err)
 	}
 
-	err = c.doPostLogin(csrfToken)
+	err = c.doPostLogin(ctx, csrfToken)
 	if err != nil {
 		return fmt.Errorf("failed to post login: %w", err)
 	}
@@ -263,13 +475,13 @@ func (c *Client) Login() error {
 }
 
 // doGetLogin retrieves the login page and extracts the CSRF token
-func (c *Client) doGetLogin() (string, error) {
-	req, err := http.NewRequest("GET", baseURL+"/login", nil)
+func (c *Client) doGetLogin(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/login", nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	setDocumentHeaders(req)
+	c.setDocumentHeaders(req)
 
 	resp, body, err := c.doRequest(req)
 	if err != nil {
@@ -278,7 +490,7 @@ func (c *Client) doGetLogin() (string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", newStatusError(resp, body)
 	}
 
 	// Extract CSRF token using regex
@@ -292,7 +504,7 @@ func (c *Client) doGetLogin() (string, error) {
 }
 
 // doPostLogin performs the login POST request
-func (c *Client) doPostLogin(csrfToken string) error {
+func (c *Client) doPostLogin(ctx context.Context, csrfToken string) error {
 	data := url.Values{}
 	data.Set("_username", c.username)
 	data.Set("_password", c.password)
@@ -300,23 +512,23 @@ func (c *Client) doPostLogin(csrfToken string) error {
 	data.Set("submit", "Sign in")
 	data.Set("_csrf_token", csrfToken)
 
-	req, err := http.NewRequest("POST", baseURL+"/login", strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/login", strings.NewReader(data.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	setDocumentHeaders(req)
+	c.setDocumentHeaders(req)
 	req.Header.Set("content-type", "application/x-www-form-urlencoded")
 	req.Header.Set("cache-control", "max-age=0")
 
-	resp, _, err := c.doRequest(req)
+	resp, body, err := c.doRequest(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusFound {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return newStatusError(resp, body)
 	}
 
 	return nil
@@ -324,6 +536,11 @@ func (c *Client) doPostLogin(csrfToken string) error {
 
 // GetDataBrowser retrieves data for a specific week
 func (c *Client) GetDataBrowser(startOfWeek time.Time) ([]byte, error) {
+	return c.GetDataBrowserContext(context.Background(), startOfWeek)
+}
+
+// GetDataBrowserContext retrieves data for a specific week, aborting if ctx is cancelled
+func (c *Client) GetDataBrowserContext(ctx context.Context, startOfWeek time.Time) ([]byte, error) {
 	// Calculate end of week (last second of Sunday)
 	endOfWeek := startOfWeek.AddDate(0, 0, 7-int(startOfWeek.Weekday()))
 	endOfWeek = time.Date(endOfWeek.Year(), endOfWeek.Month(), endOfWeek.Day(), 23, 59, 59, 0, time.UTC)
@@ -331,14 +548,14 @@ func (c *Client) GetDataBrowser(startOfWeek time.Time) ([]byte, error) {
 	startUnix := startOfWeek.UTC().Unix()
 	endUnix := endOfWeek.UTC().Unix()
 
-	url := fmt.Sprintf("%s/databrowser?start=%d&end=%d", baseURL, startUnix, endUnix)
+	url := fmt.Sprintf("%s/databrowser?start=%d&end=%d", c.baseURL, startUnix, endUnix)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	setXHRHeaders(req)
+	c.setXHRHeaders(req)
 
 	resp, body, err := c.doRequest(req)
 	if err != nil {
@@ -354,73 +571,156 @@ func (c *Client) GetDataBrowser(startOfWeek time.Time) ([]byte, error) {
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, newStatusError(resp, body)
 	}
 
 	return body, nil
 }
 
-// getActivityExport retrieves an export file for a specific activity ID and format
-func (c *Client) getActivityExport(activityID, format string) ([]byte, string, error) {
-	url := fmt.Sprintf("%s/activity/%s/export/file/%s", baseURL, activityID, format)
+// ProgressFunc reports download progress: written bytes so far out of
+// total, which is -1 when the server didn't send a Content-Length.
+type ProgressFunc func(written, total int64)
+
+// contentDispositionFilenameRe extracts the filename of an export
+var contentDispositionFilenameRe = regexp.MustCompile(`filename="([^"]+)"`)
 
-	req, err := http.NewRequest("GET", url, nil)
+// streamActivityExport copies an export file for a specific activity ID and
+// format to w as it arrives and returns the server's filename for it
+func (c *Client) streamActivityExport(ctx context.Context, activityID, format string, w io.Writer, progress ProgressFunc) (string, error) {
+	url := fmt.Sprintf("%s/activity/%s/export/file/%s", c.baseURL, activityID, format)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	setDocumentHeaders(req)
-	req.Header.Set("referer", baseURL+"/dashboard")
+	c.setDocumentHeaders(req)
+	req.Header.Set("referer", c.baseURL+"/dashboard")
 
-	resp, body, err := c.doRequest(req)
+	resp, body, err := c.doStreamRequest(req)
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return "", newStatusError(resp, body)
 	}
 
 	// Extract filename from content-disposition header
 	contentDisposition := resp.Header.Get("content-disposition")
 	if contentDisposition == "" {
-		return nil, "", fmt.Errorf("content-disposition header not found")
+		return "", fmt.Errorf("content-disposition header not found")
 	}
 
 	// Parse filename from header
-	re := regexp.MustCompile(`filename="([^"]+)"`)
-	matches := re.FindStringSubmatch(contentDisposition)
+	matches := contentDispositionFilenameRe.FindStringSubmatch(contentDisposition)
 	if len(matches) < 2 {
-		return nil, "", fmt.Errorf("filename not found in content-disposition header")
+		return "", fmt.Errorf("filename not found in content-disposition header")
+	}
+
+	if progress != nil {
+		w = &progressWriter{w: w, total: resp.ContentLength, progress: progress}
+		progress(0, resp.ContentLength)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to download export: %w", err)
+	}
+
+	return matches[1], nil
+}
+
+// progressWriter reports every write to a ProgressFunc
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	pw.progress(pw.written, pw.total)
+	return n, err
+}
+
+// GetExport retrieves an export file in the given format (one of
+// ExportFormats) for a specific activity ID
+func (c *Client) GetExport(activityID, format string) ([]byte, string, error) {
+	return c.GetExportContext(context.Background(), activityID, format)
+}
+
+// GetExportContext retrieves an export file in the given format for a
+// specific activity ID, aborting if ctx is cancelled
+func (c *Client) GetExportContext(ctx context.Context, activityID, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	filename, err := c.streamActivityExport(ctx, activityID, format, &buf, nil)
+	if err != nil {
+		return nil, "", err
 	}
+	return buf.Bytes(), filename, nil
+}
 
-	return body, matches[1], nil
+// StreamExport writes an export file in the given format to w as it
+// downloads, calling progress (if not nil) as bytes arrive. It returns the
+// filename Runalyze suggests for the export. Unlike GetExport, memory use
+// doesn't grow with the file size.
+func (c *Client) StreamExport(activityID, format string, w io.Writer, progress ProgressFunc) (string, error) {
+	return c.StreamExportContext(context.Background(), activityID, format, w, progress)
+}
+
+// StreamExportContext is StreamExport, aborting if ctx is cancelled. A
+// failure halfway through leaves partial data in w, so write to a temp file.
+func (c *Client) StreamExportContext(ctx context.Context, activityID, format string, w io.Writer, progress ProgressFunc) (string, error) {
+	return c.streamActivityExport(ctx, activityID, format, w, progress)
 }
 
 // GetFit retrieves a FIT file for a specific activity ID
 func (c *Client) GetFit(activityID string) ([]byte, string, error) {
-	return c.getActivityExport(activityID, FitFormat)
+	return c.GetFitContext(context.Background(), activityID)
+}
+
+// GetFitContext retrieves a FIT file for a specific activity ID, aborting if ctx is cancelled
+func (c *Client) GetFitContext(ctx context.Context, activityID string) ([]byte, string, error) {
+	return c.GetExportContext(ctx, activityID, FitFormat)
 }
 
 // GetTcx retrieves a TCX file for a specific activity ID
 func (c *Client) GetTcx(activityID string) ([]byte, string, error) {
-	return c.getActivityExport(activityID, TcxFormat)
+	return c.GetTcxContext(context.Background(), activityID)
+}
+
+// GetTcxContext retrieves a TCX file for a specific activity ID, aborting if ctx is cancelled
+func (c *Client) GetTcxContext(ctx context.Context, activityID string) ([]byte, string, error) {
+	return c.GetExportContext(ctx, activityID, TcxFormat)
 }
 
-// GetActivityPage retrieves the HTML of an activity's detail page.
-// Used to scrape the export submenu so tests can verify the URL scheme
-// hasn't drifted.
+// GetActivityPage retrieves the HTML of an activity's detail page: its
+// title, notes, values and export submenu
 func (c *Client) GetActivityPage(activityID string) ([]byte, error) {
-	url := fmt.Sprintf("%s/activity/%s", baseURL, activityID)
+	return c.GetActivityPageContext(context.Background(), activityID)
+}
+
+// GetActivityPageContext retrieves the HTML of an activity's detail page,
+// aborting if ctx is cancelled. ErrRedirectedToLogin is returned if the
+// session is gone.
+func (c *Client) GetActivityPageContext(ctx context.Context, activityID string) ([]byte, error) {
+	url := fmt.Sprintf("%s/activity/%s", c.baseURL, activityID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	setDocumentHeaders(req)
+	c.setDocumentHeaders(req)
 
+	return c.getPage(req)
+}
+
+// getPage sends req for an HTML page and returns its body, or
+// ErrRedirectedToLogin if Runalyze sends the client to the login page
+func (c *Client) getPage(req *http.Request) ([]byte, error) {
 	resp, body, err := c.doRequest(req)
 	if err != nil {
 		return nil, err
@@ -433,18 +733,64 @@ func (c *Client) GetActivityPage(activityID string) ([]byte, error) {
 		}
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, newStatusError(resp, body)
 	}
 
 	return body, nil
 }
 
-// PersistCookies explicitly saves the current cookies to disk
+// GetHealthNote retrieves the HTML of the health note (daily body values:
+// resting heart rate, weight, sleep, HRV, notes) for a day
+func (c *Client) GetHealthNote(day time.Time) ([]byte, error) {
+	return c.GetHealthNoteContext(context.Background(), day)
+}
+
+// GetHealthNoteContext retrieves the HTML of the health note for a day,
+// aborting if ctx is cancelled
+func (c *Client) GetHealthNoteContext(ctx context.Context, day time.Time) ([]byte, error) {
+	url := fmt.Sprintf("%s/health/note/%s", c.baseURL, day.Format("2006-01-02"))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// The databrowser opens health notes in a modal, loaded by XHR
+	c.setXHRHeaders(req)
+
+	return c.getPage(req)
+}
+
+// GetEquipmentPage retrieves the HTML of the equipment overview, listing
+// every shoe, bike etc. with its accumulated distance and time
+func (c *Client) GetEquipmentPage() ([]byte, error) {
+	return c.GetEquipmentPageContext(context.Background())
+}
+
+// GetEquipmentPageContext retrieves the HTML of the equipment overview,
+// aborting if ctx is cancelled
+func (c *Client) GetEquipmentPageContext(ctx context.Context) ([]byte, error) {
+	url := fmt.Sprintf("%s/my/equipment", c.baseURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setDocumentHeaders(req)
+
+	return c.getPage(req)
+}
+
+// PersistCookies explicitly saves the current cookies to the cookie store,
+// and saves them as they change again after ResetCookies.
+// It is a no-op for clients created without WithCookieStore.
 func (c *Client) PersistCookies() error {
 	// Cast the jar to our persistent cookie jar to access the save method
 	if pjar, ok := c.httpClient.Jar.(*persistentCookieJar); ok {
 		pjar.mu.Lock()
 		defer pjar.mu.Unlock()
+		pjar.held = false
 		return pjar.save()
 	}
 	return fmt.Errorf("cookie jar is not a persistent cookie jar")
@@ -0,0 +1,41 @@
+package runalyze
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestGetDataBrowserContext_Cancel asserts that cancelling the context aborts
+// a request the server is still sitting on, instead of waiting it out.
+func TestGetDataBrowserContext_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := newTestClient(t, srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetDataBrowserContext(ctx, time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC))
+	if err == nil {
+		t.Fatal("expected error from cancelled request")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %v, cancellation did not abort it", elapsed)
+	}
+}
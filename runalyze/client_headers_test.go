@@ -23,11 +23,7 @@ func TestGetDataBrowser_HeadersMimicBrowser(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	prev := baseURL
-	baseURL = srv.URL
-	defer func() { baseURL = prev }()
-
-	client := newTestClient(t)
+	client := newTestClient(t, srv.URL)
 
 	if _, err := client.GetDataBrowser(time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)); err != nil {
 		t.Fatalf("GetDataBrowser failed: %v", err)
@@ -73,12 +69,16 @@ func TestGetDataBrowser_HeadersMimicBrowser(t *testing.T) {
 	}
 }
 
-func newTestClient(t *testing.T) *Client {
+func newTestClient(t *testing.T, baseURL string) *Client {
 	t.Helper()
 	cookiePath := filepath.Join(t.TempDir(), "cookies.json")
-	c, err := New("u", "p", cookiePath)
+	c, err := NewClient(
+		WithBaseURL(baseURL),
+		WithCredentials("u", "p"),
+		WithCookieStore(NewFileCookieStore(cookiePath)),
+	)
 	if err != nil {
-		t.Fatalf("New: %v", err)
+		t.Fatalf("NewClient: %v", err)
 	}
 	return c
 }
@@ -1,64 +1,64 @@
 package runalyze
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
-// persistentCookieJar implements a cookie jar that persists cookies to disk
+// persistentCookieJar implements a cookie jar that persists cookies to a
+// CookieStore. With a nil store it behaves like a plain in-memory jar.
+//
+// cookiejar.Jar only hands back name and value, so the jar keeps its own
+// copy of every cookie it is given, with the domain, path and expiry needed
+// to restore it. That copy is what gets saved, for every host the client
+// talked to rather than just the base URL.
 type persistentCookieJar struct {
 	*cookiejar.Jar
-	path        string
-	mu          sync.Mutex
-	logger      *log.Logger
-	shouldLogFn func(level string) bool
+	store   CookieStore
+	base    *url.URL // cookies without a domain belong here
+	mu      sync.Mutex
+	cookies map[cookieKey]*http.Cookie
+	logger  *slog.Logger
+	redact  redactor
+	now     func() time.Time
+	// held keeps new cookies out of the store until PersistCookies, see
+	// Client.ResetCookies
+	held bool
 }
 
-// cookieEntry represents a single cookie entry for serialization
-type cookieEntry struct {
-	Name       string    `json:"name"`
-	Value      string    `json:"value"`
-	Domain     string    `json:"domain"`
-	Path       string    `json:"path"`
-	Expires    time.Time `json:"expires"`
-	RawExpires string    `json:"raw_expires,omitempty"`
-	MaxAge     int       `json:"max_age"`
-	Secure     bool      `json:"secure"`
-	HttpOnly   bool      `json:"http_only"`
-	SameSite   int       `json:"same_site"`
-	Raw        string    `json:"raw,omitempty"`
-	Unparsed   []string  `json:"unparsed,omitempty"`
+// cookieKey identifies a cookie the way a browser does
+type cookieKey struct {
+	domain, path, name string
 }
 
 // newPersistentCookieJar creates a new persistent cookie jar
-func newPersistentCookieJar(path string, logger *log.Logger, shouldLogFn func(level string) bool) (*persistentCookieJar, error) {
+func newPersistentCookieJar(store CookieStore, base *url.URL, logger *slog.Logger, redact redactor) (*persistentCookieJar, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
 	}
 
 	pjar := &persistentCookieJar{
-		Jar:         jar,
-		path:        path,
-		logger:      logger,
-		shouldLogFn: shouldLogFn,
+		Jar:     jar,
+		store:   store,
+		base:    base,
+		cookies: make(map[cookieKey]*http.Cookie),
+		logger:  logger,
+		redact:  redact,
+		now:     time.Now,
 	}
 
 	// Try to load existing cookies
 	if err := pjar.load(); err != nil {
-		// It's okay if the file doesn't exist
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("failed to load cookies: %w", err)
-		}
+		return nil, fmt.Errorf("failed to load cookies: %w", err)
 	}
 
 	return pjar, nil
@@ -70,189 +70,137 @@ func (j *persistentCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
 	defer j.mu.Unlock()
 
 	j.Jar.SetCookies(u, cookies)
+	j.track(u, cookies)
 
 	// Save cookies after setting them
+	if j.held {
+		return
+	}
 	if err := j.save(); err != nil {
 		// Log error but don't fail the request
-		fmt.Printf("Failed to save cookies: %v\n", err)
+		j.logger.Warn("failed to save cookies", "error", err)
 	}
 }
 
-// load reads cookies from the file
-func (j *persistentCookieJar) load() error {
-	if j.shouldLogFn("debug") {
-		j.logger.Printf("Loading cookies from: %s", j.path)
-	}
+// track records cookies set for u, dropping the ones the server deleted or
+// that have already expired
+func (j *persistentCookieJar) track(u *url.URL, cookies []*http.Cookie) {
+	now := j.now()
+	for _, cookie := range cookies {
+		c := *cookie
+		if c.Domain == "" {
+			c.Domain = u.Hostname()
+		}
+		c.Domain = strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+		if c.Path == "" {
+			c.Path = "/"
+		}
 
-	data, err := os.ReadFile(j.path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			if j.shouldLogFn("debug") {
-				j.logger.Printf("Cookie file does not exist: %s", j.path)
-			}
+		// Store an absolute expiry so the cookie survives a reload with
+		// the right lifetime.
+		if c.MaxAge > 0 {
+			c.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+			c.RawExpires = ""
+			c.MaxAge = 0
 		}
-		return err
-	}
 
-	// Treat empty files as having no cookies
-	if len(data) == 0 {
-		if j.shouldLogFn("debug") {
-			j.logger.Printf("Cookie file is empty: %s", j.path)
+		key := cookieKey{domain: c.Domain, path: c.Path, name: c.Name}
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && !c.Expires.After(now)) {
+			delete(j.cookies, key)
+			continue
 		}
-		return nil
+		j.cookies[key] = &c
 	}
+}
 
-	var entries []cookieEntry
-	if err := json.Unmarshal(data, &entries); err != nil {
-		return fmt.Errorf("failed to unmarshal cookies: %w", err)
+// load reads cookies from the store
+func (j *persistentCookieJar) load() error {
+	if j.store == nil {
+		return nil
 	}
 
-	if j.shouldLogFn("trace") {
-		j.logger.Printf("Loaded %d cookie entries from file", len(entries))
-		for i, entry := range entries {
-			j.logger.Printf("  Cookie %d: %s=%s (domain: %s)", i+1, entry.Name, entry.Value, entry.Domain)
-		}
-	} else if j.shouldLogFn("debug") {
-		j.logger.Printf("Loaded %d cookie entries from file", len(entries))
+	j.logger.Debug("loading cookies")
+
+	cookies, err := j.store.Load()
+	if err != nil {
+		return err
 	}
 
-	// Convert entries back to cookies
-	cookies := make([]*http.Cookie, len(entries))
-	for i, entry := range entries {
-		cookies[i] = &http.Cookie{
-			Name:       entry.Name,
-			Value:      entry.Value,
-			Path:       entry.Path,
-			Domain:     entry.Domain,
-			Expires:    entry.Expires,
-			RawExpires: entry.RawExpires,
-			MaxAge:     entry.MaxAge,
-			Secure:     entry.Secure,
-			HttpOnly:   entry.HttpOnly,
-			SameSite:   http.SameSite(entry.SameSite),
-			Raw:        entry.Raw,
-			Unparsed:   entry.Unparsed,
+	if j.logger.Enabled(context.Background(), LevelTrace) {
+		for i, cookie := range cookies {
+			j.logger.Log(context.Background(), LevelTrace, "loaded cookie", "index", i+1, "name", cookie.Name, "value", j.redact.cookie(cookie.Value), "domain", cookie.Domain)
 		}
 	}
+	j.logger.Debug("loaded cookies", "count", len(cookies))
 
-	// Set cookies for all domains
-	urls := make(map[string]*url.URL)
-
-	// Handle cookies with empty domains by treating them as runalyze.com cookies
-	var runalyzeCookies []*http.Cookie
-
+	// Group cookies by host. Cookies with an empty domain (written by
+	// older versions) belong to the base URL.
+	byHost := make(map[string][]*http.Cookie)
 	for _, cookie := range cookies {
-		if cookie.Domain == "" {
-			// Treat empty domain cookies as belonging to runalyze.com
-			runalyzeCookies = append(runalyzeCookies, cookie)
-			continue
-		}
-
-		domain := cookie.Domain
-		if !strings.HasPrefix(domain, "http://") && !strings.HasPrefix(domain, "https://") {
-			domain = "https://" + domain
+		host := strings.TrimPrefix(cookie.Domain, ".")
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
 		}
-		if _, ok := urls[domain]; !ok {
-			u, err := url.Parse(domain)
-			if err != nil {
-				continue
-			}
-			urls[domain] = u
+		if host == "" {
+			host = j.base.Hostname()
 		}
+		byHost[host] = append(byHost[host], cookie)
 	}
 
-	// Set cookies for explicit domains
-	for _, u := range urls {
-		var domainCookies []*http.Cookie
-		for _, cookie := range cookies {
-			if cookie.Domain == u.Host {
-				domainCookies = append(domainCookies, cookie)
-			}
-		}
-		j.Jar.SetCookies(u, domainCookies)
-	}
-
-	// Set cookies with empty domains for runalyze.com
-	if len(runalyzeCookies) > 0 {
-		runalyzeURL, err := url.Parse("https://runalyze.com")
-		if err == nil {
-			j.Jar.SetCookies(runalyzeURL, runalyzeCookies)
+	for host, hostCookies := range byHost {
+		u := &url.URL{Scheme: j.base.Scheme, Host: host, Path: "/"}
+		if host == j.base.Hostname() {
+			u.Host = j.base.Host // keep the port, e.g. for httptest servers
 		}
+		j.Jar.SetCookies(u, hostCookies)
+		j.track(u, hostCookies)
 	}
 
 	return nil
 }
 
-// save writes cookies to the file
+// save writes cookies to the store
 func (j *persistentCookieJar) save() error {
-	if j.shouldLogFn("trace") {
-		j.logger.Printf("Saving cookies to: %s", j.path)
+	if j.store == nil {
+		return nil
 	}
 
-	// Get all cookies from the jar
-	entries := make([]cookieEntry, 0)
-	for _, u := range []string{"https://runalyze.com"} {
-		parsedURL, err := url.Parse(u)
-		if err != nil {
-			continue
-		}
-		cookies := j.Jar.Cookies(parsedURL)
-		for _, cookie := range cookies {
-			entries = append(entries, cookieEntry{
-				Name:       cookie.Name,
-				Value:      cookie.Value,
-				Path:       cookie.Path,
-				Domain:     cookie.Domain,
-				Expires:    cookie.Expires,
-				RawExpires: cookie.RawExpires,
-				MaxAge:     cookie.MaxAge,
-				Secure:     cookie.Secure,
-				HttpOnly:   cookie.HttpOnly,
-				SameSite:   int(cookie.SameSite),
-				Raw:        cookie.Raw,
-				Unparsed:   cookie.Unparsed,
-			})
-		}
-	}
+	cookies := j.snapshot()
 
-	if j.shouldLogFn("trace") {
-		j.logger.Printf("Saving %d cookie entries to file", len(entries))
-		for i, entry := range entries {
-			j.logger.Printf("  Cookie %d: %s=%s (domain: %s)", i+1, entry.Name, entry.Value, entry.Domain)
+	if j.logger.Enabled(context.Background(), LevelTrace) {
+		for i, cookie := range cookies {
+			j.logger.Log(context.Background(), LevelTrace, "saving cookie", "index", i+1, "name", cookie.Name, "value", j.redact.cookie(cookie.Value), "domain", cookie.Domain)
 		}
 	}
 
-	data, err := json.MarshalIndent(entries, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal cookies: %w", err)
-	}
-
-	// Atomic write: write to temp file in the same directory, then rename.
-	// This ensures the cookie file is never left in a truncated/corrupt state.
-	dir := filepath.Dir(j.path)
-	tmp, err := os.CreateTemp(dir, ".cookies-*.tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file for cookies: %w", err)
+	if err := j.store.Save(cookies); err != nil {
+		return err
 	}
-	tmpPath := tmp.Name()
 
-	if _, err := tmp.Write(data); err != nil {
-		tmp.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("failed to write cookies to temp file: %w", err)
-	}
-	if err := tmp.Close(); err != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("failed to close temp cookie file: %w", err)
-	}
-	if err := os.Rename(tmpPath, j.path); err != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("failed to rename temp cookie file: %w", err)
-	}
+	j.logger.Log(context.Background(), LevelTrace, "saved cookies", "count", len(cookies))
+	return nil
+}
 
-	if j.shouldLogFn("trace") {
-		j.logger.Printf("Successfully saved cookies to: %s", j.path)
+// snapshot returns copies of the unexpired tracked cookies in a stable order
+func (j *persistentCookieJar) snapshot() []*http.Cookie {
+	now := j.now()
+	cookies := make([]*http.Cookie, 0, len(j.cookies))
+	for key, cookie := range j.cookies {
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		c := *cookie
+		cookies = append(cookies, &c)
 	}
-
-	return nil
+	sort.Slice(cookies, func(a, b int) bool {
+		if cookies[a].Domain != cookies[b].Domain {
+			return cookies[a].Domain < cookies[b].Domain
+		}
+		if cookies[a].Path != cookies[b].Path {
+			return cookies[a].Path < cookies[b].Path
+		}
+		return cookies[a].Name < cookies[b].Name
+	})
+	return cookies
 }
@@ -1,7 +1,7 @@
 package runalyze
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -9,6 +9,8 @@ import (
 	"testing"
 )
 
+var testBaseURL, _ = url.Parse(DefaultBaseURL)
+
 func TestNewPersistentCookieJar_EmptyFile(t *testing.T) {
 	// Create an empty cookie file (simulates the production failure)
 	dir := t.TempDir()
@@ -17,8 +19,7 @@ func TestNewPersistentCookieJar_EmptyFile(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	logger := log.New(os.Stderr, "", 0)
-	jar, err := newPersistentCookieJar(cookiePath, logger, func(string) bool { return false })
+	jar, err := newPersistentCookieJar(NewFileCookieStore(cookiePath), testBaseURL, slog.New(slog.DiscardHandler), redactor{})
 	if err != nil {
 		t.Fatalf("expected no error for empty cookie file, got: %v", err)
 	}
@@ -31,8 +32,7 @@ func TestNewPersistentCookieJar_MissingFile(t *testing.T) {
 	dir := t.TempDir()
 	cookiePath := filepath.Join(dir, "nonexistent.json")
 
-	logger := log.New(os.Stderr, "", 0)
-	jar, err := newPersistentCookieJar(cookiePath, logger, func(string) bool { return false })
+	jar, err := newPersistentCookieJar(NewFileCookieStore(cookiePath), testBaseURL, slog.New(slog.DiscardHandler), redactor{})
 	if err != nil {
 		t.Fatalf("expected no error for missing cookie file, got: %v", err)
 	}
@@ -45,8 +45,7 @@ func TestSave_AtomicWrite(t *testing.T) {
 	dir := t.TempDir()
 	cookiePath := filepath.Join(dir, "cookies.json")
 
-	logger := log.New(os.Stderr, "", 0)
-	jar, err := newPersistentCookieJar(cookiePath, logger, func(string) bool { return false })
+	jar, err := newPersistentCookieJar(NewFileCookieStore(cookiePath), testBaseURL, slog.New(slog.DiscardHandler), redactor{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -94,8 +93,7 @@ func TestSave_NoTempFileLeftOnFailure(t *testing.T) {
 	dir := t.TempDir()
 	cookiePath := filepath.Join(dir, "cookies.json")
 
-	logger := log.New(os.Stderr, "", 0)
-	jar, err := newPersistentCookieJar(cookiePath, logger, func(string) bool { return false })
+	jar, err := newPersistentCookieJar(NewFileCookieStore(cookiePath), testBaseURL, slog.New(slog.DiscardHandler), redactor{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -117,3 +115,69 @@ func TestSave_NoTempFileLeftOnFailure(t *testing.T) {
 		}
 	}
 }
+
+// Cookies for every host are saved with their domain and expiry, not only
+// the base URL's name/value pairs.
+func TestSave_KeepsDomainsAndExpiry(t *testing.T) {
+	store := NewMemoryCookieStore()
+	jar, err := newPersistentCookieJar(store, testBaseURL, slog.New(slog.DiscardHandler), redactor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runalyzeURL, _ := url.Parse("https://runalyze.com/login")
+	otherURL, _ := url.Parse("https://static.runalyze.com/")
+	jar.SetCookies(runalyzeURL, []*http.Cookie{
+		{Name: "REMEMBERME", Value: "r", MaxAge: 3600},
+		{Name: "PHPSESSID", Value: "s"},
+	})
+	jar.SetCookies(otherURL, []*http.Cookie{{Name: "cdn", Value: "c"}})
+
+	saved, _ := store.Load()
+	got := make(map[string]*http.Cookie)
+	for _, c := range saved {
+		got[c.Name] = c
+	}
+	if len(got) != 3 {
+		t.Fatalf("saved %d cookies, want 3: %v", len(saved), saved)
+	}
+	if got["cdn"].Domain != "static.runalyze.com" {
+		t.Errorf("cdn domain = %q, want static.runalyze.com", got["cdn"].Domain)
+	}
+	if got["REMEMBERME"].Expires.IsZero() {
+		t.Error("REMEMBERME lost its expiry")
+	}
+
+	// The server deleting a cookie removes it from the store
+	jar.SetCookies(runalyzeURL, []*http.Cookie{{Name: "PHPSESSID", MaxAge: -1}})
+	saved, _ = store.Load()
+	for _, c := range saved {
+		if c.Name == "PHPSESSID" {
+			t.Fatal("deleted cookie still saved")
+		}
+	}
+
+	// A new jar over the same store sends the saved cookies again
+	jar2, err := newPersistentCookieJar(store, testBaseURL, slog.New(slog.DiscardHandler), redactor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs := jar2.Cookies(runalyzeURL); len(cs) != 1 || cs[0].Name != "REMEMBERME" {
+		t.Errorf("reloaded cookies for runalyze.com = %v, want REMEMBERME", cs)
+	}
+	if cs := jar2.Cookies(otherURL); len(cs) == 0 {
+		t.Error("reloaded jar lost the static.runalyze.com cookie")
+	}
+}
+
+// Cookie files from older versions have no domain; they belong to the base URL.
+func TestLoad_EmptyDomainBelongsToBaseURL(t *testing.T) {
+	store := NewMemoryCookieStore(&http.Cookie{Name: "PHPSESSID", Value: "old"})
+	jar, err := newPersistentCookieJar(store, testBaseURL, slog.New(slog.DiscardHandler), redactor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs := jar.Cookies(testBaseURL); len(cs) != 1 || cs[0].Value != "old" {
+		t.Errorf("Cookies(base) = %v, want the legacy cookie", cs)
+	}
+}
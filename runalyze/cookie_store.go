@@ -0,0 +1,205 @@
+package runalyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CookieStore persists the client's session cookies between runs. Load is
+// called once when the client is created; Save whenever the server changes
+// a cookie. Cookies without a Domain belong to the client's base URL.
+type CookieStore interface {
+	Load() ([]*http.Cookie, error)
+	Save(cookies []*http.Cookie) error
+}
+
+// FileCookieStore keeps cookies in a plaintext JSON file.
+type FileCookieStore struct {
+	path string
+}
+
+// NewFileCookieStore returns a store backed by the JSON file at path. The
+// file's directory must exist; see NewFileCookieStoreAt.
+func NewFileCookieStore(path string) *FileCookieStore {
+	return &FileCookieStore{path: path}
+}
+
+// Path returns the file the store reads and writes.
+func (s *FileCookieStore) Path() string {
+	return s.path
+}
+
+// MemoryCookieStore keeps cookies in memory, for tests and one-shot runs
+// that should leave nothing on disk.
+type MemoryCookieStore struct {
+	mu      sync.Mutex
+	cookies []*http.Cookie
+}
+
+// NewMemoryCookieStore returns a store preloaded with cookies.
+func NewMemoryCookieStore(cookies ...*http.Cookie) *MemoryCookieStore {
+	s := &MemoryCookieStore{}
+	s.cookies = copyCookies(cookies)
+	return s
+}
+
+// Load returns copies of the stored cookies.
+func (s *MemoryCookieStore) Load() ([]*http.Cookie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCookies(s.cookies), nil
+}
+
+// Save replaces the stored cookies with copies of cookies.
+func (s *MemoryCookieStore) Save(cookies []*http.Cookie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cookies = copyCookies(cookies)
+	return nil
+}
+
+// copyCookies returns a deep enough copy that callers can't mutate the store
+func copyCookies(cookies []*http.Cookie) []*http.Cookie {
+	if len(cookies) == 0 {
+		return nil
+	}
+	out := make([]*http.Cookie, len(cookies))
+	for i, cookie := range cookies {
+		c := *cookie
+		c.Unparsed = append([]string(nil), cookie.Unparsed...)
+		out[i] = &c
+	}
+	return out
+}
+
+// cookieEntry represents a single cookie entry for serialization
+type cookieEntry struct {
+	Name       string    `json:"name"`
+	Value      string    `json:"value"`
+	Domain     string    `json:"domain"`
+	Path       string    `json:"path"`
+	Expires    time.Time `json:"expires"`
+	RawExpires string    `json:"raw_expires,omitempty"`
+	MaxAge     int       `json:"max_age"`
+	Secure     bool      `json:"secure"`
+	HttpOnly   bool      `json:"http_only"`
+	SameSite   int       `json:"same_site"`
+	Raw        string    `json:"raw,omitempty"`
+	Unparsed   []string  `json:"unparsed,omitempty"`
+}
+
+// Load reads cookies from the file. A missing or empty file holds no cookies.
+func (s *FileCookieStore) Load() ([]*http.Cookie, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return unmarshalCookies(data)
+}
+
+// Save replaces the file's contents with cookies
+func (s *FileCookieStore) Save(cookies []*http.Cookie) error {
+	data, err := marshalCookies(cookies)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, 0600)
+}
+
+// marshalCookies serializes cookies to the JSON cookie file format
+func marshalCookies(cookies []*http.Cookie) ([]byte, error) {
+	entries := make([]cookieEntry, 0, len(cookies))
+	for _, cookie := range cookies {
+		entries = append(entries, cookieEntry{
+			Name:       cookie.Name,
+			Value:      cookie.Value,
+			Path:       cookie.Path,
+			Domain:     cookie.Domain,
+			Expires:    cookie.Expires,
+			RawExpires: cookie.RawExpires,
+			MaxAge:     cookie.MaxAge,
+			Secure:     cookie.Secure,
+			HttpOnly:   cookie.HttpOnly,
+			SameSite:   int(cookie.SameSite),
+			Raw:        cookie.Raw,
+			Unparsed:   cookie.Unparsed,
+		})
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cookies: %w", err)
+	}
+	return data, nil
+}
+
+// unmarshalCookies parses the JSON cookie file format. Empty input holds
+// no cookies.
+func unmarshalCookies(data []byte) ([]*http.Cookie, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var entries []cookieEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cookies: %w", err)
+	}
+
+	cookies := make([]*http.Cookie, len(entries))
+	for i, entry := range entries {
+		cookies[i] = &http.Cookie{
+			Name:       entry.Name,
+			Value:      entry.Value,
+			Path:       entry.Path,
+			Domain:     entry.Domain,
+			Expires:    entry.Expires,
+			RawExpires: entry.RawExpires,
+			MaxAge:     entry.MaxAge,
+			Secure:     entry.Secure,
+			HttpOnly:   entry.HttpOnly,
+			SameSite:   http.SameSite(entry.SameSite),
+			Raw:        entry.Raw,
+			Unparsed:   entry.Unparsed,
+		}
+	}
+	return cookies, nil
+}
+
+// writeFileAtomic writes to a temp file in the same directory, then renames.
+// This ensures the file is never left in a truncated/corrupt state.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".cookies-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for cookies: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write cookies to temp file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set cookie file permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp cookie file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp cookie file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package runalyze
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// PassphraseEnv is the environment variable PassphraseFromEnv reads by default.
+const PassphraseEnv = "SW_COOKIE_PASSPHRASE"
+
+const (
+	encryptedCookieVersion = 1
+	encryptedCookieKDF     = "pbkdf2-sha256"
+	pbkdf2Iterations       = 600_000
+	pbkdf2SaltSize         = 16
+	aesKeySize             = 32
+)
+
+// ErrWrongPassphrase is returned when an encrypted cookie file can't be
+// decrypted, either because the passphrase changed or the file was tampered with.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted cookie file")
+
+// PassphraseFunc returns the passphrase an EncryptedFileCookieStore derives
+// its key from. It is called at most once per store.
+type PassphraseFunc func() (string, error)
+
+// PassphraseFromEnv reads the passphrase from the environment variable name
+// (PassphraseEnv if empty).
+func PassphraseFromEnv(name string) PassphraseFunc {
+	if name == "" {
+		name = PassphraseEnv
+	}
+	return func() (string, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return "", fmt.Errorf("cookie passphrase: %s is not set", name)
+		}
+		return v, nil
+	}
+}
+
+// PassphraseFromCommand runs command with "sh -c" and uses its output,
+// minus the trailing newline, as the passphrase. This works with password
+// managers, e.g. "pass show syncwich" or
+// "security find-generic-password -w -s syncwich". The command's stderr
+// and stdin are the terminal's, so it may prompt.
+func PassphraseFromCommand(command string) PassphraseFunc {
+	return func() (string, error) {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("cookie passphrase command failed: %w", err)
+		}
+		v := strings.TrimRight(string(out), "\r\n")
+		if v == "" {
+			return "", fmt.Errorf("cookie passphrase command printed nothing")
+		}
+		return v, nil
+	}
+}
+
+// EncryptedFileCookieStore keeps cookies in a file encrypted with AES-256-GCM.
+// The key is derived from a passphrase with PBKDF2-SHA256, so the file on
+// its own is useless to whoever copies it.
+//
+// A plaintext file written by FileCookieStore is still read, and is
+// replaced by an encrypted one on the next save.
+type EncryptedFileCookieStore struct {
+	path       string
+	passphrase PassphraseFunc
+
+	mu         sync.Mutex
+	pass       string // cached so the passphrase command runs once
+	salt       []byte
+	iterations int
+	key        []byte // derived from pass, salt and iterations
+}
+
+// encryptedCookieFile is the on-disk format of an EncryptedFileCookieStore
+type encryptedCookieFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewEncryptedFileCookieStore returns a store backed by the encrypted file
+// at path. The file's directory must exist; see NewEncryptedFileCookieStoreAt.
+func NewEncryptedFileCookieStore(path string, passphrase PassphraseFunc) *EncryptedFileCookieStore {
+	return &EncryptedFileCookieStore{path: path, passphrase: passphrase}
+}
+
+// Path returns the file the store reads and writes.
+func (s *EncryptedFileCookieStore) Path() string {
+	return s.path
+}
+
+// Load decrypts cookies from the file. A missing or empty file holds no
+// cookies and doesn't need the passphrase.
+func (s *EncryptedFileCookieStore) Load() ([]*http.Cookie, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	if trimmed[0] == '[' {
+		// Plaintext file from FileCookieStore
+		return unmarshalCookies(trimmed)
+	}
+
+	var file encryptedCookieFile
+	if err := json.Unmarshal(trimmed, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted cookie file: %w", err)
+	}
+	if file.Version != encryptedCookieVersion || file.KDF != encryptedCookieKDF {
+		return nil, fmt.Errorf("unsupported encrypted cookie file (version %d, kdf %q)", file.Version, file.KDF)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iterations := file.Iterations
+	if iterations <= 0 {
+		iterations = pbkdf2Iterations
+	}
+	key, err := s.deriveKey(file.Salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	// Keep encrypting with the same salt and iterations so saves don't
+	// re-run the KDF
+	s.salt, s.iterations, s.key = file.Salt, iterations, key
+	return unmarshalCookies(plaintext)
+}
+
+// Save encrypts cookies and replaces the file's contents.
+func (s *EncryptedFileCookieStore) Save(cookies []*http.Cookie) error {
+	plaintext, err := marshalCookies(cookies)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil {
+		salt := make([]byte, pbkdf2SaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+		key, err := s.deriveKey(salt, pbkdf2Iterations)
+		if err != nil {
+			return err
+		}
+		s.salt, s.iterations, s.key = salt, pbkdf2Iterations, key
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.MarshalIndent(encryptedCookieFile{
+		Version:    encryptedCookieVersion,
+		KDF:        encryptedCookieKDF,
+		Iterations: s.iterations,
+		Salt:       s.salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal encrypted cookies: %w", err)
+	}
+	return writeFileAtomic(s.path, data, 0600)
+}
+
+// deriveKey derives the AES key for salt, asking for the passphrase the
+// first time. Callers hold s.mu.
+func (s *EncryptedFileCookieStore) deriveKey(salt []byte, iterations int) ([]byte, error) {
+	if s.pass == "" {
+		if s.passphrase == nil {
+			return nil, fmt.Errorf("encrypted cookie store has no passphrase")
+		}
+		pass, err := s.passphrase()
+		if err != nil {
+			return nil, err
+		}
+		s.pass = pass
+	}
+	key, err := pbkdf2.Key(sha256.New, s.pass, salt, iterations, aesKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive cookie key: %w", err)
+	}
+	return key, nil
+}
+
+// newGCM returns an AES-GCM AEAD for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
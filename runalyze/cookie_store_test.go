@@ -0,0 +1,175 @@
+package runalyze
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func staticPassphrase(p string) PassphraseFunc {
+	return func() (string, error) { return p, nil }
+}
+
+func TestMemoryCookieStore_RoundTrip(t *testing.T) {
+	store := NewMemoryCookieStore(&http.Cookie{Name: "a", Value: "1"})
+
+	cookies, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 1 || cookies[0].Value != "1" {
+		t.Fatalf("Load() = %v, want the preloaded cookie", cookies)
+	}
+
+	// Mutating what Load returned must not change the store
+	cookies[0].Value = "changed"
+	if err := store.Save([]*http.Cookie{{Name: "b", Value: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	cookies, _ = store.Load()
+	if len(cookies) != 1 || cookies[0].Name != "b" {
+		t.Fatalf("Load() after Save = %v, want only cookie b", cookies)
+	}
+}
+
+func TestEncryptedFileCookieStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	store := NewEncryptedFileCookieStore(path, staticPassphrase("correct horse"))
+	if err := store.Save([]*http.Cookie{
+		{Name: "REMEMBERME", Value: "secret-session", Domain: "runalyze.com", Path: "/", Expires: expires},
+	}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-session") || strings.Contains(string(data), "REMEMBERME") {
+		t.Fatalf("cookie file contains plaintext:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("cookie file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A fresh store (new process) with the same passphrase reads it back
+	cookies, err := NewEncryptedFileCookieStore(path, staticPassphrase("correct horse")).Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cookies) != 1 || cookies[0].Value != "secret-session" || !cookies[0].Expires.Equal(expires) {
+		t.Fatalf("Load() = %+v, want the saved cookie", cookies)
+	}
+}
+
+func TestEncryptedFileCookieStore_WrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	if err := NewEncryptedFileCookieStore(path, staticPassphrase("right")).Save([]*http.Cookie{{Name: "a", Value: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewEncryptedFileCookieStore(path, staticPassphrase("wrong")).Load()
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Load with wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+// A file written with another iteration count than pbkdf2Iterations is
+// re-saved with that count, so it can still be decrypted.
+func TestEncryptedFileCookieStore_KeepsIterations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	old := NewEncryptedFileCookieStore(path, staticPassphrase("pw"))
+	old.salt, old.iterations = []byte("0123456789abcdef"), 1000
+	key, err := old.deriveKey(old.salt, old.iterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.key = key
+	if err := old.Save([]*http.Cookie{{Name: "a", Value: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewEncryptedFileCookieStore(path, staticPassphrase("pw"))
+	cookies, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := store.Save(cookies); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies, err = NewEncryptedFileCookieStore(path, staticPassphrase("pw")).Load()
+	if err != nil {
+		t.Fatalf("Load after re-save: %v", err)
+	}
+	if len(cookies) != 1 || cookies[0].Value != "1" {
+		t.Fatalf("Load() = %v, want the saved cookie", cookies)
+	}
+}
+
+// An existing plaintext cookie file keeps the user logged in and is
+// encrypted on the next save.
+func TestEncryptedFileCookieStore_MigratesPlaintext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	if err := NewFileCookieStore(path).Save([]*http.Cookie{{Name: "PHPSESSID", Value: "plain"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewEncryptedFileCookieStore(path, staticPassphrase("pw"))
+	cookies, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load plaintext: %v", err)
+	}
+	if len(cookies) != 1 || cookies[0].Value != "plain" {
+		t.Fatalf("Load() = %v, want the plaintext cookie", cookies)
+	}
+
+	if err := store.Save(cookies); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "plain") {
+		t.Fatalf("cookie file still plaintext after save:\n%s", data)
+	}
+}
+
+func TestEncryptedFileCookieStore_MissingFileNeedsNoPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	failing := func() (string, error) { return "", errors.New("no passphrase") }
+
+	cookies, err := NewEncryptedFileCookieStore(path, failing).Load()
+	if err != nil || cookies != nil {
+		t.Fatalf("Load() = %v, %v; want nil, nil", cookies, err)
+	}
+}
+
+func TestPassphraseFromCommand(t *testing.T) {
+	pass, err := PassphraseFromCommand("printf 'hunter2\\n'")()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass != "hunter2" {
+		t.Errorf("passphrase = %q, want %q", pass, "hunter2")
+	}
+
+	if _, err := PassphraseFromCommand("exit 1")(); err == nil {
+		t.Error("expected error from failing command")
+	}
+}
+
+func TestPassphraseFromEnv(t *testing.T) {
+	t.Setenv("SW_TEST_PASSPHRASE", "")
+	if _, err := PassphraseFromEnv("SW_TEST_PASSPHRASE")(); err == nil {
+		t.Error("expected error for unset variable")
+	}
+	t.Setenv("SW_TEST_PASSPHRASE", "s3cret")
+	if pass, err := PassphraseFromEnv("SW_TEST_PASSPHRASE")(); err != nil || pass != "s3cret" {
+		t.Errorf("PassphraseFromEnv = %q, %v", pass, err)
+	}
+}
@@ -0,0 +1,118 @@
+package runalyze
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// errorAlertRe matches the alert Runalyze shows above a form it didn't accept
+	errorAlertRe = regexp.MustCompile(`(?is)<div[^>]*class="[^"]*alert-(?:danger|error)[^"]*"[^>]*>(.*?)</div>`)
+	// invalidFieldRe matches a field, or its form group, that the form
+	// theme marks as invalid when it shows the form again
+	invalidFieldRe = regexp.MustCompile(`(?i)class="[^"]*\b(?:has-error|is-invalid)\b`)
+	// fieldErrorRe matches the error listed under an invalid field
+	fieldErrorRe = regexp.MustCompile(`(?is)<li[^>]*>(.*?)</li>|<span[^>]*class="form-error-message"[^>]*>(.*?)</span>`)
+)
+
+// EditRejectedError is returned when Runalyze shows the edit form again
+// with an error instead of saving it
+type EditRejectedError struct {
+	ActivityID string
+	Message    string
+}
+
+func (e *EditRejectedError) Error() string {
+	return fmt.Sprintf("runalyze rejected the edit of activity %s: %s", e.ActivityID, e.Message)
+}
+
+// GetActivityEditPage retrieves the HTML of an activity's edit form
+func (c *Client) GetActivityEditPage(activityID string) ([]byte, error) {
+	return c.GetActivityEditPageContext(context.Background(), activityID)
+}
+
+// GetActivityEditPageContext retrieves the HTML of an activity's edit form,
+// aborting if ctx is cancelled. The form carries its own CSRF token, which
+// has to be posted back with SaveActivityContext.
+func (c *Client) GetActivityEditPageContext(ctx context.Context, activityID string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.activityEditURL(activityID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setDocumentHeaders(req)
+
+	return c.getPage(req)
+}
+
+// SaveActivity posts the fields of an activity's edit form
+func (c *Client) SaveActivity(activityID string, form url.Values) error {
+	return c.SaveActivityContext(context.Background(), activityID, form)
+}
+
+// SaveActivityContext posts the fields of an activity's edit form, aborting
+// if ctx is cancelled. form must hold every field of the form, including the
+// hidden CSRF token, since Runalyze resets fields that are left out. An
+// *EditRejectedError is returned if Runalyze doesn't accept the values.
+func (c *Client) SaveActivityContext(ctx context.Context, activityID string, form url.Values) error {
+	editURL := c.activityEditURL(activityID)
+	req, err := http.NewRequestWithContext(ctx, "POST", editURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setDocumentHeaders(req)
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("referer", editURL)
+
+	resp, body, err := c.doUnsafeRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return parseEditResponse(resp, body, activityID)
+}
+
+// parseEditResponse tells saved and rejected edits apart. A save redirects
+// to the activity or shows the form again with a notice; a rejection shows
+// it with an error alert, or with errors under the fields.
+func parseEditResponse(resp *http.Response, body []byte, activityID string) error {
+	switch {
+	case resp.StatusCode == http.StatusFound || resp.StatusCode == http.StatusSeeOther:
+		if strings.HasSuffix(resp.Header.Get("Location"), "/login") {
+			return ErrRedirectedToLogin
+		}
+		return nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300 && resp.StatusCode != http.StatusUnprocessableEntity:
+		return newStatusError(resp, body)
+	}
+
+	if m := errorAlertRe.FindSubmatch(body); m != nil {
+		return &EditRejectedError{ActivityID: activityID, Message: htmlText(m[1])}
+	}
+	if loc := invalidFieldRe.FindIndex(body); loc != nil {
+		message := "a field was not accepted"
+		if m := fieldErrorRe.FindSubmatch(body[loc[1]:]); m != nil {
+			text := m[1]
+			if text == nil {
+				text = m[2]
+			}
+			message = htmlText(text)
+		}
+		return &EditRejectedError{ActivityID: activityID, Message: message}
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return &EditRejectedError{ActivityID: activityID, Message: "invalid form"}
+	}
+	return nil
+}
+
+// activityEditURL returns the URL of an activity's edit form
+func (c *Client) activityEditURL(activityID string) string {
+	return fmt.Sprintf("%s/activity/%s/edit", c.baseURL, activityID)
+}
@@ -0,0 +1,53 @@
+package runalyze
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseEditResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		location   string
+		body       string
+		wantMsg    string
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{name: "saved", status: http.StatusFound, location: "/activity/101"},
+		{name: "saved with notice", status: http.StatusOK, body: `<div class="alert alert-success">Saved</div><form><select name="activity[sport]"></select></form>`},
+		{name: "logged out", status: http.StatusFound, location: "/login", wantErr: ErrRedirectedToLogin},
+		{name: "alert", status: http.StatusOK, body: `<div class="alert alert-danger">The CSRF token is invalid.</div>`, wantMsg: "The CSRF token is invalid."},
+		{name: "field error", status: http.StatusOK, body: `<ul><li>Dashboard</li></ul><div class="form-group has-error"><select name="activity[sport]"></select><span class="help-block"><ul class="list-unstyled"><li><span class="glyphicon glyphicon-exclamation-sign"></span> This value is not valid.</li></ul></span></div>`, wantMsg: "This value is not valid."},
+		{name: "field error message", status: http.StatusOK, body: `<select class="form-control is-invalid" name="activity[type]"></select><span class="invalid-feedback d-block"><span class="d-block"><span class="form-error-icon badge badge-danger">Error</span> <span class="form-error-message">This value should not be blank.</span></span></span>`, wantMsg: "This value should not be blank."},
+		{name: "invalid field without message", status: http.StatusOK, body: `<input class="form-control is-invalid" name="activity[title]">`, wantMsg: "a field was not accepted"},
+		{name: "unprocessable", status: http.StatusUnprocessableEntity, wantMsg: "invalid form"},
+		{name: "server error", status: http.StatusInternalServerError, wantAnyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, Request: &http.Request{Method: "POST"}}
+			if tt.location != "" {
+				resp.Header.Set("Location", tt.location)
+			}
+
+			err := parseEditResponse(resp, []byte(tt.body), "101")
+
+			var rejected *EditRejectedError
+			switch {
+			case tt.wantErr != nil || tt.wantAnyErr:
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantMsg != "":
+				if !errors.As(err, &rejected) || rejected.Message != tt.wantMsg {
+					t.Errorf("err = %v, want rejected with %q", err, tt.wantMsg)
+				}
+			case err != nil:
+				t.Errorf("err = %v, want saved", err)
+			}
+		})
+	}
+}
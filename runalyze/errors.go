@@ -0,0 +1,79 @@
+package runalyze
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySnippet caps how much of a response body a StatusError keeps.
+// Runalyze error pages are full HTML documents; the first few hundred bytes
+// are enough to tell a WAF block from an application error.
+const maxErrorBodySnippet = 512
+
+// StatusError is returned when Runalyze answers with a status code the caller
+// did not expect. Use errors.As to inspect it:
+//
+//	var se *runalyze.StatusError
+//	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound { ... }
+type StatusError struct {
+	StatusCode int
+	URL        string
+	RetryAfter time.Duration // zero if the server sent no Retry-After header
+	Body       string        // leading snippet of the response body
+}
+
+func (e *StatusError) Error() string {
+	if e.URL == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d (%s)", e.StatusCode, e.URL)
+}
+
+// newStatusError builds a StatusError from a response whose body has already
+// been read by doRequest.
+func newStatusError(resp *http.Response, body []byte) *StatusError {
+	snippet := string(body)
+	if len(snippet) > maxErrorBodySnippet {
+		snippet = snippet[:maxErrorBodySnippet]
+	}
+	se := &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Body:       snippet,
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		se.URL = resp.Request.URL.String()
+	}
+	return se
+}
+
+// IsNotFound reports whether err is a StatusError carrying a 404.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// parseRetryAfter understands both forms of the Retry-After header: a number
+// of seconds, or an HTTP date. Anything unparseable or in the past yields 0.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,60 @@
+package runalyze
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestStreamExport_ReportsProgress(t *testing.T) {
+	payload := bytes.Repeat([]byte("FIT."), 256*1024) // 1 MiB
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/activity/7/export/file/fit-original" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="7.fit"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		_, _ = w.Write(payload)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL)
+
+	var buf bytes.Buffer
+	var calls int
+	var last, total int64
+	filename, err := client.StreamExport("7", FitFormat, &buf, func(written, n int64) {
+		if written < last {
+			t.Errorf("progress went backwards: %d after %d", written, last)
+		}
+		calls++
+		last, total = written, n
+	})
+	if err != nil {
+		t.Fatalf("StreamExport: %v", err)
+	}
+	if filename != "7.fit" {
+		t.Errorf("filename = %q, want 7.fit", filename)
+	}
+	if !bytes.Equal(buf.Bytes(), payload) {
+		t.Error("streamed content differs from the served file")
+	}
+	if total != int64(len(payload)) || last != total {
+		t.Errorf("final progress = %d/%d, want %d/%d", last, total, len(payload), len(payload))
+	}
+	if calls < 3 {
+		t.Errorf("progress called %d times, want updates while streaming", calls)
+	}
+
+	// Missing exports still come back as a typed 404, with nothing written
+	buf.Reset()
+	if _, err := client.StreamExport("7", TcxFormat, &buf, nil); !IsNotFound(err) {
+		t.Errorf("err = %v, want 404", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes of an error page", buf.Len())
+	}
+}
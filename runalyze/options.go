@@ -0,0 +1,106 @@
+package runalyze
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// Option configures a Client created with NewClient.
+type Option func(*Client)
+
+// WithBaseURL points the client at a different Runalyze instance, e.g. an
+// httptest server. Defaults to DefaultBaseURL; an empty baseURL keeps the default.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		if baseURL != "" {
+			c.baseURL = baseURL
+		}
+	}
+}
+
+// WithHTTPClient makes the client send requests through a copy of hc, keeping
+// its transport and timeout. The copy's cookie jar and redirect policy are
+// replaced: the client manages cookies itself and never follows redirects.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTransport sets the round tripper requests go through. It takes
+// precedence over the transport of WithHTTPClient.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithCookieStore persists the session cookies in store, so the login
+// survives between runs. Without it cookies live in memory only.
+func WithCookieStore(store CookieStore) Option {
+	return func(c *Client) {
+		c.store = store
+	}
+}
+
+// WithSlogLogger sends the client's logs to logger. Request and response
+// dumps are logged at LevelTrace. Without it the client logs nothing.
+func WithSlogLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// WithUnsafeTrace turns off the redaction of passwords, CSRF tokens, cookie
+// values and auth headers in trace logs. Logs written with it enabled must
+// not be shared.
+func WithUnsafeTrace(unsafe bool) Option {
+	return func(c *Client) {
+		c.redact.unsafe = unsafe
+	}
+}
+
+// WithCassette records all HTTP traffic to dir, or replays it from dir
+// without touching the network. Recorded cassettes have passwords, CSRF
+// tokens, cookie values and the username masked, but still contain the
+// activity data that was downloaded.
+func WithCassette(dir string, mode CassetteMode) Option {
+	return func(c *Client) {
+		c.cassetteDir = dir
+		c.cassetteMode = mode
+	}
+}
+
+// WithCredentials sets the username and password used by Login.
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithUserAgent overrides DefaultUserAgent. Keep it browser-like: the
+// Runalyze WAF rejects obvious bots.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		if userAgent != "" {
+			c.userAgent = userAgent
+		}
+	}
+}
+
+// WithRetryPolicy overrides DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithRateLimit overrides DefaultRateLimit.
+func WithRateLimit(limit RateLimit) Option {
+	return func(c *Client) {
+		c.rateLimit = limit
+	}
+}
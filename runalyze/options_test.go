@@ -0,0 +1,85 @@
+package runalyze
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestNewClient_Options(t *testing.T) {
+	var gotUA string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.UserAgent()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(
+		WithBaseURL(srv.URL),
+		WithUserAgent("syncwich-test/1.0"),
+		WithRateLimit(RateLimit{}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	if _, err := client.GetDataBrowser(time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("GetDataBrowser: %v", err)
+	}
+	if gotUA != "syncwich-test/1.0" {
+		t.Errorf("User-Agent = %q, want %q", gotUA, "syncwich-test/1.0")
+	}
+}
+
+func TestNewClient_WithTransport(t *testing.T) {
+	var gotURL string
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		gotURL = r.URL.String()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    r,
+		}, nil
+	})
+
+	client, err := NewClient(
+		WithBaseURL("https://runalyze.example"),
+		WithHTTPClient(&http.Client{Timeout: time.Second}),
+		WithTransport(rt),
+		WithRateLimit(RateLimit{}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	if _, err := client.GetActivityPage("42"); err != nil {
+		t.Fatalf("GetActivityPage: %v", err)
+	}
+	if want := "https://runalyze.example/activity/42"; gotURL != want {
+		t.Errorf("request URL = %q, want %q", gotURL, want)
+	}
+}
+
+func TestNewClient_InvalidBaseURL(t *testing.T) {
+	if _, err := NewClient(WithBaseURL("not a url")); err == nil {
+		t.Fatal("expected error for invalid base URL")
+	}
+}
+
+// Without a cookie store the session lives in memory only; persisting is a no-op.
+func TestNewClient_NoCookieStore(t *testing.T) {
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := client.PersistCookies(); err != nil {
+		t.Fatalf("PersistCookies without store: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package runalyze
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit configures the token bucket every client request passes
+// through: databrowser pages, exports, activity pages and login alike.
+type RateLimit struct {
+	RequestsPerSecond float64       // sustained rate; <= 0 disables limiting
+	Burst             int           // requests allowed back-to-back after an idle period
+	Cooldown          time.Duration // pause after a 429/502; doubles while the server keeps throttling
+}
+
+// DefaultRateLimit roughly matches the fixed 300ms pause syncwich used to
+// sleep between exports, but now also covers every other request type.
+var DefaultRateLimit = RateLimit{
+	RequestsPerSecond: 3,
+	Burst:             1,
+	Cooldown:          10 * time.Second,
+}
+
+// maxCooldown caps how far repeated throttling can stretch the cooling period.
+const maxCooldown = 5 * time.Minute
+
+// rateLimiter is a token bucket with a cooling period. When the server starts
+// answering 429 or 502 the limiter stops handing out tokens until the cooling
+// period has passed, so large backfills back off without a fixed delay.
+// A nil *rateLimiter never blocks.
+type rateLimiter struct {
+	mu           sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time // when tokens was last refilled
+	baseCooldown time.Duration
+	cooldown     time.Duration // next cooling period length
+	coolUntil    time.Time
+}
+
+// newRateLimiter returns a limiter for cfg, or nil if cfg disables limiting.
+func newRateLimiter(cfg RateLimit) *rateLimiter {
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:         cfg.RequestsPerSecond,
+		burst:        burst,
+		tokens:       burst,
+		last:         time.Now(),
+		baseCooldown: cfg.Cooldown,
+		cooldown:     cfg.Cooldown,
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		if now.Before(l.coolUntil) {
+			wait = l.coolUntil.Sub(now)
+		} else {
+			l.refill(now)
+			if l.tokens >= 1 {
+				l.tokens--
+				l.mu.Unlock()
+				return nil
+			}
+			wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// refill adds the tokens accrued since the last refill. Must hold l.mu.
+func (l *rateLimiter) refill(now time.Time) {
+	if !now.After(l.last) {
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// Throttle starts a cooling period after the server signalled overload. The
+// period is the longer of retryAfter and the current cooldown, which doubles
+// on every consecutive throttle until Recover is called.
+func (l *rateLimiter) Throttle(retryAfter time.Duration) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pause := l.cooldown
+	if retryAfter > pause {
+		pause = retryAfter
+	}
+	if until := time.Now().Add(pause); until.After(l.coolUntil) {
+		l.coolUntil = until
+	}
+	// Start the bucket empty once the cooling period ends.
+	l.tokens = 0
+	l.last = l.coolUntil
+
+	l.cooldown *= 2
+	if l.cooldown > maxCooldown {
+		l.cooldown = maxCooldown
+	}
+	return pause
+}
+
+// Recover resets the cooldown escalation after a normal response.
+func (l *rateLimiter) Recover() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.cooldown = l.baseCooldown
+	l.mu.Unlock()
+}
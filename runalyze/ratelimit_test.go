@@ -0,0 +1,103 @@
+package runalyze
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_NilNeverBlocks(t *testing.T) {
+	if newRateLimiter(RateLimit{RequestsPerSecond: 0}) != nil {
+		t.Fatal("expected nil limiter when RequestsPerSecond <= 0")
+	}
+	var l *rateLimiter
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("nil limiter Wait: %v", err)
+	}
+	l.Throttle(time.Hour)
+	l.Recover()
+}
+
+func TestRateLimiter_SpacesRequestsAfterBurst(t *testing.T) {
+	l := newRateLimiter(RateLimit{RequestsPerSecond: 50, Burst: 2})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 burst tokens are free, the remaining 3 need 20ms each.
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("5 requests at 50/s with burst 2 took %v, want >= ~60ms", elapsed)
+	}
+}
+
+func TestRateLimiter_ThrottleCoolsDownAndEscalates(t *testing.T) {
+	l := newRateLimiter(RateLimit{RequestsPerSecond: 1000, Burst: 10, Cooldown: 30 * time.Millisecond})
+
+	if got := l.Throttle(0); got != 30*time.Millisecond {
+		t.Errorf("first pause = %v, want 30ms", got)
+	}
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("Wait returned after %v, want it to honour the cooling period", elapsed)
+	}
+
+	if got := l.Throttle(0); got != 60*time.Millisecond {
+		t.Errorf("consecutive pause = %v, want 60ms", got)
+	}
+	if got := l.Throttle(time.Second); got != time.Second {
+		t.Errorf("Retry-After should win when longer, got %v", got)
+	}
+
+	l.Recover()
+	if got := l.Throttle(0); got != 30*time.Millisecond {
+		t.Errorf("pause after Recover = %v, want 30ms", got)
+	}
+}
+
+func TestRateLimiter_WaitHonoursContext(t *testing.T) {
+	l := newRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 1, Cooldown: time.Hour})
+	l.Throttle(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestDoRequest_BadGatewayPausesLimiter asserts the client feeds 502s into the
+// shared limiter, so the next request of any type waits out the cooldown.
+func TestDoRequest_BadGatewayPausesLimiter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL)
+	client.retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	client.limiter = newRateLimiter(RateLimit{RequestsPerSecond: 1000, Burst: 10, Cooldown: 100 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := client.GetDataBrowser(time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("GetDataBrowser: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("retry after 502 went out after %v, want the 100ms cooldown to apply", elapsed)
+	}
+}
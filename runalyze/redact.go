@@ -0,0 +1,142 @@
+package runalyze
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces secrets in trace logs
+const redactedValue = "[REDACTED]"
+
+// sensitiveHeaders carry session cookies or credentials
+var sensitiveHeaders = map[string]bool{
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Csrf-Token":        true,
+}
+
+// sensitiveFormFields are login form fields whose values are secret
+var sensitiveFormFields = map[string]bool{
+	"_password":   true,
+	"password":    true,
+	"_csrf_token": true,
+}
+
+// csrfInputRe matches the hidden CSRF input on the login page
+var csrfInputRe = regexp.MustCompile(`(name="_csrf_token" value=")[^"]*(")`)
+
+// multipartFieldRe matches a multipart/form-data field: its name and the
+// value after the part headers
+var multipartFieldRe = regexp.MustCompile(`(name="([^"]+)"\r\n(?:[^\r\n]+\r\n)*\r\n)([^\r\n]*)`)
+
+// redactor masks passwords, CSRF tokens, cookie values and auth headers in
+// what the client logs at LevelTrace. The zero value redacts; unsafe turns
+// it into a no-op for debugging (see WithUnsafeTrace).
+type redactor struct {
+	unsafe bool
+}
+
+// header returns a copy of h with sensitive values masked. Cookie names and
+// Set-Cookie attributes are kept, since they are useful when debugging
+// sessions.
+func (r redactor) header(h http.Header) http.Header {
+	if r.unsafe {
+		return h
+	}
+	out := h.Clone()
+	for name, values := range out {
+		if !sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		masked := make([]string, len(values))
+		for i, v := range values {
+			switch http.CanonicalHeaderKey(name) {
+			case "Cookie":
+				masked[i] = redactCookieHeader(v)
+			case "Set-Cookie":
+				masked[i] = redactSetCookie(v)
+			case "Authorization", "Proxy-Authorization":
+				masked[i] = redactAuthorization(v)
+			default:
+				masked[i] = redactedValue
+			}
+		}
+		out[name] = masked
+	}
+	return out
+}
+
+// body returns body as a string with secret form fields and the login
+// page's CSRF token masked
+func (r redactor) body(contentType string, body []byte) string {
+	if r.unsafe {
+		return string(body)
+	}
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		return string(redactMultipart(body))
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for name := range form {
+				if sensitiveFormFields[name] {
+					form[name] = []string{redactedValue}
+				}
+			}
+			return form.Encode()
+		}
+	}
+	return csrfInputRe.ReplaceAllString(string(body), "${1}"+redactedValue+"${2}")
+}
+
+// redactMultipart masks the secret fields of a multipart/form-data body,
+// such as the CSRF token of the upload form. File contents are kept.
+func redactMultipart(body []byte) []byte {
+	return multipartFieldRe.ReplaceAllFunc(body, func(field []byte) []byte {
+		m := multipartFieldRe.FindSubmatch(field)
+		if !sensitiveFormFields[string(m[2])] {
+			return field
+		}
+		return append(append([]byte{}, m[1]...), redactedValue...)
+	})
+}
+
+// cookie returns the cookie value to log
+func (r redactor) cookie(value string) string {
+	if r.unsafe {
+		return value
+	}
+	return redactedValue
+}
+
+// redactCookieHeader masks every value in a "a=1; b=2" Cookie header
+func redactCookieHeader(v string) string {
+	parts := strings.Split(v, ";")
+	for i, part := range parts {
+		name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+		parts[i] = name + "=" + redactedValue
+	}
+	return strings.Join(parts, "; ")
+}
+
+// redactSetCookie masks the value of a Set-Cookie header, keeping attributes
+func redactSetCookie(v string) string {
+	pair, attrs, hasAttrs := strings.Cut(v, ";")
+	name, _, _ := strings.Cut(strings.TrimSpace(pair), "=")
+	out := name + "=" + redactedValue
+	if hasAttrs {
+		out += ";" + attrs
+	}
+	return out
+}
+
+// redactAuthorization keeps the scheme ("Basic", "Bearer") and masks the credentials
+func redactAuthorization(v string) string {
+	if scheme, _, ok := strings.Cut(v, " "); ok {
+		return scheme + " " + redactedValue
+	}
+	return redactedValue
+}
@@ -0,0 +1,125 @@
+package runalyze
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newLoginServer serves a minimal login flow that sets a session cookie
+func newLoginServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "session-secret", Path: "/"})
+			_, _ = w.Write([]byte(`<form><input type="hidden" name="_csrf_token" value="csrf-secret"></form>`))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "REMEMBERME", Value: "remember-secret", Path: "/", HttpOnly: true})
+		w.Header().Set("Location", "/dashboard")
+		w.WriteHeader(http.StatusFound)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// loginWithTrace logs in against srv and returns everything logged at trace level
+func loginWithTrace(t *testing.T, srv *httptest.Server, opts ...Option) string {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace}))
+
+	opts = append([]Option{
+		WithBaseURL(srv.URL),
+		WithCredentials("runner", "hunter2-password"),
+		WithCookieStore(NewMemoryCookieStore()),
+		WithSlogLogger(logger),
+		WithRateLimit(RateLimit{}),
+	}, opts...)
+	client, err := NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := client.PersistCookies(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+var traceSecrets = []string{"hunter2-password", "csrf-secret", "session-secret", "remember-secret"}
+
+func TestTraceLogging_RedactsSecrets(t *testing.T) {
+	logs := loginWithTrace(t, newLoginServer(t))
+
+	for _, secret := range traceSecrets {
+		if strings.Contains(logs, secret) {
+			t.Errorf("trace log leaks %q:\n%s", secret, logs)
+		}
+	}
+	// Still useful for debugging: the cookie names and form fields are there
+	for _, want := range []string{"REMEMBERME=" + redactedValue, "_password=%5BREDACTED%5D", "_username=runner"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("trace log missing %q", want)
+		}
+	}
+}
+
+func TestTraceLogging_UnsafeTrace(t *testing.T) {
+	logs := loginWithTrace(t, newLoginServer(t), WithUnsafeTrace(true))
+
+	for _, secret := range traceSecrets {
+		if !strings.Contains(logs, secret) {
+			t.Errorf("unsafe trace log should contain %q", secret)
+		}
+	}
+}
+
+func TestRedactor_Header(t *testing.T) {
+	h := http.Header{
+		"Cookie":        {"PHPSESSID=abc; REMEMBERME=def"},
+		"Set-Cookie":    {"REMEMBERME=def; Path=/; HttpOnly"},
+		"Authorization": {"Bearer token123"},
+		"Accept":        {"text/html"},
+	}
+
+	got := redactor{}.header(h)
+
+	if v := got.Get("Cookie"); v != "PHPSESSID=[REDACTED]; REMEMBERME=[REDACTED]" {
+		t.Errorf("Cookie = %q", v)
+	}
+	if v := got.Get("Set-Cookie"); v != "REMEMBERME=[REDACTED]; Path=/; HttpOnly" {
+		t.Errorf("Set-Cookie = %q", v)
+	}
+	if v := got.Get("Authorization"); v != "Bearer [REDACTED]" {
+		t.Errorf("Authorization = %q", v)
+	}
+	if v := got.Get("Accept"); v != "text/html" {
+		t.Errorf("Accept = %q, want it untouched", v)
+	}
+	if h.Get("Cookie") != "PHPSESSID=abc; REMEMBERME=def" {
+		t.Error("header() modified its input")
+	}
+}
+
+func TestRedactMultipart(t *testing.T) {
+	body := "--b\r\nContent-Disposition: form-data; name=\"_csrf_token\"\r\n\r\ncsrf-secret\r\n" +
+		"--b\r\nContent-Disposition: form-data; name=\"activity_file\"; filename=\"run.fit\"\r\nContent-Type: application/octet-stream\r\n\r\nFITDATA\r\n--b--\r\n"
+
+	got := string(redactMultipart([]byte(body)))
+
+	if strings.Contains(got, "csrf-secret") {
+		t.Errorf("CSRF token not redacted:\n%s", got)
+	}
+	if !strings.Contains(got, "name=\"_csrf_token\"\r\n\r\n"+redactedValue+"\r\n") {
+		t.Errorf("CSRF field lost its structure:\n%s", got)
+	}
+	if !strings.Contains(got, "FITDATA") {
+		t.Errorf("file content was changed:\n%s", got)
+	}
+}
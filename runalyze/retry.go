@@ -0,0 +1,131 @@
+package runalyze
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how the client retries transient failures: 429, 502
+// and 503 responses (the WAF answers 502 when it is unhappy) and connection
+// resets. Delays grow exponentially from BaseDelay up to MaxDelay, with
+// jitter so parallel clients don't retry in lockstep.
+type RetryPolicy struct {
+	MaxAttempts int // total attempts including the first; <= 1 disables retries
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used by New.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// backoff returns how long to wait before the attempt following the given
+// (1-based) attempt. A server-provided Retry-After wins if it is longer.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// Equal jitter: keep half the delay, randomize the other half.
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int64N(half+1))
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// isRetryableStatus reports whether a response status is worth retrying.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// isUnprocessedStatus reports whether a response says the server didn't
+// act on the request, so even a request that changes something can be sent
+// again: a 429, or a 503 with Retry-After
+func isUnprocessedStatus(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// isRetryableError reports whether a transport error looks like a dropped or
+// reset connection rather than something retrying can't fix.
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsTransient reports whether err is the kind of failure that may succeed if
+// tried again later: a retryable status code or a network reset. Errors for
+// which this returns false (404, bad credentials, parse failures) are
+// permanent.
+func IsTransient(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return isRetryableStatus(se.StatusCode)
+	}
+	return isRetryableError(err)
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// RequestStats collects metrics about the HTTP requests made on behalf of a
+// context. Attach one with WithRequestStats to learn how many attempts a
+// call needed, including retries.
+type RequestStats struct {
+	Attempts int
+}
+
+type requestStatsKey struct{}
+
+// WithRequestStats returns a copy of ctx that makes the client record into
+// stats. Not safe for concurrent use: give each goroutine its own stats.
+func WithRequestStats(ctx context.Context, stats *RequestStats) context.Context {
+	return context.WithValue(ctx, requestStatsKey{}, stats)
+}
+
+// RequestStatsFromContext returns the stats attached with WithRequestStats,
+// or nil.
+func RequestStatsFromContext(ctx context.Context) *RequestStats {
+	stats, _ := ctx.Value(requestStatsKey{}).(*RequestStats)
+	return stats
+}
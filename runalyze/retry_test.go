@@ -0,0 +1,203 @@
+package runalyze
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetries keeps retry tests quick while still exercising the backoff path.
+var fastRetries = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// newRetryTestClient points a test client at handler with fast retries.
+func newRetryTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c := newTestClient(t, srv.URL)
+	c.retry = fastRetries
+	c.limiter = nil // cooling periods are covered in ratelimit_test.go
+	return c
+}
+
+func TestDoRequest_RetriesWAFBadGateway(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("content-disposition", `attachment; filename="1.fit"`)
+		_, _ = w.Write([]byte("fit"))
+	})
+
+	var stats RequestStats
+	ctx := WithRequestStats(context.Background(), &stats)
+	data, _, err := client.GetFitContext(ctx, "1")
+	if err != nil {
+		t.Fatalf("expected success after retry, got: %v", err)
+	}
+	if string(data) != "fit" {
+		t.Errorf("data = %q, want %q", data, "fit")
+	}
+	if stats.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", stats.Attempts)
+	}
+}
+
+func TestDoRequest_NotFoundIsTypedAndNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	})
+
+	_, _, err := client.GetFit("1")
+
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *StatusError, got %T: %v", err, err)
+	}
+	if se.StatusCode != http.StatusNotFound {
+		t.Errorf("StatusCode = %d, want 404", se.StatusCode)
+	}
+	if se.URL == "" || se.Body == "" {
+		t.Errorf("expected URL and body snippet, got %+v", se)
+	}
+	if !IsNotFound(err) || IsTransient(err) {
+		t.Errorf("IsNotFound = %v, IsTransient = %v; want true, false", IsNotFound(err), IsTransient(err))
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1 (404 must not be retried)", n)
+	}
+}
+
+func TestDoRequest_GivesUpWithTransientStatusError(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := client.GetDataBrowser(time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC))
+
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 StatusError, got: %v", err)
+	}
+	if !IsTransient(err) {
+		t.Error("expected 429 to be transient")
+	}
+	if n := int(calls.Load()); n != fastRetries.MaxAttempts {
+		t.Errorf("server saw %d requests, want %d", n, fastRetries.MaxAttempts)
+	}
+}
+
+func TestDoRequest_RetriesConnectionReset(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// Drop the connection without a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		_, _ = w.Write([]byte("<html></html>"))
+	})
+
+	if _, err := client.GetDataBrowser(time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("expected success after reset, got: %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("server saw %d requests, want 2", n)
+	}
+}
+
+func TestDoUnsafeRequest_OnlyRetriesUnprocessed(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      func(w http.ResponseWriter)
+		wantCalls int32
+	}{
+		{"429", func(w http.ResponseWriter) { w.WriteHeader(http.StatusTooManyRequests) }, 2},
+		{"503 with Retry-After", func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, 2},
+		{"503", func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) }, 1},
+		{"WAF 502", func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) }, 1},
+		{"connection reset", func(w http.ResponseWriter) {
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := newRetryTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					tt.fail(w)
+					return
+				}
+				_, _ = w.Write([]byte("saved"))
+			})
+
+			req, err := http.NewRequest("POST", client.baseURL+"/activity/1/edit", strings.NewReader("title=x"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _, _ := client.doUnsafeRequest(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("server saw %d requests, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_BackoffBounds(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt <= 8; attempt++ {
+		d := p.backoff(attempt, 0)
+		if d < p.BaseDelay/2 || d > p.MaxDelay {
+			t.Errorf("attempt %d: backoff %v outside [%v, %v]", attempt, d, p.BaseDelay/2, p.MaxDelay)
+		}
+	}
+	if d := p.backoff(1, 5*time.Second); d != 5*time.Second {
+		t.Errorf("Retry-After should win when longer, got %v", d)
+	}
+}
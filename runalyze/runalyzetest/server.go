@@ -0,0 +1,922 @@
+// Package runalyzetest provides an in-process fake of the Runalyze endpoints
+// syncwich uses, for integration tests of the runalyze client and the sw
+// services.
+//
+//	srv := runalyzetest.NewServer(t)
+//	srv.AddActivity(runalyzetest.Activity{ID: "1", Date: day, Sport: "Running"})
+//	client, _ := runalyze.NewClient(
+//		runalyze.WithBaseURL(srv.URL),
+//		runalyze.WithCredentials(srv.Username, srv.Password),
+//	)
+package runalyzetest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Default credentials accepted by the server
+const (
+	DefaultUsername = "runner"
+	DefaultPassword = "secret"
+)
+
+// SessionCookie is the cookie holding the login session
+const SessionCookie = "PHPSESSID"
+
+// RememberMeCookie is set on login with "remember me", valid for
+// RememberMeLifetime
+const (
+	RememberMeCookie   = "REMEMBERME"
+	RememberMeLifetime = 365 * 24 * time.Hour
+)
+
+// Activity is an activity the server lists in the databrowser and serves
+// exports for.
+type Activity struct {
+	ID         string
+	Date       time.Time
+	Sport      string  // icons8 icon name, e.g. "Running" or "Cycling"
+	DistanceKm float64 // 0 means no distance column
+	Duration   time.Duration
+
+	// Shown on the activity page only
+	Title        string
+	Notes        string
+	TrainingType string
+	Equipment    []string
+	Public       bool
+
+	// Exports maps export formats to file contents. When nil, every
+	// format in runalyze.ExportFormats is served with generated content.
+	Exports map[string][]byte
+}
+
+// HealthNote is the body data the server shows for a day under
+// /health/note/YYYY-MM-DD. Days without a note get an empty form.
+type HealthNote struct {
+	Date             time.Time
+	RestingHeartRate int
+	WeightKg         float64
+	SleepMinutes     int
+	HRV              float64
+	Notes            string
+}
+
+// Equipment is a piece of gear the server lists under /my/equipment
+type Equipment struct {
+	ID         string
+	Name       string
+	Category   string // e.g. "Shoes" or "Bikes"
+	DistanceKm float64
+	Duration   time.Duration
+	Since      time.Time
+	RetiredAt  time.Time // zero while in use
+}
+
+// allFormats mirrors runalyze.ExportFormats; runalyzetest doesn't import
+// runalyze so the runalyze package's own tests can use it.
+var allFormats = []string{"fit-original", "tcx", "gpx", "csv", "kml", "fitlog"}
+
+// Server is a fake Runalyze. All methods are safe to call while the
+// client is running.
+type Server struct {
+	*httptest.Server
+
+	// Credentials accepted by POST /login
+	Username string
+	Password string
+
+	// Shown on /settings/account
+	AccountName string
+	Email       string
+
+	mu            sync.Mutex
+	csrfToken     string
+	activities    map[string]Activity
+	healthNotes   map[string]HealthNote
+	equipment     []Equipment
+	uploads       []string
+	nextUploadID  int
+	sessions      map[string]bool
+	expireAfter   int // authenticated requests left before sessions expire; <0 disables
+	missing       map[string]bool
+	badGateways   int
+	latency       time.Duration
+	logins        int
+	requests      []string
+	exportsServed map[string]int
+	inFlight      int // export requests being handled
+	peakInFlight  int
+	onExport      func(activityID, format string)
+}
+
+var (
+	exportPathRe   = regexp.MustCompile(`^/activity/(\d+)/export/file/([a-z-]+)$`)
+	healthNoteRe   = regexp.MustCompile(`^/health/note/(\d{4}-\d{2}-\d{2})$`)
+	activityPathRe = regexp.MustCompile(`^/activity/(\d+)$`)
+	editPathRe     = regexp.MustCompile(`^/activity/(\d+)/edit$`)
+)
+
+// NewServer starts a fake Runalyze that accepts DefaultUsername and
+// DefaultPassword. It is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Username:      DefaultUsername,
+		Password:      DefaultPassword,
+		AccountName:   "Test Runner",
+		Email:         "runner@example.com",
+		csrfToken:     randomToken(),
+		activities:    make(map[string]Activity),
+		healthNotes:   make(map[string]HealthNote),
+		sessions:      make(map[string]bool),
+		expireAfter:   -1,
+		nextUploadID:  900001,
+		missing:       make(map[string]bool),
+		exportsServed: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddActivity adds or replaces an activity.
+func (s *Server) AddActivity(a Activity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activities[a.ID] = a
+}
+
+// DeleteActivity removes an activity, as if it was deleted in Runalyze.
+func (s *Server) DeleteActivity(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.activities, id)
+}
+
+// Activity returns the activity with id as it currently is, including
+// edits made through the edit form.
+func (s *Server) Activity(id string) (Activity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.activities[id]
+	return a, ok
+}
+
+// AddHealthNote adds or replaces the health note of a day.
+func (s *Server) AddHealthNote(n HealthNote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthNotes[n.Date.Format("2006-01-02")] = n
+}
+
+// AddEquipment adds a piece of gear to the equipment overview.
+func (s *Server) AddEquipment(e Equipment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.equipment = append(s.equipment, e)
+}
+
+// Uploads returns the filenames of all uploaded files, in order,
+// including duplicates and rejected files.
+func (s *Server) Uploads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.uploads...)
+}
+
+// MissingFormat makes exports in format answer 404 for every activity,
+// like FIT for activities that were entered by hand.
+func (s *Server) MissingFormat(format string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missing[format] = true
+}
+
+// BadGateway makes the next n requests fail with 502, the way the Runalyze
+// WAF does when it throttles.
+func (s *Server) BadGateway(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.badGateways = n
+}
+
+// Latency delays every response by d, or until the request is cancelled.
+func (s *Server) Latency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// ExpireSessions logs out every client.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]bool)
+}
+
+// ExpireSessionsAfter logs out every client once n more authenticated
+// requests have been served, to simulate a session expiring mid-run.
+func (s *Server) ExpireSessionsAfter(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireAfter = n
+}
+
+// Logins returns the number of successful logins.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// PeakExportsInFlight returns the most export requests the server handled
+// at once, counting the time spent in Latency.
+func (s *Server) PeakExportsInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peakInFlight
+}
+
+// OnExport makes the server call f whenever an export is requested, before
+// it responds, so a test can act at a known point of a download, e.g.
+// cancel it. f is called from the handler goroutines.
+func (s *Server) OnExport(f func(activityID, format string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExport = f
+}
+
+// Requests returns every request served so far as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// ExportsServed returns how often the export of activityID in format was
+// served successfully.
+func (s *Server) ExportsServed(activityID, format string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exportsServed[activityID+"/"+format]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	latency := s.latency
+	failWAF := s.badGateways > 0
+	if failWAF {
+		s.badGateways--
+	}
+	if exportPathRe.MatchString(r.URL.Path) {
+		s.inFlight++
+		s.peakInFlight = max(s.peakInFlight, s.inFlight)
+		defer func() {
+			s.mu.Lock()
+			s.inFlight--
+			s.mu.Unlock()
+		}()
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failWAF {
+		http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/login" && r.Method == http.MethodGet:
+		s.serveLoginPage(w)
+	case r.URL.Path == "/login" && r.Method == http.MethodPost:
+		s.serveLogin(w, r)
+	case r.URL.Path == "/logout":
+		s.serveLogout(w, r)
+	case r.URL.Path == "/settings/account":
+		if s.authenticate(w, r) {
+			s.serveAccount(w)
+		}
+	case r.URL.Path == "/databrowser":
+		if s.authenticate(w, r) {
+			s.serveDataBrowser(w, r)
+		}
+	case activityPathRe.MatchString(r.URL.Path):
+		if s.authenticate(w, r) {
+			s.serveActivity(w, activityPathRe.FindStringSubmatch(r.URL.Path)[1])
+		}
+	case editPathRe.MatchString(r.URL.Path) && r.Method == http.MethodGet:
+		if s.authenticate(w, r) {
+			s.serveEditPage(w, editPathRe.FindStringSubmatch(r.URL.Path)[1], "", "")
+		}
+	case editPathRe.MatchString(r.URL.Path) && r.Method == http.MethodPost:
+		if s.authenticate(w, r) {
+			s.serveEdit(w, r, editPathRe.FindStringSubmatch(r.URL.Path)[1])
+		}
+	case r.URL.Path == "/activity/upload" && r.Method == http.MethodGet:
+		if s.authenticate(w, r) {
+			s.serveUploadPage(w)
+		}
+	case r.URL.Path == "/activity/upload" && r.Method == http.MethodPost:
+		if s.authenticate(w, r) {
+			s.serveUpload(w, r)
+		}
+	case r.URL.Path == "/my/equipment":
+		if s.authenticate(w, r) {
+			s.serveEquipment(w)
+		}
+	case healthNoteRe.MatchString(r.URL.Path):
+		if s.authenticate(w, r) {
+			s.serveHealthNote(w, healthNoteRe.FindStringSubmatch(r.URL.Path)[1])
+		}
+	case exportPathRe.MatchString(r.URL.Path):
+		if s.authenticate(w, r) {
+			m := exportPathRe.FindStringSubmatch(r.URL.Path)
+			s.serveExport(w, m[1], m[2])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveLoginPage(w http.ResponseWriter) {
+	s.mu.Lock()
+	token := s.csrfToken
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><body>
+<form method="post" action="/login">
+<input type="text" name="_username">
+<input type="password" name="_password">
+<input type="hidden" name="_csrf_token" value="%s">
+</form>
+</body></html>`, token)
+}
+
+// serveLogin redirects to the dashboard on success and back to the login
+// page on failure, like Runalyze does
+func (s *Server) serveLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	ok := r.PostForm.Get("_csrf_token") == s.csrfToken &&
+		r.PostForm.Get("_username") == s.Username &&
+		r.PostForm.Get("_password") == s.Password
+	var session string
+	if ok {
+		session = randomToken()
+		s.sessions[session] = true
+		s.logins++
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Redirect(w, r, s.URL+"/login", http.StatusFound)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: session, Path: "/", HttpOnly: true})
+	if r.PostForm.Get("_remember_me") == "on" {
+		http.SetCookie(w, &http.Cookie{Name: RememberMeCookie, Value: randomToken(), Path: "/", HttpOnly: true, MaxAge: int(RememberMeLifetime.Seconds())})
+	}
+	http.Redirect(w, r, s.URL+"/dashboard", http.StatusFound)
+}
+
+// serveLogout ends the session and deletes the session cookies, then
+// redirects to the start page like Runalyze
+func (s *Server) serveLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, cookie.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Path: "/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: RememberMeCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, s.URL+"/", http.StatusFound)
+}
+
+// serveAccount renders the account settings form
+func (s *Server) serveAccount(w http.ResponseWriter) {
+	s.mu.Lock()
+	username, name, email := s.Username, s.AccountName, s.Email
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, `<form name="account" method="post">
+<input type="text" id="account_username" name="account[username]" value="%s" disabled>
+<input type="text" id="account_name" name="account[name]" value="%s">
+<input type="email" id="account_mail" name="account[mail]" value="%s">
+</form>
+`, html.EscapeString(username), html.EscapeString(name), html.EscapeString(email))
+}
+
+// authenticate redirects to /login unless the request carries a live
+// session, and counts down ExpireSessionsAfter
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	cookie, err := r.Cookie(SessionCookie)
+
+	s.mu.Lock()
+	ok := err == nil && s.sessions[cookie.Value]
+	if ok && s.expireAfter >= 0 {
+		if s.expireAfter == 0 {
+			s.sessions = make(map[string]bool)
+			ok = false
+		}
+		s.expireAfter--
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Redirect(w, r, s.URL+"/login", http.StatusFound)
+	}
+	return ok
+}
+
+// serveDataBrowser lists the activities between the start and end unix
+// timestamps, newest first like Runalyze
+func (s *Server) serveDataBrowser(w http.ResponseWriter, r *http.Request) {
+	start, err1 := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+	end, err2 := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "start and end are required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	var week []Activity
+	for _, a := range s.activities {
+		if ts := a.Date.Unix(); ts >= start && ts <= end {
+			week = append(week, a)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(week, func(i, j int) bool {
+		if !week[i].Date.Equal(week[j].Date) {
+			return week[i].Date.After(week[j].Date)
+		}
+		return week[i].ID > week[j].ID
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprint(w, dataBrowserHeader)
+	for _, a := range week {
+		fmt.Fprint(w, dataBrowserRow(s.URL, a))
+	}
+	fmt.Fprint(w, dataBrowserFooter)
+}
+
+const dataBrowserHeader = `<div class="data-browser">
+<table class="zebra-style w-full">
+<thead class="data-browser-labels">
+<tr class="text-xs bottom-separated">
+<td colspan="1"></td>
+<td></td>
+<td><span class="block relative min-w-4">&nbsp;<span class="block truncate absolute inset-0 text-right">Distance</span><span class="absolute inset-0 lg:tooltip lg:tooltip-bottom" data-tip="Distance"></span></span></td>
+<td><span class="block relative min-w-4">&nbsp;<span class="block truncate absolute inset-0 text-right">Duration</span><span class="absolute inset-0 lg:tooltip lg:tooltip-bottom" data-tip="Duration"></span></span></td>
+</tr>
+</thead>
+<tbody>
+`
+
+const dataBrowserFooter = `</tbody>
+</table>
+</div>
+`
+
+// dataBrowserRow renders a row in the shape of the real databrowser
+func dataBrowserRow(baseURL string, a Activity) string {
+	day := a.Date.Format("2006-01-02")
+	distance := ""
+	if a.DistanceKm > 0 {
+		distance = strings.Replace(strconv.FormatFloat(a.DistanceKm, 'f', 1, 64), ".", ",", 1) + "&nbsp;km"
+	}
+	duration := ""
+	if a.Duration > 0 {
+		duration = formatDuration(a.Duration)
+	}
+	return fmt.Sprintf(`<tr class="text-right  " data-load-target="#activity" data-load-url="%[1]s/activity/%[2]s" data-activity-id="%[2]s">
+<td class="text-left as-small-as-possible whitespace-nowrap">%[3]s&nbsp;<a class="inline-block mx-1 opacity-50" href="%[1]s/health/note/%[4]s" data-load-target="#modal"><i class="fa-solid fa-heart-pulse"></i></a>&nbsp;%[5]s</td>
+<td><i class="icons8-%[6]s"></i></td>
+<td>%[7]s</td>
+<td>%[8]s</td>
+</tr>
+`, baseURL, html.EscapeString(a.ID), a.Date.Format("02.01"), day, a.Date.Format("Mon"), html.EscapeString(a.Sport), distance, duration)
+}
+
+// formatDuration renders d as Runalyze does: "38:45" or "1:02:03"
+func formatDuration(d time.Duration) string {
+	total := int(d.Round(time.Second).Seconds())
+	h, m, sec := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
+
+// serveUploadPage renders the upload form
+func (s *Server) serveUploadPage(w http.ResponseWriter) {
+	s.mu.Lock()
+	token := s.csrfToken
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, `<form method="post" action="/activity/upload" enctype="multipart/form-data">
+<input type="file" name="activity_file">
+<input type="hidden" name="_csrf_token" value="%s">
+</form>
+`, token)
+}
+
+// serveUpload imports an uploaded file as a new activity, redirecting to
+// it. Files that match an existing activity's FIT export are duplicates;
+// empty files and files starting with "invalid" are rejected.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	token := s.csrfToken
+	s.mu.Unlock()
+	if r.FormValue("_csrf_token") != token {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+	file, header, err := r.FormFile("activity_file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads = append(s.uploads, header.Filename)
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if len(data) == 0 || bytes.HasPrefix(data, []byte("invalid")) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, `<div class="alert alert-danger">%s could not be imported: unknown file format</div>`, html.EscapeString(header.Filename))
+		return
+	}
+	for id, a := range s.activities {
+		existing := ExportContent(id, "fit-original")
+		if a.Exports != nil {
+			existing = a.Exports["fit-original"]
+		}
+		if bytes.Equal(existing, data) {
+			fmt.Fprintf(w, `<div class="alert alert-warning">This activity seems to be a duplicate of activity %s</div>`, id)
+			return
+		}
+	}
+
+	id := strconv.Itoa(s.nextUploadID)
+	s.nextUploadID++
+	s.activities[id] = Activity{ID: id, Date: time.Now(), Sport: "Running", Exports: map[string][]byte{"fit-original": data}}
+	http.Redirect(w, r, "/activity/"+id, http.StatusFound)
+}
+
+// serveEquipment renders the equipment overview, a table per category
+func (s *Server) serveEquipment(w http.ResponseWriter) {
+	s.mu.Lock()
+	equipment := append([]Equipment(nil), s.equipment...)
+	s.mu.Unlock()
+
+	var categories []string
+	byCategory := make(map[string][]Equipment)
+	for _, e := range equipment {
+		if _, ok := byCategory[e.Category]; !ok {
+			categories = append(categories, e.Category)
+		}
+		byCategory[e.Category] = append(byCategory[e.Category], e)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	for _, category := range categories {
+		fmt.Fprintf(w, `<div class="equipment-category">
+<h2>%s</h2>
+<table>
+<thead><tr><th>Name</th><th>Distance</th><th>Time</th><th>Since</th><th>Retired</th></tr></thead>
+<tbody>
+`, html.EscapeString(category))
+		for _, e := range byCategory[category] {
+			retired := ""
+			if !e.RetiredAt.IsZero() {
+				retired = e.RetiredAt.Format("02.01.2006")
+			}
+			fmt.Fprintf(w, "<tr data-equipment-id=\"%[1]s\"><td><a href=\"/my/equipment/%[1]s\">%[2]s</a></td><td>%[3]s&nbsp;km</td><td>%[4]s</td><td>%[5]s</td><td>%[6]s</td></tr>\n",
+				html.EscapeString(e.ID), html.EscapeString(e.Name), strings.Replace(strconv.FormatFloat(e.DistanceKm, 'f', 1, 64), ".", ",", 1),
+				formatDuration(e.Duration), e.Since.Format("02.01.2006"), retired)
+		}
+		fmt.Fprint(w, "</tbody>\n</table>\n</div>\n")
+	}
+}
+
+// serveHealthNote renders the health note form of a day
+func (s *Server) serveHealthNote(w http.ResponseWriter, day string) {
+	s.mu.Lock()
+	note, ok := s.healthNotes[day]
+	s.mu.Unlock()
+
+	value := func(v string) string {
+		if !ok || v == "0" {
+			return ""
+		}
+		return v
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, `<form class="health-note" method="post" action="/health/note/%[1]s">
+<input type="number" name="health_note[pulse_rest]" value="%[2]s">
+<input type="number" step="0.1" name="health_note[weight]" value="%[3]s">
+<input type="number" name="health_note[sleep_duration]" value="%[4]s">
+<input type="number" name="health_note[hrv]" value="%[5]s">
+<textarea name="health_note[notes]">%[6]s</textarea>
+</form>
+`, day, value(strconv.Itoa(note.RestingHeartRate)), value(strconv.FormatFloat(note.WeightKg, 'f', -1, 64)),
+		value(strconv.Itoa(note.SleepMinutes)), value(strconv.FormatFloat(note.HRV, 'f', -1, 64)), html.EscapeString(note.Notes))
+}
+
+// serveActivity renders the activity page: title, boxed values, details
+// table, notes and the export submenu
+func (s *Server) serveActivity(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	a, ok := s.activities[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "activity not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, "<div class=\"panel-heading\">\n<h1>%s</h1>\n<span class=\"activity-date\">%s</span>\n",
+		html.EscapeString(a.Title), a.Date.Format("02.01.2006 15:04"))
+	fmt.Fprint(w, "<ul class=\"submenu\">\n")
+	for _, format := range allFormats {
+		if _, ok := s.export(a, format); ok {
+			fmt.Fprintf(w, "  <li><a href=\"/activity/%s/export/file/%s\">as %s</a></li>\n", id, format, strings.ToUpper(format))
+		}
+	}
+	fmt.Fprint(w, "</ul>\n</div>\n<div class=\"panel-content\">\n")
+
+	if a.DistanceKm > 0 {
+		fmt.Fprintf(w, boxedValue, strings.Replace(strconv.FormatFloat(a.DistanceKm, 'f', 2, 64), ".", ",", 1)+"&nbsp;km", "Distance")
+	}
+	if a.Duration > 0 {
+		fmt.Fprintf(w, boxedValue, formatDuration(a.Duration), "Duration")
+	}
+
+	fmt.Fprintf(w, "<table class=\"activity-details\">\n<tr><th>Sport</th><td><i class=\"icons8-%s\"></i> %s</td></tr>\n",
+		html.EscapeString(a.Sport), html.EscapeString(a.Sport))
+	if a.TrainingType != "" {
+		fmt.Fprintf(w, "<tr><th>Type</th><td>%s</td></tr>\n", html.EscapeString(a.TrainingType))
+	}
+	if len(a.Equipment) > 0 {
+		fmt.Fprint(w, "<tr><th>Equipment</th><td>")
+		for i, name := range a.Equipment {
+			fmt.Fprintf(w, "<a href=\"/my/equipment/%d\">%s</a> ", i+1, html.EscapeString(name))
+		}
+		fmt.Fprint(w, "</td></tr>\n")
+	}
+	fmt.Fprint(w, "</table>\n")
+
+	if a.Notes != "" {
+		fmt.Fprintf(w, "<div class=\"activity-notes\">%s</div>\n", html.EscapeString(a.Notes))
+	}
+	fmt.Fprintf(w, "<p class=\"small\">Created: %s</p>\n</div>\n", a.Date.Format("02.01.2006 15:04"))
+}
+
+// editSports and editTrainingTypes are the options of the edit form. Their
+// values are their index + 1, like Runalyze's database IDs.
+var (
+	editSports        = []string{"Running", "Cycling", "Swimming", "Hiking"}
+	editTrainingTypes = []string{"Easy run", "Long run", "Interval", "Race"}
+)
+
+// serveEditPage renders the edit form of an activity, with an error alert
+// if problem is set, or with an error under the field invalidField like
+// Runalyze's form theme
+func (s *Server) serveEditPage(w http.ResponseWriter, id, problem, invalidField string) {
+	s.mu.Lock()
+	a, ok := s.activities[id]
+	token := s.csrfToken
+	equipment := append([]Equipment(nil), s.equipment...)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "activity not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if problem != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "<div class=\"alert alert-danger\">%s</div>\n", html.EscapeString(problem))
+	}
+	fmt.Fprintf(w, "<form method=\"post\" action=\"/activity/%s/edit\">\n", id)
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"_csrf_token\" value=\"%s\">\n", token)
+	fmt.Fprintf(w, "<label for=\"activity_title\">Title</label><input type=\"text\" id=\"activity_title\" name=\"activity[title]\" value=\"%s\">\n", html.EscapeString(a.Title))
+	fmt.Fprintf(w, "<textarea name=\"activity[notes]\">%s</textarea>\n", html.EscapeString(a.Notes))
+	for _, sel := range []struct {
+		name, selected string
+		labels         []string
+	}{
+		{"activity[sport]", a.Sport, editSports},
+		{"activity[type]", a.TrainingType, append([]string{""}, editTrainingTypes...)},
+	} {
+		if sel.name != invalidField {
+			writeSelect(w, sel.name, sel.labels, sel.selected)
+			continue
+		}
+		fmt.Fprint(w, "<div class=\"form-group has-error\">\n")
+		writeSelect(w, sel.name, sel.labels, sel.selected)
+		fmt.Fprint(w, "<span class=\"help-block\"><ul class=\"list-unstyled\"><li><span class=\"glyphicon glyphicon-exclamation-sign\"></span> This value is not valid.</li></ul></span>\n</div>\n")
+	}
+	for _, e := range equipment {
+		checked := ""
+		for _, name := range a.Equipment {
+			if name == e.Name {
+				checked = " checked"
+			}
+		}
+		fmt.Fprintf(w, "<label><input type=\"checkbox\" name=\"activity[equipment][]\" value=\"%s\"%s> %s</label>\n", e.ID, checked, html.EscapeString(e.Name))
+	}
+	public := ""
+	if a.Public {
+		public = " checked"
+	}
+	fmt.Fprintf(w, "<label><input type=\"checkbox\" name=\"activity[is_public]\" value=\"1\"%s> Public</label>\n", public)
+	fmt.Fprint(w, "<button type=\"submit\">Save</button>\n</form>\n")
+}
+
+// writeSelect renders a select whose option values are the index + 1 of
+// labels (0 for an empty label)
+func writeSelect(w io.Writer, name string, labels []string, selected string) {
+	fmt.Fprintf(w, "<select name=\"%s\">\n", name)
+	offset := 1
+	if len(labels) > 0 && labels[0] == "" {
+		offset = 0
+	}
+	for i, label := range labels {
+		attr := ""
+		if label == selected {
+			attr = " selected"
+		}
+		fmt.Fprintf(w, "  <option value=\"%d\"%s>%s</option>\n", i+offset, attr, html.EscapeString(label))
+	}
+	fmt.Fprint(w, "</select>\n")
+}
+
+// serveEdit saves the posted edit form, redirecting to the activity. An
+// unknown sport or type shows the form again, with a 200 and an error
+// under the field.
+func (s *Server) serveEdit(w http.ResponseWriter, r *http.Request, id string) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	a, ok := s.activities[id]
+	token := s.csrfToken
+	equipment := append([]Equipment(nil), s.equipment...)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "activity not found", http.StatusNotFound)
+		return
+	}
+	if r.PostForm.Get("_csrf_token") != token {
+		s.serveEditPage(w, id, "The CSRF token is invalid. Please try to resubmit the form.", "")
+		return
+	}
+
+	sport, err := strconv.Atoi(r.PostForm.Get("activity[sport]"))
+	if err != nil || sport < 1 || sport > len(editSports) {
+		s.serveEditPage(w, id, "", "activity[sport]")
+		return
+	}
+	trainingType, err := strconv.Atoi(r.PostForm.Get("activity[type]"))
+	if err != nil || trainingType < 0 || trainingType > len(editTrainingTypes) {
+		s.serveEditPage(w, id, "", "activity[type]")
+		return
+	}
+
+	a.Title = r.PostForm.Get("activity[title]")
+	a.Notes = r.PostForm.Get("activity[notes]")
+	a.Sport = editSports[sport-1]
+	a.TrainingType = ""
+	if trainingType > 0 {
+		a.TrainingType = editTrainingTypes[trainingType-1]
+	}
+	a.Equipment = nil
+	for _, eid := range r.PostForm["activity[equipment][]"] {
+		for _, e := range equipment {
+			if e.ID == eid {
+				a.Equipment = append(a.Equipment, e.Name)
+			}
+		}
+	}
+	a.Public = r.PostForm.Get("activity[is_public]") == "1"
+
+	s.mu.Lock()
+	s.activities[id] = a
+	s.mu.Unlock()
+	http.Redirect(w, r, "/activity/"+id, http.StatusFound)
+}
+
+// boxedValue renders one of the values under the activity title
+const boxedValue = `<div class="boxed-value-container"><div class="boxed-value">%s</div><div class="boxed-value-info">%s</div></div>
+`
+
+func (s *Server) serveExport(w http.ResponseWriter, id, format string) {
+	s.mu.Lock()
+	a, ok := s.activities[id]
+	onExport := s.onExport
+	s.mu.Unlock()
+	if onExport != nil {
+		onExport(id, format)
+	}
+	if !ok {
+		http.Error(w, "activity not found", http.StatusNotFound)
+		return
+	}
+
+	data, ok := s.export(a, format)
+	if !ok {
+		http.Error(w, "export not available", http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	s.exportsServed[id+"/"+format]++
+	s.mu.Unlock()
+
+	ext := format
+	if format == "fit-original" {
+		ext = "fit"
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, a.Date.Format("2006-01-02"), id, ext))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+// export returns the content of a's export in format, if available
+func (s *Server) export(a Activity, format string) ([]byte, bool) {
+	s.mu.Lock()
+	missing := s.missing[format]
+	s.mu.Unlock()
+	if missing {
+		return nil, false
+	}
+
+	if a.Exports != nil {
+		data, ok := a.Exports[format]
+		return data, ok
+	}
+	for _, f := range allFormats {
+		if f == format {
+			return ExportContent(a.ID, format), true
+		}
+	}
+	return nil, false
+}
+
+// ExportContent is the content served for activities without Exports.
+func ExportContent(activityID, format string) []byte {
+	return []byte(fmt.Sprintf("fake %s export of activity %s\n", format, activityID))
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,219 @@
+package runalyzetest_test
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/runalyze"
+	"github.com/roessland/syncwich/runalyze/runalyzetest"
+)
+
+var monday = time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+
+func newClient(t *testing.T, srv *runalyzetest.Server, opts ...runalyze.Option) *runalyze.Client {
+	t.Helper()
+	opts = append([]runalyze.Option{
+		runalyze.WithBaseURL(srv.URL),
+		runalyze.WithCredentials(srv.Username, srv.Password),
+		runalyze.WithRateLimit(runalyze.RateLimit{}),
+		runalyze.WithRetryPolicy(runalyze.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	}, opts...)
+	client, err := runalyze.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestServer_LoginAndDownload(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "101", Date: monday.Add(7 * time.Hour), Sport: "Running", DistanceKm: 6.5, Duration: 38*time.Minute + 45*time.Second})
+	srv.AddActivity(runalyzetest.Activity{ID: "999", Date: monday.AddDate(0, 0, -7), Sport: "Cycling"})
+	client := newClient(t, srv)
+
+	if _, err := client.GetDataBrowser(monday); !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("before login: err = %v, want ErrRedirectedToLogin", err)
+	}
+	if err := client.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	page, err := client.GetDataBrowser(monday)
+	if err != nil {
+		t.Fatalf("GetDataBrowser: %v", err)
+	}
+	if !strings.Contains(string(page), `data-activity-id="101"`) || !strings.Contains(string(page), "6,5&nbsp;km") {
+		t.Errorf("databrowser is missing activity 101:\n%s", page)
+	}
+	if strings.Contains(string(page), `data-activity-id="999"`) {
+		t.Error("databrowser lists an activity from the previous week")
+	}
+
+	data, filename, err := client.GetFit("101")
+	if err != nil {
+		t.Fatalf("GetFit: %v", err)
+	}
+	if string(data) != string(runalyzetest.ExportContent("101", "fit-original")) || filename != "2025-05-26-101.fit" {
+		t.Errorf("GetFit = %q, %q", data, filename)
+	}
+	if srv.Logins() != 1 {
+		t.Errorf("Logins() = %d, want 1", srv.Logins())
+	}
+}
+
+func TestServer_WrongPassword(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	client := newClient(t, srv, runalyze.WithCredentials(srv.Username, "wrong"))
+
+	if err := client.Login(); err != nil {
+		t.Fatalf("Login: %v", err) // Runalyze redirects back to /login
+	}
+	if _, err := client.GetDataBrowser(monday); !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("err = %v, want ErrRedirectedToLogin", err)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "101", Date: monday, Sport: "Running"})
+	client := newClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.MissingFormat(runalyze.FitFormat)
+	if _, _, err := client.GetFit("101"); !runalyze.IsNotFound(err) {
+		t.Errorf("GetFit with FIT missing: err = %v, want 404", err)
+	}
+	if _, _, err := client.GetTcx("101"); err != nil {
+		t.Errorf("GetTcx: %v", err)
+	}
+
+	// Two 502s are retried away
+	srv.BadGateway(2)
+	if _, _, err := client.GetTcx("101"); err != nil {
+		t.Errorf("GetTcx after 502s: %v", err)
+	}
+
+	srv.ExpireSessionsAfter(1)
+	if _, err := client.GetDataBrowser(monday); err != nil {
+		t.Fatalf("last request before expiry: %v", err)
+	}
+	if _, err := client.GetDataBrowser(monday); !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("after expiry: err = %v, want ErrRedirectedToLogin", err)
+	}
+}
+
+func TestServer_Upload(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "101", Date: monday.Add(7 * time.Hour), Sport: "Running"})
+	client := newClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := client.UploadActivity("morning.fit", strings.NewReader("new fit data"))
+	if err != nil {
+		t.Fatalf("UploadActivity: %v", err)
+	}
+	if imported.Status != runalyze.UploadImported || imported.ActivityID == "" {
+		t.Errorf("new file: %+v, want imported", imported)
+	}
+	if _, err := client.GetActivityPage(imported.ActivityID); err != nil {
+		t.Errorf("imported activity %s not found: %v", imported.ActivityID, err)
+	}
+
+	duplicate, err := client.UploadActivity("101.fit", strings.NewReader(string(runalyzetest.ExportContent("101", "fit-original"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duplicate.Status != runalyze.UploadDuplicate || !strings.Contains(duplicate.Message, "101") {
+		t.Errorf("existing file: %+v, want duplicate of 101", duplicate)
+	}
+
+	rejected, err := client.UploadActivity("broken.gpx", strings.NewReader("invalid gpx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != runalyze.UploadRejected || rejected.Message == "" {
+		t.Errorf("broken file: %+v, want rejected with a message", rejected)
+	}
+
+	if got := srv.Uploads(); len(got) != 3 || got[0] != "morning.fit" {
+		t.Errorf("Uploads() = %v", got)
+	}
+}
+
+func TestServer_EditActivity(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "101", Date: monday.Add(7 * time.Hour), Sport: "Running"})
+	client := newClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := client.GetActivityEditPage("101")
+	if err != nil {
+		t.Fatalf("GetActivityEditPage: %v", err)
+	}
+	token := regexp.MustCompile(`name="_csrf_token" value="([^"]+)"`).FindStringSubmatch(string(page))
+	if token == nil {
+		t.Fatalf("edit form has no CSRF token:\n%s", page)
+	}
+
+	form := url.Values{
+		"_csrf_token":     {token[1]},
+		"activity[title]": {"Morning run"},
+		"activity[sport]": {"2"},
+		"activity[type]":  {"0"},
+	}
+	if err := client.SaveActivity("101", form); err != nil {
+		t.Fatalf("SaveActivity: %v", err)
+	}
+	if a, _ := srv.Activity("101"); a.Title != "Morning run" || a.Sport != "Cycling" {
+		t.Errorf("activity after save = %+v", a)
+	}
+
+	form.Set("activity[sport]", "99")
+	var rejected *runalyze.EditRejectedError
+	if err := client.SaveActivity("101", form); !errors.As(err, &rejected) || rejected.Message != "This value is not valid." {
+		t.Errorf("invalid sport: err = %v, want an EditRejectedError with the field error", err)
+	}
+}
+
+func TestServer_Logout(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	client := newClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rememberMe bool
+	for _, c := range client.Cookies() {
+		if c.Name == runalyze.RememberMeCookie && c.Expires.After(time.Now().Add(300*24*time.Hour)) {
+			rememberMe = true
+		}
+	}
+	if !rememberMe {
+		t.Errorf("no long-lived %s cookie after login: %v", runalyze.RememberMeCookie, client.Cookies())
+	}
+
+	page, err := client.GetAccountPage()
+	if err != nil || !strings.Contains(string(page), srv.AccountName) {
+		t.Fatalf("GetAccountPage = %q, %v", page, err)
+	}
+
+	if err := client.Logout(); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if cookies := client.Cookies(); len(cookies) != 0 {
+		t.Errorf("cookies left after logout: %v", cookies)
+	}
+	if _, err := client.GetAccountPage(); !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Errorf("after logout: err = %v, want ErrRedirectedToLogin", err)
+	}
+}
@@ -0,0 +1,110 @@
+package runalyze
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// RememberMeCookie is the long-lived cookie Runalyze sets when logging in
+// with "remember me". It outlives the PHP session and logs the client in
+// again once the session has expired.
+const RememberMeCookie = "REMEMBERME"
+
+// Logout ends the session on the server
+func (c *Client) Logout() error {
+	return c.LogoutContext(context.Background())
+}
+
+// LogoutContext ends the session on the server, aborting if ctx is
+// cancelled. The cookies the server deletes are dropped from the cookie
+// store; use ClearCookies to drop the rest.
+func (c *Client) LogoutContext(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/logout", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setDocumentHeaders(req)
+
+	resp, body, err := c.doRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Runalyze redirects to the start page, or to the login page if the
+	// session was already gone
+	if resp.StatusCode >= 400 {
+		return newStatusError(resp, body)
+	}
+	return nil
+}
+
+// GetAccountPage retrieves the HTML of the account settings, which show
+// the username, name and email of the logged-in account
+func (c *Client) GetAccountPage() ([]byte, error) {
+	return c.GetAccountPageContext(context.Background())
+}
+
+// GetAccountPageContext retrieves the HTML of the account settings,
+// aborting if ctx is cancelled
+func (c *Client) GetAccountPageContext(ctx context.Context) ([]byte, error) {
+	url := fmt.Sprintf("%s/settings/account", c.baseURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setDocumentHeaders(req)
+
+	return c.getPage(req)
+}
+
+// Cookies returns copies of the session cookies the client holds, with
+// their expiry. Cookies with a zero Expires last until the session ends.
+func (c *Client) Cookies() []*http.Cookie {
+	if pjar, ok := c.httpClient.Jar.(*persistentCookieJar); ok {
+		pjar.mu.Lock()
+		defer pjar.mu.Unlock()
+		return pjar.snapshot()
+	}
+	return nil
+}
+
+// ClearCookies forgets every cookie and empties the cookie store, so the
+// next request starts logged out
+func (c *Client) ClearCookies() error {
+	return c.resetCookies(false)
+}
+
+// ResetCookies forgets every cookie, like ClearCookies, but leaves the
+// cookie store alone until PersistCookies is called. A login that fails
+// after a reset keeps the stored session.
+func (c *Client) ResetCookies() error {
+	return c.resetCookies(true)
+}
+
+// resetCookies implements ClearCookies and ResetCookies
+func (c *Client) resetCookies(hold bool) error {
+	pjar, ok := c.httpClient.Jar.(*persistentCookieJar)
+	if !ok {
+		return fmt.Errorf("cookie jar is not a persistent cookie jar")
+	}
+
+	pjar.mu.Lock()
+	defer pjar.mu.Unlock()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create cookie jar: %w", err)
+	}
+	pjar.Jar = jar
+	clear(pjar.cookies)
+	pjar.held = hold
+	if hold {
+		return nil
+	}
+	return pjar.save()
+}
@@ -0,0 +1,35 @@
+package runalyze
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClient_ClearCookies(t *testing.T) {
+	store := NewMemoryCookieStore(
+		&http.Cookie{Name: "PHPSESSID", Value: "abc", Domain: "runalyze.com", Path: "/"},
+		&http.Cookie{Name: RememberMeCookie, Value: "def", Domain: "runalyze.com", Path: "/", Expires: time.Now().Add(24 * time.Hour)},
+	)
+	client, err := NewClient(WithCookieStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(client.Cookies()); n != 2 {
+		t.Fatalf("loaded %d cookies, want 2", n)
+	}
+
+	if err := client.ClearCookies(); err != nil {
+		t.Fatalf("ClearCookies: %v", err)
+	}
+	if cookies := client.Cookies(); len(cookies) != 0 {
+		t.Errorf("Cookies() = %v after clearing", cookies)
+	}
+	if saved, _ := store.Load(); len(saved) != 0 {
+		t.Errorf("store still holds %v", saved)
+	}
+	u := client.httpClient.Jar.(*persistentCookieJar).base
+	if sent := client.httpClient.Jar.Cookies(u); len(sent) != 0 {
+		t.Errorf("jar still sends %v", sent)
+	}
+}
@@ -0,0 +1,195 @@
+package runalyze
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// UploadStatus is the outcome of uploading an activity file
+type UploadStatus string
+
+const (
+	// UploadImported means Runalyze created a new activity from the file
+	UploadImported UploadStatus = "imported"
+	// UploadDuplicate means Runalyze already has the activity
+	UploadDuplicate UploadStatus = "duplicate"
+	// UploadRejected means Runalyze couldn't import the file
+	UploadRejected UploadStatus = "rejected"
+)
+
+// UploadResult is Runalyze's answer to an upload
+type UploadResult struct {
+	Status     UploadStatus
+	ActivityID string // the new activity, set when Status is UploadImported
+	Message    string // Runalyze's explanation for duplicates and rejections
+}
+
+// uploadPath is the page with the activity upload form
+const uploadPath = "/activity/upload"
+
+var (
+	multipartFormRe    = regexp.MustCompile(`(?is)<form\b[^>]*multipart/form-data[^>]*>`)
+	formActionRe       = regexp.MustCompile(`(?i)\baction="([^"]*)"`)
+	inputTagRe         = regexp.MustCompile(`(?is)<input\b[^>]*>`)
+	inputNameRe        = regexp.MustCompile(`(?i)\bname="([^"]*)"`)
+	inputValueRe       = regexp.MustCompile(`(?i)\bvalue="([^"]*)"`)
+	inputTypeRe        = regexp.MustCompile(`(?i)\btype="([^"]*)"`)
+	activityLocationRe = regexp.MustCompile(`/activity/(\d+)(?:[/?#]|$)`)
+	alertRe            = regexp.MustCompile(`(?is)<div[^>]*class="[^"]*alert[^"]*"[^>]*>(.*?)</div>`)
+	tagRe              = regexp.MustCompile(`<[^>]*>`)
+)
+
+// uploadForm is what the upload page says about how to post a file
+type uploadForm struct {
+	action    string
+	fileField string
+	hidden    map[string]string // hidden inputs, including the CSRF token
+}
+
+// UploadActivity uploads an activity file (FIT, TCX, GPX, ...) read from r.
+// filename is sent along so Runalyze can tell the format.
+func (c *Client) UploadActivity(filename string, r io.Reader) (*UploadResult, error) {
+	return c.UploadActivityContext(context.Background(), filename, r)
+}
+
+// UploadActivityContext uploads an activity file, aborting if ctx is
+// cancelled. Duplicates and files Runalyze can't import are reported in the
+// result, not as errors.
+func (c *Client) UploadActivityContext(ctx context.Context, filename string, r io.Reader) (*UploadResult, error) {
+	form, err := c.getUploadForm(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload form: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range form.hidden {
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	part, err := mw.CreateFormFile(form.fileField, filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", form.action, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setDocumentHeaders(req)
+	req.Header.Set("content-type", mw.FormDataContentType())
+	req.Header.Set("referer", c.baseURL+uploadPath)
+
+	resp, respBody, err := c.doUnsafeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return parseUploadResponse(resp, respBody)
+}
+
+// getUploadForm reads the action, file field and hidden inputs of the
+// upload form
+func (c *Client) getUploadForm(ctx context.Context) (*uploadForm, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+uploadPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setDocumentHeaders(req)
+
+	body, err := c.getPage(req)
+	if err != nil {
+		return nil, err
+	}
+
+	formTag := multipartFormRe.Find(body)
+	if formTag == nil {
+		return nil, fmt.Errorf("upload form not found in response")
+	}
+	form := &uploadForm{action: c.baseURL + uploadPath, hidden: make(map[string]string)}
+	if m := formActionRe.FindSubmatch(formTag); m != nil && len(m[1]) > 0 {
+		action := html.UnescapeString(string(m[1]))
+		if strings.HasPrefix(action, "/") {
+			action = c.baseURL + action
+		}
+		form.action = action
+	}
+
+	for _, input := range inputTagRe.FindAll(body, -1) {
+		name := inputNameRe.FindSubmatch(input)
+		if name == nil {
+			continue
+		}
+		inputType := ""
+		if m := inputTypeRe.FindSubmatch(input); m != nil {
+			inputType = strings.ToLower(string(m[1]))
+		}
+		switch inputType {
+		case "file":
+			form.fileField = string(name[1])
+		case "hidden":
+			value := ""
+			if m := inputValueRe.FindSubmatch(input); m != nil {
+				value = html.UnescapeString(string(m[1]))
+			}
+			form.hidden[string(name[1])] = value
+		}
+	}
+	if form.fileField == "" {
+		return nil, fmt.Errorf("file input not found in upload form")
+	}
+	return form, nil
+}
+
+// parseUploadResponse tells imported, duplicate and rejected uploads apart.
+// An import redirects to the new activity; otherwise the page explains
+// itself in an alert.
+func parseUploadResponse(resp *http.Response, body []byte) (*UploadResult, error) {
+	if resp.StatusCode == http.StatusFound || resp.StatusCode == http.StatusSeeOther {
+		location := resp.Header.Get("Location")
+		if strings.HasSuffix(location, "/login") {
+			return nil, ErrRedirectedToLogin
+		}
+		if m := activityLocationRe.FindStringSubmatch(location); m != nil {
+			return &UploadResult{Status: UploadImported, ActivityID: m[1]}, nil
+		}
+		return nil, newStatusError(resp, body)
+	}
+
+	message := ""
+	if m := alertRe.FindSubmatch(body); m != nil {
+		message = htmlText(m[1])
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusConflict || strings.Contains(strings.ToLower(message), "duplicate"):
+		return &UploadResult{Status: UploadDuplicate, Message: message}, nil
+	case resp.StatusCode == http.StatusOK && message == "":
+		return nil, fmt.Errorf("unexpected upload response without a result")
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+		return &UploadResult{Status: UploadRejected, Message: message}, nil
+	default:
+		return nil, newStatusError(resp, body)
+	}
+}
+
+// htmlText returns the text of an HTML fragment, with whitespace collapsed
+func htmlText(fragment []byte) string {
+	return strings.Join(strings.Fields(html.UnescapeString(tagRe.ReplaceAllString(string(fragment), " "))), " ")
+}
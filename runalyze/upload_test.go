@@ -0,0 +1,53 @@
+package runalyze
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseUploadResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		location   string
+		body       string
+		want       UploadStatus
+		wantID     string
+		wantMsg    string
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{name: "imported", status: http.StatusFound, location: "/activity/900001", want: UploadImported, wantID: "900001"},
+		{name: "imported absolute", status: http.StatusSeeOther, location: "https://runalyze.com/activity/42?created=1", want: UploadImported, wantID: "42"},
+		{name: "logged out", status: http.StatusFound, location: "/login", wantErr: ErrRedirectedToLogin},
+		{name: "duplicate alert", status: http.StatusOK, body: `<div class="alert alert-warning">This activity seems to be a <b>duplicate</b></div>`, want: UploadDuplicate, wantMsg: "This activity seems to be a duplicate"},
+		{name: "conflict", status: http.StatusConflict, want: UploadDuplicate},
+		{name: "rejected", status: http.StatusUnprocessableEntity, body: `<div class="alert alert-danger">run.fit could not be imported</div>`, want: UploadRejected, wantMsg: "run.fit could not be imported"},
+		{name: "no result", status: http.StatusOK, body: `<html></html>`, wantAnyErr: true},
+		{name: "server error", status: http.StatusInternalServerError, wantAnyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, Request: &http.Request{Method: "POST"}}
+			if tt.location != "" {
+				resp.Header.Set("Location", tt.location)
+			}
+
+			got, err := parseUploadResponse(resp, []byte(tt.body))
+
+			if tt.wantErr != nil || tt.wantAnyErr {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want || got.ActivityID != tt.wantID || got.Message != tt.wantMsg {
+				t.Errorf("got %+v, want status %q, id %q, message %q", got, tt.want, tt.wantID, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package sw
 
 import (
 	"testing"
+	"time"
 )
 
 func TestFindActivityIds(t *testing.T) {
@@ -88,3 +89,172 @@ func TestFindActivityIds(t *testing.T) {
 		})
 	}
 }
+
+func TestParseActivitiesFromHTML_RowMetrics(t *testing.T) {
+	html := `<table>
+		<tr class="text-right" data-activity-id="1">
+			<td>05.01&nbsp;<a href="https://runalyze.com/health/note/2026-01-05"><i class="fa-solid fa-heart-pulse"></i></a>&nbsp;Mon</td>
+			<td><i class="icons8-Cross-Country-Skiing"></i></td>
+			<td>LR</td>
+			<td>21,1&nbsp;km</td>
+			<td>1:02:03</td>
+			<td class="small">2:56/km</td>
+			<td class="small">1&nbsp;204&nbsp;kcal</td>
+			<td class="small">-7&nbsp;°C</td>
+		</tr>
+		<tr class="text-right" data-activity-id="2">
+			<td></td>
+			<td><i class="icons8-Regular-Biking"></i></td>
+			<td></td>
+			<td>3,0&nbsp;km</td>
+		</tr>
+	</table>`
+
+	activities, err := parseActivitiesFromHTML([]byte(html), time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 2 {
+		t.Fatalf("Expected 2 activities, got %d", len(activities))
+	}
+
+	ski := activities[0]
+	if ski.TrainingType != "LR" {
+		t.Errorf("TrainingType = %q, want LR", ski.TrainingType)
+	}
+	if ski.Duration != time.Hour+2*time.Minute+3*time.Second {
+		t.Errorf("Duration = %v, want 1h2m3s", ski.Duration)
+	}
+	if ski.PacePerKm != 2*time.Minute+56*time.Second {
+		t.Errorf("PacePerKm = %v, want 2m56s", ski.PacePerKm)
+	}
+	if ski.EnergyKcal != 1204 {
+		t.Errorf("EnergyKcal = %d, want 1204", ski.EnergyKcal)
+	}
+	if ski.Weather == nil || ski.Weather.TemperatureC != -7 {
+		t.Errorf("Weather = %+v, want -7 °C", ski.Weather)
+	}
+
+	// Hidden or empty columns stay zero
+	bike := activities[1]
+	if bike.Duration != 0 || bike.AvgHeartRate != 0 || bike.Weather != nil || bike.TrainingType != "" {
+		t.Errorf("Expected no metrics for a sparse row, got %+v", bike)
+	}
+}
+
+// databrowserHeader renders a thead cell the way Runalyze does
+func databrowserHeader(label, tip string) string {
+	return `<td><span class="block relative min-w-4">&nbsp;<span class="block truncate absolute inset-0 text-right">` + label +
+		`</span><span class="absolute inset-0 lg:tooltip lg:tooltip-bottom" data-tip="` + tip + `"></span></span></td>`
+}
+
+func TestParseActivitiesFromHTML_CustomColumns(t *testing.T) {
+	// A user layout with reordered columns and a max. heart rate column the
+	// parser doesn't know. Guessing by content would take "181 bpm" as the
+	// average heart rate and the first elevation as the ascent.
+	html := `<table>
+		<thead class="data-browser-labels"><tr>
+			<td colspan="1"></td>
+			<td></td>
+			` + databrowserHeader("Desc.", "Descent") + `
+			` + databrowserHeader("max. HR", "max. Heart rate") + `
+			` + databrowserHeader("Duration", "Duration") + `
+			` + databrowserHeader("avg. HR", "avg. Heart rate") + `
+			` + databrowserHeader("Distance", "Distance") + `
+			` + databrowserHeader("Asc.", "Ascent") + `
+		</tr></thead>
+		<tbody>
+		<tr class="text-right" data-activity-id="1">
+			<td>05.01&nbsp;<a href="https://runalyze.com/health/note/2026-01-05"><i class="fa-solid fa-heart-pulse"></i></a>&nbsp;Mon</td>
+			<td><i class="icons8-Running"></i></td>
+			<td class="small">120&nbsp;m</td>
+			<td class="small">181&nbsp;bpm</td>
+			<td>45:10</td>
+			<td class="small">152&nbsp;bpm</td>
+			<td>10,2&nbsp;km</td>
+			<td class="small">80&nbsp;m</td>
+		</tr>
+		</tbody>
+	</table>`
+
+	logger := &MockLogger{}
+	activities, err := parseActivitiesFromHTML([]byte(html), time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 {
+		t.Fatalf("Expected 1 activity, got %d", len(activities))
+	}
+
+	run := activities[0]
+	if run.DistanceKm != 10.2 {
+		t.Errorf("DistanceKm = %v, want 10.2", run.DistanceKm)
+	}
+	if run.Duration != 45*time.Minute+10*time.Second {
+		t.Errorf("Duration = %v, want 45m10s", run.Duration)
+	}
+	if run.AvgHeartRate != 152 {
+		t.Errorf("AvgHeartRate = %d, want 152", run.AvgHeartRate)
+	}
+	if run.AscentM != 80 || run.DescentM != 120 {
+		t.Errorf("AscentM, DescentM = %d, %d, want 80, 120", run.AscentM, run.DescentM)
+	}
+
+	// The unknown column ends up in the layout report
+	var unknown any
+	for _, call := range logger.DebugCalls {
+		if call.Message != "databrowser layout" {
+			continue
+		}
+		for i := 0; i+1 < len(call.Args); i += 2 {
+			if call.Args[i] == "unknown_columns" {
+				unknown = call.Args[i+1]
+			}
+		}
+	}
+	if unknown != "3:max. HR" {
+		t.Errorf("unknown_columns = %v, want 3:max. HR", unknown)
+	}
+}
+
+func TestParseActivitiesFromHTML_LocalizedHeader(t *testing.T) {
+	// A German UI: no header label is known, so the cells are guessed by
+	// their content instead of all being unknown
+	html := `<table>
+		<thead class="data-browser-labels"><tr>
+			<td colspan="1"></td>
+			<td></td>
+			` + databrowserHeader("Dauer", "Dauer") + `
+			` + databrowserHeader("Distanz", "Distanz") + `
+			` + databrowserHeader("Herzfr.", "Herzfrequenz") + `
+		</tr></thead>
+		<tbody>
+		<tr class="text-right" data-activity-id="1">
+			<td>05.01&nbsp;<a href="https://runalyze.com/health/note/2026-01-05"><i class="fa-solid fa-heart-pulse"></i></a>&nbsp;Mo</td>
+			<td><i class="icons8-Running"></i></td>
+			<td>45:10</td>
+			<td>10,2&nbsp;km</td>
+			<td class="small">152&nbsp;bpm</td>
+		</tr>
+		</tbody>
+	</table>`
+
+	activities, err := parseActivitiesFromHTML([]byte(html), time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 {
+		t.Fatalf("Expected 1 activity, got %d", len(activities))
+	}
+
+	run := activities[0]
+	if run.DistanceKm != 10.2 {
+		t.Errorf("DistanceKm = %v, want 10.2", run.DistanceKm)
+	}
+	if run.Duration != 45*time.Minute+10*time.Second {
+		t.Errorf("Duration = %v, want 45m10s", run.Duration)
+	}
+	if run.AvgHeartRate != 152 {
+		t.Errorf("AvgHeartRate = %d, want 152", run.AvgHeartRate)
+	}
+}
@@ -0,0 +1,252 @@
+package sw
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ActivityDetails is what the activity page (/activity/{id}) shows about an
+// activity, beyond the databrowser row
+type ActivityDetails struct {
+	ID           string
+	Title        string
+	Notes        string
+	Sport        string // e.g. "Running"
+	SportIcon    string // icons8 class, e.g. "icons8-Running"
+	TrainingType string // e.g. "Long run"
+	Equipment    []string
+	StartTime    time.Time
+	DistanceKm   float64
+	Duration     time.Duration
+	Elevation    Elevation
+	VO2max       VO2maxInfo
+	Laps         []Lap
+	Created      time.Time // zero if the page doesn't say
+	Edited       time.Time // zero if never edited
+	// ExportFormats lists the formats the export submenu offers, e.g.
+	// "fit-original", "tcx"
+	ExportFormats []string
+}
+
+// Elevation holds the elevation summary of an activity
+type Elevation struct {
+	AscentM  int
+	DescentM int
+	MinM     int
+	MaxM     int
+}
+
+// VO2maxInfo holds the VO2max estimate of an activity
+type VO2maxInfo struct {
+	Value float64
+	// UsedForShape is false when Runalyze grays the value out because it
+	// doesn't count towards the current shape
+	UsedForShape bool
+}
+
+// Lap is a row of the laps/splits table
+type Lap struct {
+	Number       int
+	DistanceKm   float64
+	Duration     time.Duration
+	PacePerKm    time.Duration
+	SpeedKmh     float64
+	AvgHeartRate int
+	AscentM      int
+	DescentM     int
+}
+
+// lapHeaderMetrics maps laps table headers to metrics, on top of headerMetrics
+var lapHeaderMetrics = map[string]metric{
+	"Time":      metricDuration,
+	"HR":        metricHeartRate,
+	"avg. HR":   metricHeartRate,
+	"Elevation": metricAscent,
+	"Elev.":     metricAscent,
+}
+
+var (
+	createdRe      = regexp.MustCompile(`Created:?\s*(\d{2}\.\d{2}\.\d{4})\s+(\d{2}:\d{2})`)
+	editedRe       = regexp.MustCompile(`(?:Last edit|Edited):?\s*(\d{2}\.\d{2}\.\d{4})\s+(\d{2}:\d{2})`)
+	startTimeRe    = regexp.MustCompile(`(\d{2}\.\d{2}\.\d{4})(?:\s+(\d{2}:\d{2}))?`)
+	exportFormatRe = regexp.MustCompile(`/export/file/([a-z-]+)$`)
+)
+
+// ParseActivityDetails parses the activity page of activityID. The page is
+// read by its labels: the boxed values under the title ("Distance",
+// "Duration", "Ascent", ...), the label/value rows of the details table
+// ("Sport", "Type", "Equipment"), the laps table and the created/edited
+// line. Anything the page doesn't show stays zero.
+func ParseActivityDetails(htmlContent []byte, activityID string) (*ActivityDetails, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse activity page: %w", err)
+	}
+
+	details := &ActivityDetails{ID: activityID}
+
+	heading := doc.Find(".panel-heading").First()
+	details.Title = normalizeSpaces(heading.Find("h1").First().Text())
+	if details.Title == "" {
+		details.Title = normalizeSpaces(doc.Find("h1").First().Text())
+	}
+	if match := startTimeRe.FindStringSubmatch(normalizeSpaces(heading.Find(".activity-date").Text())); match != nil {
+		details.StartTime = parseGermanDateTime(match[1], match[2])
+	}
+
+	if icon := doc.Find("i[class*='icons8-']").First(); icon.Length() > 0 {
+		for _, class := range strings.Fields(icon.AttrOr("class", "")) {
+			if strings.HasPrefix(class, "icons8-") {
+				details.SportIcon = class
+			}
+		}
+	}
+
+	details.Notes = strings.TrimSpace(doc.Find(".activity-notes").First().Text())
+
+	doc.Find(".boxed-value-container").Each(func(_ int, box *goquery.Selection) {
+		value := box.Find(".boxed-value").First()
+		details.applyBoxedValue(normalizeSpaces(box.Find(".boxed-value-info").First().Text()), value)
+	})
+
+	doc.Find(".activity-details tr").Each(func(_ int, row *goquery.Selection) {
+		label := strings.TrimSuffix(normalizeSpaces(row.Find("th").First().Text()), ":")
+		value := row.Find("td").First()
+		switch label {
+		case "Sport":
+			details.Sport = normalizeSpaces(value.Text())
+		case "Type", "Activity type":
+			details.TrainingType = normalizeSpaces(value.Text())
+		case "Equipment":
+			details.Equipment = equipmentNames(value)
+		}
+	})
+
+	details.Laps = parseLaps(doc)
+
+	text := normalizeSpaces(doc.Text())
+	if match := createdRe.FindStringSubmatch(text); match != nil {
+		details.Created = parseGermanDateTime(match[1], match[2])
+	}
+	if match := editedRe.FindStringSubmatch(text); match != nil {
+		details.Edited = parseGermanDateTime(match[1], match[2])
+	}
+
+	for _, link := range ExtractExportLinks(htmlContent) {
+		if match := exportFormatRe.FindStringSubmatch(link); match != nil {
+			details.ExportFormats = append(details.ExportFormats, match[1])
+		}
+	}
+
+	return details, nil
+}
+
+// applyBoxedValue reads one of the boxed values under the activity title
+func (d *ActivityDetails) applyBoxedValue(label string, value *goquery.Selection) {
+	var info ActivityInfo
+	switch label {
+	case "Distance":
+		applyMetric(&info, metricDistance, value)
+		d.DistanceKm = info.DistanceKm
+	case "Duration", "Time":
+		applyMetric(&info, metricDuration, value)
+		d.Duration = info.Duration
+	case "Ascent", "Elevation":
+		applyMetric(&info, metricAscent, value)
+		d.Elevation.AscentM = info.AscentM
+	case "Descent":
+		applyMetric(&info, metricDescent, value)
+		d.Elevation.DescentM = info.DescentM
+	case "Lowest point", "min. Elevation":
+		if match := elevationRe.FindStringSubmatch(cellText(value)); match != nil {
+			d.Elevation.MinM = int(parseDecimal(match[1]))
+		}
+	case "Highest point", "max. Elevation":
+		if match := elevationRe.FindStringSubmatch(cellText(value)); match != nil {
+			d.Elevation.MaxM = int(parseDecimal(match[1]))
+		}
+	case "VO2max", "Effective VO2max":
+		applyMetric(&info, metricVO2max, value)
+		d.VO2max.Value = info.VO2max
+		d.VO2max.UsedForShape = !value.HasClass("unimportant") && value.Find(".unimportant").Length() == 0
+	}
+}
+
+// equipmentNames returns the names of the equipment linked in a details cell
+func equipmentNames(cell *goquery.Selection) []string {
+	var names []string
+	cell.Find("a").Each(func(_ int, a *goquery.Selection) {
+		if name := normalizeSpaces(a.Text()); name != "" {
+			names = append(names, name)
+		}
+	})
+	if len(names) > 0 {
+		return names
+	}
+	for _, name := range strings.Split(cell.Text(), ",") {
+		if name = normalizeSpaces(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseLaps reads the laps table, mapping its columns by header like the
+// databrowser
+func parseLaps(doc *goquery.Document) []Lap {
+	table := doc.Find(".activity-laps table, #training-rounds table").First()
+	if table.Length() == 0 {
+		return nil
+	}
+
+	var metrics []metric
+	table.Find("thead tr").First().Children().Each(func(_ int, cell *goquery.Selection) {
+		label := normalizeSpaces(cell.Text())
+		m, ok := lapHeaderMetrics[label]
+		if !ok {
+			m = headerMetrics[label]
+		}
+		metrics = append(metrics, m)
+	})
+
+	var laps []Lap
+	table.Find("tbody tr").Each(func(_ int, row *goquery.Selection) {
+		var info ActivityInfo
+		row.Children().Each(func(i int, td *goquery.Selection) {
+			if i < len(metrics) {
+				applyMetric(&info, metrics[i], td)
+			}
+		})
+		laps = append(laps, Lap{
+			Number:       len(laps) + 1,
+			DistanceKm:   info.DistanceKm,
+			Duration:     info.Duration,
+			PacePerKm:    info.PacePerKm,
+			SpeedKmh:     info.SpeedKmh,
+			AvgHeartRate: info.AvgHeartRate,
+			AscentM:      info.AscentM,
+			DescentM:     info.DescentM,
+		})
+	})
+	return laps
+}
+
+// parseGermanDateTime parses "26.05.2025" and an optional "07:12" as UTC,
+// like the rest of the parser treats Runalyze dates
+func parseGermanDateTime(date, clock string) time.Time {
+	t, err := time.Parse("02.01.2006", date)
+	if err != nil {
+		return time.Time{}
+	}
+	if h, m, ok := strings.Cut(clock, ":"); ok {
+		hours, _ := strconv.Atoi(h)
+		minutes, _ := strconv.Atoi(m)
+		t = t.Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute)
+	}
+	return t
+}
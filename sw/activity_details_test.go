@@ -0,0 +1,89 @@
+package sw
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const activityPageHTML = `<html><body>
+<div class="panel-heading">
+	<h1>Hill repeats in the rain</h1>
+	<span class="activity-date">26.05.2025 07:12</span>
+	<ul class="submenu">
+		<li><a href="/activity/42/export/file/fit-original">as FIT</a></li>
+		<li><a href="/activity/42/export/file/gpx">as GPX</a></li>
+	</ul>
+</div>
+<div class="panel-content">
+	<div class="boxed-value-container"><div class="boxed-value">10,21&nbsp;km</div><div class="boxed-value-info">Distance</div></div>
+	<div class="boxed-value-container"><div class="boxed-value">1:02:03</div><div class="boxed-value-info">Duration</div></div>
+	<div class="boxed-value-container"><div class="boxed-value">1&nbsp;204&nbsp;m</div><div class="boxed-value-info">Ascent</div></div>
+	<div class="boxed-value-container"><div class="boxed-value">1&nbsp;198&nbsp;m</div><div class="boxed-value-info">Descent</div></div>
+	<div class="boxed-value-container"><div class="boxed-value">12&nbsp;m</div><div class="boxed-value-info">Lowest point</div></div>
+	<div class="boxed-value-container"><div class="boxed-value">431&nbsp;m</div><div class="boxed-value-info">Highest point</div></div>
+	<div class="boxed-value-container"><div class="boxed-value unimportant">48,31</div><div class="boxed-value-info">VO2max</div></div>
+	<table class="activity-details">
+		<tr><th>Sport</th><td><i class="icons8-Running"></i> Running</td></tr>
+		<tr><th>Type:</th><td>Interval training</td></tr>
+		<tr><th>Equipment</th><td><a href="/my/equipment/1">Pegasus 40</a> <a href="/my/equipment/2">Rain jacket</a></td></tr>
+	</table>
+	<div class="activity-notes">
+		6x hill, legs heavy
+	</div>
+	<div class="activity-laps"><table>
+		<thead><tr><th>#</th><th>Distance</th><th>Time</th><th>Pace</th><th>HR</th></tr></thead>
+		<tbody>
+			<tr><td>1</td><td>1,00&nbsp;km</td><td>4:35</td><td>4:35/km</td><td>151&nbsp;bpm</td></tr>
+			<tr><td>2</td><td>0,80&nbsp;km</td><td>3:10</td><td>15,2&nbsp;km/h</td><td></td></tr>
+		</tbody>
+	</table></div>
+	<p class="small">Created: 26.05.2025 08:30 &middot; Last edit: 27.05.2025 19:02</p>
+</div>
+</body></html>`
+
+func TestParseActivityDetails(t *testing.T) {
+	details, err := ParseActivityDetails([]byte(activityPageHTML), "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &ActivityDetails{
+		ID:           "42",
+		Title:        "Hill repeats in the rain",
+		Notes:        "6x hill, legs heavy",
+		Sport:        "Running",
+		SportIcon:    "icons8-Running",
+		TrainingType: "Interval training",
+		Equipment:    []string{"Pegasus 40", "Rain jacket"},
+		StartTime:    time.Date(2025, 5, 26, 7, 12, 0, 0, time.UTC),
+		DistanceKm:   10.21,
+		Duration:     time.Hour + 2*time.Minute + 3*time.Second,
+		Elevation:    Elevation{AscentM: 1204, DescentM: 1198, MinM: 12, MaxM: 431},
+		VO2max:       VO2maxInfo{Value: 48.31, UsedForShape: false},
+		Laps: []Lap{
+			{Number: 1, DistanceKm: 1, Duration: 4*time.Minute + 35*time.Second, PacePerKm: 4*time.Minute + 35*time.Second, AvgHeartRate: 151},
+			{Number: 2, DistanceKm: 0.8, Duration: 3*time.Minute + 10*time.Second, SpeedKmh: 15.2},
+		},
+		Created:       time.Date(2025, 5, 26, 8, 30, 0, 0, time.UTC),
+		Edited:        time.Date(2025, 5, 27, 19, 2, 0, 0, time.UTC),
+		ExportFormats: []string{"fit-original", "gpx"},
+	}
+	if !reflect.DeepEqual(details, want) {
+		t.Errorf("ParseActivityDetails =\n%+v\nwant\n%+v", details, want)
+	}
+}
+
+func TestParseActivityDetails_SparsePage(t *testing.T) {
+	// The export submenu alone, like the activity fixtures
+	details, err := ParseActivityDetails([]byte(`<ul class="submenu"><li><a href="/activity/7/export/file/tcx">as TCX</a></li></ul>`), "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Title != "" || details.Laps != nil || !details.Created.IsZero() {
+		t.Errorf("Expected empty details, got %+v", details)
+	}
+	if !reflect.DeepEqual(details.ExportFormats, []string{"tcx"}) {
+		t.Errorf("ExportFormats = %v, want [tcx]", details.ExportFormats)
+	}
+}
@@ -0,0 +1,255 @@
+package sw
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// EditField is a piece of activity metadata syncwich can change
+type EditField string
+
+const (
+	EditTitle        EditField = "title"
+	EditNotes        EditField = "notes"
+	EditSport        EditField = "sport"
+	EditTrainingType EditField = "type"
+	EditEquipment    EditField = "equipment" // comma separated equipment names
+	EditPrivacy      EditField = "privacy"   // "public" or "private"
+)
+
+// EditFields lists the editable fields in the order they are shown
+var EditFields = []EditField{EditTitle, EditNotes, EditSport, EditTrainingType, EditEquipment, EditPrivacy}
+
+// editFieldKeys are the keys of the form inputs (activity[title],
+// activity[sportid], ...) of each field, in order of preference
+var editFieldKeys = map[EditField][]string{
+	EditTitle:        {"title"},
+	EditNotes:        {"notes", "comment"},
+	EditSport:        {"sport", "sportid"},
+	EditTrainingType: {"type", "typeid"},
+	EditEquipment:    {"equipment"},
+	EditPrivacy:      {"is_public", "public", "privacy"},
+}
+
+// inputKeyRe matches the last key of an input name, e.g. "title" in
+// "activity[title]" or "equipment" in "activity[equipment][]"
+var inputKeyRe = regexp.MustCompile(`(?:^|\[)([^\[\]]+)\]?(?:\[\])?$`)
+
+// formOption is an option of a select, or one checkbox/radio of a group
+type formOption struct {
+	value string
+	label string
+}
+
+// formInput is an input of the edit form, or a group of checkboxes sharing
+// a name
+type formInput struct {
+	name     string
+	kind     string // "text", "textarea", "select", "checkbox" or "radio"
+	multiple bool   // select multiple, or checkboxes named "...[]"
+	options  []formOption
+}
+
+// ActivityEditForm is the edit form of an activity. Values holds what
+// posting it unchanged would send, hidden inputs (the CSRF token) included.
+type ActivityEditForm struct {
+	ActivityID string
+	Values     url.Values
+	inputs     map[string]*formInput
+}
+
+// ParseActivityEditForm parses the edit form (/activity/{id}/edit) of an
+// activity
+func ParseActivityEditForm(htmlContent []byte, activityID string) (*ActivityEditForm, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse edit form: %w", err)
+	}
+
+	form := doc.Find("form").FilterFunction(func(_ int, f *goquery.Selection) bool {
+		return f.Find("input[name], textarea[name], select[name]").Length() > 0 && f.Find("input[type=file]").Length() == 0
+	}).First()
+	if form.Length() == 0 {
+		return nil, fmt.Errorf("edit form not found for activity %s", activityID)
+	}
+
+	ef := &ActivityEditForm{ActivityID: activityID, Values: url.Values{}, inputs: make(map[string]*formInput)}
+	form.Find("input[name], textarea[name], select[name]").Each(func(_ int, s *goquery.Selection) {
+		name := s.AttrOr("name", "")
+		switch goquery.NodeName(s) {
+		case "textarea":
+			ef.inputs[name] = &formInput{name: name, kind: "textarea"}
+			ef.Values.Add(name, s.Text())
+		case "select":
+			in := &formInput{name: name, kind: "select", multiple: s.Is("[multiple]")}
+			var selected []string
+			s.Find("option").Each(func(_ int, o *goquery.Selection) {
+				value := o.AttrOr("value", normalizeSpaces(o.Text()))
+				in.options = append(in.options, formOption{value: value, label: normalizeSpaces(o.Text())})
+				if o.Is("[selected]") {
+					selected = append(selected, value)
+				}
+			})
+			if len(selected) == 0 && !in.multiple && len(in.options) > 0 {
+				selected = []string{in.options[0].value}
+			}
+			ef.inputs[name] = in
+			for _, v := range selected {
+				ef.Values.Add(name, v)
+			}
+		default:
+			kind := strings.ToLower(s.AttrOr("type", "text"))
+			switch kind {
+			case "submit", "button", "reset", "file", "image":
+				return
+			case "checkbox", "radio":
+				in := ef.inputs[name]
+				if in == nil {
+					in = &formInput{name: name, kind: kind, multiple: kind == "checkbox" && strings.HasSuffix(name, "[]")}
+					ef.inputs[name] = in
+				}
+				value := s.AttrOr("value", "on")
+				in.options = append(in.options, formOption{value: value, label: inputLabel(doc, s)})
+				if s.Is("[checked]") {
+					ef.Values.Add(name, value)
+				}
+			default:
+				ef.inputs[name] = &formInput{name: name, kind: "text"}
+				ef.Values.Add(name, s.AttrOr("value", ""))
+			}
+		}
+	})
+	return ef, nil
+}
+
+// inputLabel returns the text of the label of a checkbox or radio button:
+// the label wrapping it, or the label pointing at its id
+func inputLabel(doc *goquery.Document, input *goquery.Selection) string {
+	if label := input.Closest("label"); label.Length() > 0 {
+		return normalizeSpaces(label.Text())
+	}
+	if id, ok := input.Attr("id"); ok {
+		return normalizeSpaces(doc.Find(fmt.Sprintf("label[for=%q]", id)).First().Text())
+	}
+	return ""
+}
+
+// input returns the form input of field, or nil if the form doesn't have it
+func (f *ActivityEditForm) input(field EditField) *formInput {
+	for _, key := range editFieldKeys[field] {
+		for name, in := range f.inputs {
+			if m := inputKeyRe.FindStringSubmatch(name); m != nil && m[1] == key {
+				return in
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the current value of field as it would be written in an edit:
+// option labels rather than IDs, "public" or "private" for the privacy
+func (f *ActivityEditForm) Get(field EditField) string {
+	in := f.input(field)
+	if in == nil {
+		return ""
+	}
+	values := f.Values[in.name]
+	if field == EditPrivacy && in.kind == "checkbox" && !in.multiple {
+		if len(values) > 0 {
+			return "public"
+		}
+		return "private"
+	}
+	if len(in.options) == 0 {
+		return strings.Join(values, ", ")
+	}
+	var labels []string
+	for _, v := range values {
+		for _, o := range in.options {
+			if o.value == v {
+				labels = append(labels, o.label)
+			}
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+// Set changes field to value. Sports, types and equipment are given by
+// their label (case doesn't matter); equipment is a comma separated list,
+// empty to remove all.
+func (f *ActivityEditForm) Set(field EditField, value string) error {
+	in := f.input(field)
+	if in == nil {
+		return fmt.Errorf("the edit form of activity %s has no %s field", f.ActivityID, field)
+	}
+
+	if field == EditPrivacy && in.kind == "checkbox" && !in.multiple {
+		switch strings.ToLower(value) {
+		case "public":
+			f.Values.Set(in.name, in.options[0].value)
+		case "private":
+			f.Values.Del(in.name)
+		default:
+			return fmt.Errorf("invalid privacy %q (want public or private)", value)
+		}
+		return nil
+	}
+	if len(in.options) == 0 {
+		f.Values.Set(in.name, value)
+		return nil
+	}
+
+	labels := []string{value}
+	if in.multiple {
+		labels = nil
+		for _, label := range strings.Split(value, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+	}
+	var values []string
+	for _, label := range labels {
+		option, ok := in.option(label)
+		if !ok {
+			return fmt.Errorf("unknown %s %q (available: %s)", field, label, strings.Join(in.labels(), ", "))
+		}
+		values = append(values, option.value)
+	}
+	if len(values) == 0 {
+		f.Values.Del(in.name)
+		return nil
+	}
+	f.Values[in.name] = values
+	return nil
+}
+
+// option finds the option labelled label, or with value label
+func (in *formInput) option(label string) (formOption, bool) {
+	for _, o := range in.options {
+		if strings.EqualFold(o.label, normalizeSpaces(label)) {
+			return o, true
+		}
+	}
+	for _, o := range in.options {
+		if o.value == label {
+			return o, true
+		}
+	}
+	return formOption{}, false
+}
+
+// labels returns the labels of the non-empty options
+func (in *formInput) labels() []string {
+	var labels []string
+	for _, o := range in.options {
+		if o.label != "" {
+			labels = append(labels, o.label)
+		}
+	}
+	return labels
+}
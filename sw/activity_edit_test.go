@@ -0,0 +1,174 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/roessland/syncwich/runalyze"
+)
+
+const editFormHTML = `<form method="post" action="/activity/42/edit">
+<input type="hidden" name="_csrf_token" value="token-1">
+<input type="text" name="activity[title]" value="">
+<textarea name="activity[notes]">Felt good</textarea>
+<select name="activity[sport]">
+  <option value="1" selected>Running</option>
+  <option value="2">Cycling</option>
+</select>
+<select name="activity[type]">
+  <option value="0"></option>
+  <option value="5" selected>Easy run</option>
+  <option value="6">Long run</option>
+</select>
+<label><input type="checkbox" name="activity[equipment][]" value="12" checked> Pegasus 40</label>
+<input type="checkbox" id="eq-13" name="activity[equipment][]" value="13"><label for="eq-13">Vaporfly</label>
+<label><input type="checkbox" name="activity[is_public]" value="1"> Public</label>
+<button type="submit" name="save">Save</button>
+</form>`
+
+func TestParseActivityEditForm(t *testing.T) {
+	form, err := ParseActivityEditForm([]byte(editFormHTML), "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[EditField]string{
+		EditTitle:        "",
+		EditNotes:        "Felt good",
+		EditSport:        "Running",
+		EditTrainingType: "Easy run",
+		EditEquipment:    "Pegasus 40",
+		EditPrivacy:      "private",
+	}
+	for field, value := range want {
+		if got := form.Get(field); got != value {
+			t.Errorf("Get(%s) = %q, want %q", field, got, value)
+		}
+	}
+	if form.Values.Get("_csrf_token") != "token-1" {
+		t.Errorf("CSRF token = %q, want it kept", form.Values.Get("_csrf_token"))
+	}
+	if _, ok := form.Values["save"]; ok {
+		t.Error("submit button was added to the values")
+	}
+}
+
+func TestActivityEditForm_Set(t *testing.T) {
+	form, err := ParseActivityEditForm([]byte(editFormHTML), "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := map[EditField]string{
+		EditTitle:        "Morning run",
+		EditSport:        "cycling",
+		EditTrainingType: "Long run",
+		EditEquipment:    "Vaporfly, Pegasus 40",
+		EditPrivacy:      "public",
+	}
+	for field, value := range changes {
+		if err := form.Set(field, value); err != nil {
+			t.Fatalf("Set(%s): %v", field, err)
+		}
+	}
+
+	if got := form.Values.Get("activity[title]"); got != "Morning run" {
+		t.Errorf("title = %q", got)
+	}
+	if got := form.Values.Get("activity[sport]"); got != "2" {
+		t.Errorf("sport = %q, want option value 2", got)
+	}
+	if got := form.Values.Get("activity[type]"); got != "6" {
+		t.Errorf("type = %q, want option value 6", got)
+	}
+	if got := strings.Join(form.Values["activity[equipment][]"], ","); got != "13,12" {
+		t.Errorf("equipment = %q, want 13,12", got)
+	}
+	if got := form.Get(EditPrivacy); got != "public" {
+		t.Errorf("privacy = %q", got)
+	}
+
+	if err := form.Set(EditSport, "Curling"); err == nil || !strings.Contains(err.Error(), "Running, Cycling") {
+		t.Errorf("unknown sport: err = %v, want the available sports listed", err)
+	}
+	if err := form.Set(EditPrivacy, "friends"); err == nil {
+		t.Error("invalid privacy: want an error")
+	}
+	if err := form.Set(EditEquipment, ""); err != nil || form.Get(EditEquipment) != "" {
+		t.Errorf("clearing equipment: err = %v, equipment = %q", err, form.Get(EditEquipment))
+	}
+}
+
+func TestLoadEditsCSV(t *testing.T) {
+	edits, err := LoadEditsCSV(strings.NewReader("id,title,type,equipment\n101,Morning run,,\n102,,Long run,\"Pegasus 40, Vaporfly\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 2 {
+		t.Fatalf("edits = %+v", edits)
+	}
+	if len(edits[0].Changes) != 1 || edits[0].Changes[EditTitle] != "Morning run" {
+		t.Errorf("edits[0] = %+v, want only the title (empty cells are unchanged)", edits[0])
+	}
+	if edits[1].Changes[EditTrainingType] != "Long run" || edits[1].Changes[EditEquipment] != "Pegasus 40, Vaporfly" {
+		t.Errorf("edits[1] = %+v", edits[1])
+	}
+
+	if _, err := LoadEditsCSV(strings.NewReader("id,colour\n101,red\n")); err == nil {
+		t.Error("unknown column: want an error")
+	}
+	if _, err := LoadEditsCSV(strings.NewReader("title\nMorning run\n")); err == nil {
+		t.Error("missing id column: want an error")
+	}
+}
+
+func TestEditService_Apply(t *testing.T) {
+	client := &MockRunalyzeClient{EditPages: map[string][]byte{"42": []byte(editFormHTML)}}
+	service := NewEditService(client, &MockLogger{})
+	edit := ActivityEdit{ActivityID: "42", Changes: map[EditField]string{EditTitle: "Morning run", EditSport: "Running"}}
+
+	dry := service.Apply(context.Background(), edit, true)
+	if dry.Error != nil || dry.Saved || len(client.SavedForms) != 0 {
+		t.Fatalf("dry run: %+v, saved forms %v; want nothing saved", dry, client.SavedForms)
+	}
+	if len(dry.Changes) != 1 || dry.Changes[0] != (FieldChange{Field: EditTitle, Old: "", New: "Morning run"}) {
+		t.Errorf("dry run changes = %+v, want only the title (sport is already Running)", dry.Changes)
+	}
+
+	saved := service.Apply(context.Background(), edit, false)
+	if saved.Error != nil || !saved.Saved {
+		t.Fatalf("Apply = %+v", saved)
+	}
+	form := client.SavedForms["42"]
+	if form.Get("activity[title]") != "Morning run" || form.Get("_csrf_token") != "token-1" || form.Get("activity[notes]") != "Felt good" {
+		t.Errorf("saved form = %v, want the new title with the other fields kept", form)
+	}
+
+	unchanged := service.Apply(context.Background(), ActivityEdit{ActivityID: "42", Changes: map[EditField]string{EditNotes: "Felt good"}}, false)
+	if unchanged.Saved || len(unchanged.Changes) != 0 {
+		t.Errorf("unchanged edit = %+v, want nothing saved", unchanged)
+	}
+}
+
+func TestEditService_ApplyAll(t *testing.T) {
+	client := &MockRunalyzeClient{EditPages: map[string][]byte{"42": []byte(editFormHTML)}}
+	edits := []ActivityEdit{
+		{ActivityID: "41", Changes: map[EditField]string{EditTitle: "Missing"}},
+		{ActivityID: "42", Changes: map[EditField]string{EditTitle: "Morning run"}},
+	}
+
+	summary, err := NewEditService(client, &MockLogger{}).ApplyAll(context.Background(), edits, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, unchanged, failed := summary.Count(); changed != 1 || unchanged != 0 || failed != 1 {
+		t.Errorf("Count() = %d, %d, %d; want 1 changed, 1 failed", changed, unchanged, failed)
+	}
+
+	client.SaveError = runalyze.ErrRedirectedToLogin
+	if _, err := NewEditService(client, &MockLogger{}).ApplyAll(context.Background(), edits[1:], false, nil); !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Errorf("logged out: err = %v, want ErrRedirectedToLogin", err)
+	}
+}
@@ -17,8 +17,28 @@ type ActivityIterator struct {
 	activities    []ActivityInfo
 	activityIndex int
 	logger        interface{} // We'll accept any logger interface
+	err           error
+	onWeek        WeekFunc
+
+	prefetch     int                // weeks fetched ahead, 0 to fetch each week when it is reached
+	weeks        <-chan weekListing // weeks fetched ahead, in iteration order
+	stopPrefetch context.CancelFunc
+}
+
+// DefaultPrefetchWeeks is how many databrowser weeks the CLI fetches ahead
+// of the week being processed
+const DefaultPrefetchWeeks = 4
+
+// weekListing is a databrowser week fetched ahead of time
+type weekListing struct {
+	activities []ActivityInfo
+	err        error
 }
 
+// WeekFunc receives every activity Runalyze lists for the databrowser week
+// starting at weekStart, before the first of them is yielded
+type WeekFunc func(weekStart time.Time, activities []ActivityInfo)
+
 // NewActivityIterator creates a new ActivityIterator starting from the given date
 func NewActivityIterator(client *runalyze.Client, untilDate time.Time) *ActivityIterator {
 	return &ActivityIterator{
@@ -50,6 +70,39 @@ func (it *ActivityIterator) SetLogger(logger interface{}) {
 	it.logger = logger
 }
 
+// SetWeekFunc sets a callback for each week fetched (optional)
+func (it *ActivityIterator) SetWeekFunc(onWeek WeekFunc) {
+	it.onWeek = onWeek
+}
+
+// SetPrefetch makes the iterator fetch up to weeks databrowser weeks ahead
+// in the background (optional), so processing a week never waits on the
+// listing of the next. Requests still go through the client's rate limit.
+// Call Close when stopping before Next returns false.
+func (it *ActivityIterator) SetPrefetch(weeks int) {
+	it.prefetch = max(weeks, 0)
+}
+
+// Close stops fetching weeks ahead. Iteration ends with the weeks fetched
+// so far.
+func (it *ActivityIterator) Close() {
+	if it.stopPrefetch != nil {
+		it.stopPrefetch()
+	}
+}
+
+// SetContext sets the context used for databrowser requests (optional).
+// Cancelling it aborts the in-flight request and ends iteration.
+func (it *ActivityIterator) SetContext(ctx context.Context) {
+	it.ctx = ctx
+}
+
+// Err returns the error that ended iteration early, if any. It is nil when
+// the iterator simply ran out of weeks.
+func (it *ActivityIterator) Err() error {
+	return it.err
+}
+
 // fetchActivitiesForWeek fetches activities for the current week
 func (it *ActivityIterator) fetchActivitiesForWeek() error {
 	// Check if we've gone beyond the since date
@@ -58,14 +111,46 @@ func (it *ActivityIterator) fetchActivitiesForWeek() error {
 		return nil
 	}
 
-	// Get the data browser page for this week
-	data, err := it.client.GetDataBrowser(it.untilDate)
+	var activities []ActivityInfo
+	var err error
+	if it.prefetch > 0 {
+		var ok bool
+		activities, ok, err = it.nextPrefetchedWeek()
+		if !ok {
+			// Closed before reaching the since date
+			it.done = true
+			return it.ctx.Err()
+		}
+	} else {
+		activities, err = it.fetchWeek(it.ctx, it.untilDate)
+	}
 	if err != nil {
 		return err
 	}
 
+	it.activities = activities
+	it.activityIndex = 0
+	if it.onWeek != nil {
+		it.onWeek(it.untilDate, activities)
+	}
+
+	// Move to the previous week
+	it.untilDate = it.untilDate.AddDate(0, 0, -7)
+
+	return nil
+}
+
+// fetchWeek fetches and parses the activities of the week starting at
+// weekStart
+func (it *ActivityIterator) fetchWeek(ctx context.Context, weekStart time.Time) ([]ActivityInfo, error) {
+	// Get the data browser page for this week
+	data, err := it.client.GetDataBrowserContext(ctx, weekStart)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse activities from HTML
-	activities, err := parseActivitiesFromHTML(data, it.untilDate, it.logger)
+	activities, err := parseActivitiesFromHTML(data, weekStart, it.logger)
 	if err != nil {
 		// Fallback to old regex method
 		ids := FindActivityIds(data)
@@ -75,19 +160,49 @@ func (it *ActivityIterator) fetchActivitiesForWeek() error {
 				ID:        id,
 				Type:      "unknown",
 				TypeEmoji: getActivityTypeEmoji("unknown", ""), // Pass empty string for HTML fallback
-				WeekStart: it.untilDate,
-				WeekEnd:   it.untilDate.AddDate(0, 0, 6),
+				WeekStart: weekStart,
+				WeekEnd:   weekStart.AddDate(0, 0, 6),
 			}
 		}
 	}
+	return activities, nil
+}
 
-	it.activities = activities
-	it.activityIndex = 0
-
-	// Move to the previous week
-	it.untilDate = it.untilDate.AddDate(0, 0, -7)
+// nextPrefetchedWeek returns the activities of the current week from the
+// background fetcher, starting it on the first call. ok is false if the
+// fetcher was stopped before it got to the week.
+func (it *ActivityIterator) nextPrefetchedWeek() (activities []ActivityInfo, ok bool, err error) {
+	if it.weeks == nil {
+		it.startPrefetch()
+	}
+	week, ok := <-it.weeks
+	return week.activities, ok, week.err
+}
 
-	return nil
+// startPrefetch fetches the weeks from untilDate back to sinceDate in the
+// background. At most prefetch weeks are held: prefetch-1 waiting in the
+// channel and one being fetched. The fetcher stops at the first error.
+func (it *ActivityIterator) startPrefetch() {
+	ctx, cancel := context.WithCancel(it.ctx)
+	weeks := make(chan weekListing, it.prefetch-1)
+	it.weeks = weeks
+	it.stopPrefetch = cancel
+
+	first, since := it.untilDate, it.sinceDate
+	go func() {
+		defer close(weeks)
+		for weekStart := first; since.IsZero() || !weekStart.Before(since); weekStart = weekStart.AddDate(0, 0, -7) {
+			activities, err := it.fetchWeek(ctx, weekStart)
+			select {
+			case weeks <- weekListing{activities: activities, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
 }
 
 // Next returns the next activity info and whether there are more activities
@@ -100,6 +215,7 @@ func (it *ActivityIterator) Next() (ActivityInfo, bool) {
 	if it.activityIndex >= len(it.activities) {
 		err := it.fetchActivitiesForWeek()
 		if err != nil {
+			it.err = err
 			it.done = true
 			return ActivityInfo{}, false
 		}
@@ -0,0 +1,245 @@
+package sw
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Weather holds the conditions Runalyze recorded for an activity
+type Weather struct {
+	TemperatureC  float64
+	HumidityPct   float64
+	DewPointC     float64
+	CloudCoverPct float64
+	PressureHPa   float64
+	WindSpeedKmh  float64
+	WindDegree    float64
+}
+
+// metric identifies what a databrowser column shows
+type metric string
+
+const (
+	metricUnknown         metric = ""
+	metricIgnored         metric = "ignored" // known, but not kept (icons, running dynamics)
+	metricDate            metric = "date"
+	metricSport           metric = "sport"
+	metricTrainingType    metric = "training_type"
+	metricDistance        metric = "distance"
+	metricDuration        metric = "duration"
+	metricPace            metric = "pace" // pace or speed, depending on the sport
+	metricAscent          metric = "ascent"
+	metricDescent         metric = "descent"
+	metricEnergy          metric = "energy"
+	metricHeartRate       metric = "heart_rate"
+	metricVO2max          metric = "vo2max"
+	metricTRIMP           metric = "trimp"
+	metricTemperature     metric = "temperature"
+	metricWeather         metric = "weather"
+	metricTitle           metric = "title"
+	metricEfficiencyIndex metric = "efficiency_index"
+)
+
+var (
+	trainingTypeRe = regexp.MustCompile(`^[A-Z][A-Za-z0-9]{0,5}$`)
+	distanceRe     = regexp.MustCompile(`^(\d[\d ]*(?:,\d+)?) km$`)
+	durationRe     = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{2})$`)
+	paceRe         = regexp.MustCompile(`^(\d+):(\d{2})/km$`)
+	speedRe        = regexp.MustCompile(`^([\d ]+(?:,\d+)?) km/h$`)
+	elevationRe    = regexp.MustCompile(`^([\d ]+) m$`)
+	energyRe       = regexp.MustCompile(`^([\d ]+) kcal$`)
+	heartRateRe    = regexp.MustCompile(`^(\d+) bpm$`)
+	temperatureRe  = regexp.MustCompile(`^(-?\d+(?:,\d+)?) °C$`)
+	decimalRe      = regexp.MustCompile(`^-?[\d ]+(?:,\d+)?$`)
+	colorRe        = regexp.MustCompile(`color:\s*([^;]+)`)
+)
+
+// weatherFields maps tooltip labels to Weather fields
+var weatherFields = map[string]func(w *Weather) *float64{
+	"Temperature": func(w *Weather) *float64 { return &w.TemperatureC },
+	"Humidity":    func(w *Weather) *float64 { return &w.HumidityPct },
+	"Dew point":   func(w *Weather) *float64 { return &w.DewPointC },
+	"Cloud Cover": func(w *Weather) *float64 { return &w.CloudCoverPct },
+	"Pressure":    func(w *Weather) *float64 { return &w.PressureHPa },
+	"Wind Speed":  func(w *Weather) *float64 { return &w.WindSpeedKmh },
+	"Wind Degree": func(w *Weather) *float64 { return &w.WindDegree },
+}
+
+// guessRowMetrics fills the metrics of a databrowser row into info when the
+// table has no header to go by. Cells are recognized by their content
+// (units, links, tooltips); see databrowserSchema for the header-aware way.
+func guessRowMetrics(s *goquery.Selection, info *ActivityInfo) {
+	info.DistanceKm = parseDistance(s)
+
+	iconCell := -1
+	s.Find("td").Each(func(i int, td *goquery.Selection) {
+		text := cellText(td)
+
+		switch {
+		case td.Find("i[class*='icons8-']").Length() > 0:
+			iconCell = i
+		case i == iconCell+1 && iconCell >= 0 && trainingTypeRe.MatchString(text):
+			// The training type ("ER", "LR", ...) follows the sport icon
+			applyMetric(info, metricTrainingType, td)
+		case td.Find(".tooltip-content").Length() > 0:
+			applyMetric(info, metricWeather, td)
+		case td.Find("a[href*='vo2max-info']").Length() > 0 && decimalRe.MatchString(text):
+			applyMetric(info, metricVO2max, td)
+		case td.Find("span[style*='color']").Length() > 0 && decimalRe.MatchString(text):
+			applyMetric(info, metricTRIMP, td)
+		case durationRe.MatchString(text) && info.Duration == 0:
+			applyMetric(info, metricDuration, td)
+		case paceRe.MatchString(text) || speedRe.MatchString(text):
+			applyMetric(info, metricPace, td)
+		case elevationRe.MatchString(text) && info.AscentM == 0:
+			// The first elevation column is the ascent
+			applyMetric(info, metricAscent, td)
+		case energyRe.MatchString(text):
+			applyMetric(info, metricEnergy, td)
+		case heartRateRe.MatchString(text):
+			applyMetric(info, metricHeartRate, td)
+		case temperatureRe.MatchString(text):
+			applyMetric(info, metricTemperature, td)
+		}
+	})
+}
+
+// applyMetric parses the cell td as metric m into info. Empty cells and
+// values that don't look like m are skipped.
+func applyMetric(info *ActivityInfo, m metric, td *goquery.Selection) {
+	text := cellText(td)
+
+	switch m {
+	case metricTrainingType:
+		info.TrainingType = text
+	case metricDistance:
+		if match := distanceRe.FindStringSubmatch(text); match != nil {
+			info.DistanceKm = parseDecimal(match[1])
+		}
+	case metricDuration:
+		if match := durationRe.FindStringSubmatch(text); match != nil {
+			info.Duration = parseClock(match[1], match[2], match[3])
+		}
+	case metricPace:
+		if match := paceRe.FindStringSubmatch(text); match != nil {
+			info.PacePerKm = parseClock("", match[1], match[2])
+		} else if match := speedRe.FindStringSubmatch(text); match != nil {
+			info.SpeedKmh = parseDecimal(match[1])
+		}
+	case metricAscent:
+		if match := elevationRe.FindStringSubmatch(text); match != nil {
+			info.AscentM = int(parseDecimal(match[1]))
+		}
+	case metricDescent:
+		if match := elevationRe.FindStringSubmatch(text); match != nil {
+			info.DescentM = int(parseDecimal(match[1]))
+		}
+	case metricEnergy:
+		if match := energyRe.FindStringSubmatch(text); match != nil {
+			info.EnergyKcal = int(parseDecimal(match[1]))
+		}
+	case metricHeartRate:
+		if match := heartRateRe.FindStringSubmatch(text); match != nil {
+			info.AvgHeartRate = int(parseDecimal(match[1]))
+		}
+	case metricVO2max:
+		if decimalRe.MatchString(text) {
+			info.VO2max = parseDecimal(text)
+		}
+	case metricTRIMP:
+		if decimalRe.MatchString(text) {
+			info.TRIMP = int(parseDecimal(text))
+			if style, ok := td.Find("span[style*='color']").Attr("style"); ok {
+				if match := colorRe.FindStringSubmatch(style); match != nil {
+					info.TRIMPColor = strings.TrimSpace(match[1])
+				}
+			}
+		}
+	case metricTemperature:
+		if match := temperatureRe.FindStringSubmatch(text); match != nil {
+			if info.Weather == nil {
+				info.Weather = &Weather{}
+			}
+			info.Weather.TemperatureC = parseDecimal(match[1])
+		}
+	case metricWeather:
+		if tooltip := td.Find(".tooltip-content"); tooltip.Length() > 0 {
+			if info.Weather == nil {
+				info.Weather = &Weather{}
+			}
+			parseWeatherTooltip(tooltip, info.Weather)
+		}
+	case metricTitle:
+		info.Title = text
+	case metricEfficiencyIndex:
+		if decimalRe.MatchString(text) {
+			info.EfficiencyIndex = parseDecimal(text)
+		}
+	}
+}
+
+// parseWeatherTooltip reads "Label: value unit" lines separated by <br>
+func parseWeatherTooltip(tooltip *goquery.Selection, w *Weather) {
+	content, _ := tooltip.Html()
+	for _, line := range lineBreakRe.Split(content, -1) {
+		line = normalizeSpaces(html.UnescapeString(tagRe.ReplaceAllString(line, "")))
+		label, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field, known := weatherFields[strings.TrimSpace(label)]
+		if !known {
+			continue
+		}
+		if number := leadingNumber(value); number != "" {
+			*field(w) = parseDecimal(number)
+		}
+	}
+}
+
+var (
+	lineBreakRe = regexp.MustCompile(`<br\s*/?>`)
+	tagRe       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// leadingNumberRe matches the number at the start of a value like "1 002 hpa"
+var leadingNumberRe = regexp.MustCompile(`^\s*(-?\d[\d ]*(?:,\d+)?)`)
+
+func leadingNumber(s string) string {
+	m := leadingNumberRe.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[1])
+}
+
+// cellText returns the text of a cell with whitespace normalized
+func cellText(td *goquery.Selection) string {
+	return normalizeSpaces(td.Text())
+}
+
+// normalizeSpaces trims and collapses whitespace, including non-breaking spaces
+func normalizeSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ") // Fields splits on non-breaking spaces too
+}
+
+// parseDecimal parses European numbers like "40,96" or "2 723"
+func parseDecimal(s string) float64 {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.Replace(s, ",", ".", 1)
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+// parseClock turns "h", "m", "s" parts of "1:02:03" into a duration
+func parseClock(h, m, s string) time.Duration {
+	hours, _ := strconv.Atoi(h)
+	minutes, _ := strconv.Atoi(m)
+	seconds, _ := strconv.Atoi(s)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+}
@@ -1,24 +1,38 @@
 package sw
 
 import (
-	"fmt"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/roessland/syncwich/pkg/errs"
 )
 
-// ActivityInfo represents information about an activity
+// ActivityInfo represents information about an activity. The metrics are
+// read from the databrowser row; those whose column is hidden or empty are
+// zero (Weather is nil).
 type ActivityInfo struct {
-	ID         string
-	Type       string
-	TypeEmoji  string
-	Date       string  // Activity date in YYYY-MM-DD format
-	DistanceKm float64 // Distance in kilometers
-	WeekStart  time.Time
-	WeekEnd    time.Time
+	ID              string
+	Type            string
+	TypeEmoji       string
+	Date            string  // Activity date in YYYY-MM-DD format
+	DistanceKm      float64 // Distance in kilometers
+	TrainingType    string  // Training type label, e.g. "ER"
+	Duration        time.Duration
+	PacePerKm       time.Duration // Set for pace-based sports
+	SpeedKmh        float64       // Set for speed-based sports (cycling)
+	AscentM         int
+	EnergyKcal      int
+	AvgHeartRate    int // Beats per minute
+	VO2max          float64
+	TRIMP           int
+	TRIMPColor      string // CSS color Runalyze uses to rate the TRIMP, e.g. "#c82222"
+	Weather         *Weather
+	DescentM        int
+	Title           string
+	EfficiencyIndex float64
+	WeekStart       time.Time
+	WeekEnd         time.Time
 }
 
 // parseActivitiesFromHTML extracts activity information from HTML content
@@ -34,6 +48,20 @@ func parseActivitiesFromHTML(htmlContent []byte, weekStart time.Time, logger int
 	// Create a detector for type detection
 	detector := NewActivityTypeDetector()
 
+	// Map columns by the table header when there is one. Header labels are
+	// only known in English, so a header none of whose labels is known
+	// (another UI language) is ignored and the cells are guessed.
+	schema := parseDatabrowserSchema(doc)
+	if schema != nil {
+		columns, unknown := schema.layoutReport()
+		if debugLogger, ok := logger.(interface{ Debug(string, ...any) }); ok {
+			debugLogger.Debug("databrowser layout", "columns", strings.Join(columns, " "), "unknown_columns", strings.Join(unknown, " "), "header_known", schema.headerKnown)
+		}
+		if !schema.headerKnown {
+			schema = nil
+		}
+	}
+
 	// Track current date for activities that don't show date (same day as previous)
 	var currentDate string
 
@@ -66,9 +94,6 @@ func parseActivitiesFromHTML(htmlContent []byte, weekStart time.Time, logger int
 			currentDate = activityDate
 		}
 
-		// Extract distance from the row
-		distanceKm := parseDistance(s)
-
 		// Find the activity type icon/class. Prefer icons8-* icons (the
 		// dedicated activity type sprite); otherwise fall back to the first
 		// generic icon class. We skip fa-heart-pulse since that's the health
@@ -104,35 +129,33 @@ func parseActivitiesFromHTML(htmlContent []byte, weekStart time.Time, logger int
 			}
 		}
 
-		activities = append(activities, ActivityInfo{
-			ID:         activityID,
-			Type:       activityType,
-			TypeEmoji:  emoji,
-			Date:       activityDate,
-			DistanceKm: distanceKm,
-			WeekStart:  weekStart,
-			WeekEnd:    weekEnd,
-		})
+		info := ActivityInfo{
+			ID:        activityID,
+			Type:      activityType,
+			TypeEmoji: emoji,
+			Date:      activityDate,
+			WeekStart: weekStart,
+			WeekEnd:   weekEnd,
+		}
+		if schema != nil {
+			schema.parseRow(s, &info)
+		} else {
+			guessRowMetrics(s, &info)
+		}
+		activities = append(activities, info)
 	})
 
 	return activities, nil
 }
 
-// parseDistance extracts distance in km from an activity row
-// Handles European format like "6,5 km" or "18,6 km"
+// parseDistance extracts distance in km from an activity row without a
+// table header to go by. Handles European format like "6,5 km" or "18,6 km"
+// but not speeds like "18,7 km/h".
 func parseDistance(s *goquery.Selection) float64 {
-	// Match "6,5 km" but NOT "18,7 km/h" (speed)
-	distanceRe := regexp.MustCompile(`(\d+)[,.](\d+)\s*km$`)
-
 	var distance float64
 	s.Find("td").Each(func(i int, td *goquery.Selection) {
-		// Replace non-breaking space with regular space and trim
-		text := strings.TrimSpace(strings.ReplaceAll(td.Text(), "\u00a0", " "))
-		if matches := distanceRe.FindStringSubmatch(text); matches != nil {
-			// Parse "6,5" as 6.5
-			whole := matches[1]
-			decimal := matches[2]
-			errs.Check2(fmt.Sscanf(whole+"."+decimal, "%f", &distance))
+		if match := distanceRe.FindStringSubmatch(cellText(td)); match != nil {
+			distance = parseDecimal(match[1])
 		}
 	})
 	return distance
@@ -1,6 +1,7 @@
 package sw
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -23,22 +24,22 @@ func NewAuthService(client RunalyzeClient, logger Logger) *AuthService {
 
 // EnsureAuthenticated ensures the client is authenticated and ready to use
 // It will attempt to verify the session and login if necessary
-func (a *AuthService) EnsureAuthenticated() error {
+func (a *AuthService) EnsureAuthenticated(ctx context.Context) error {
 	a.logger.Debug("attempting to verify login")
 
 	// Try to get data to verify login
-	_, err := a.client.GetDataBrowser(time.Now())
+	_, err := a.client.GetDataBrowserContext(ctx, time.Now())
 	if err != nil {
 		// If we got redirected to login, try to login and retry
 		if errors.Is(err, runalyze.ErrRedirectedToLogin) {
 			a.logger.Info("attempting login")
 
-			if err := a.client.Login(); err != nil {
+			if err := a.client.LoginContext(ctx); err != nil {
 				return err
 			}
 
 			// Retry getting data after successful login
-			_, err = a.client.GetDataBrowser(time.Now())
+			_, err = a.client.GetDataBrowserContext(ctx, time.Now())
 			if err != nil {
 				return err
 			}
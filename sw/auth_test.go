@@ -1,6 +1,7 @@
 package sw
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -15,7 +16,7 @@ func TestAuthService_EnsureAuthenticated_AlreadyLoggedIn(t *testing.T) {
 	authService := NewAuthService(mockClient, mockLogger)
 
 	// Act
-	err := authService.EnsureAuthenticated()
+	err := authService.EnsureAuthenticated(context.Background())
 
 	// Assert
 	if err != nil {
@@ -57,7 +58,7 @@ func TestAuthService_EnsureAuthenticated_NeedsLogin(t *testing.T) {
 	authService := NewAuthService(mockClient, mockLogger)
 
 	// Act
-	err := authService.EnsureAuthenticated()
+	err := authService.EnsureAuthenticated(context.Background())
 
 	// Assert
 	if err != nil {
@@ -103,7 +104,7 @@ func TestAuthService_EnsureAuthenticated_LoginFails(t *testing.T) {
 	authService := NewAuthService(mockClient, mockLogger)
 
 	// Act
-	err := authService.EnsureAuthenticated()
+	err := authService.EnsureAuthenticated(context.Background())
 
 	// Assert
 	if err == nil {
@@ -135,7 +136,7 @@ func TestAuthService_EnsureAuthenticated_BrowserErrorAfterLogin(t *testing.T) {
 	authService := NewAuthService(mockClient, mockLogger)
 
 	// Act
-	err := authService.EnsureAuthenticated()
+	err := authService.EnsureAuthenticated(context.Background())
 
 	// Assert
 	if err == nil {
@@ -160,7 +161,7 @@ func TestAuthService_EnsureAuthenticated_NonRedirectError(t *testing.T) {
 	authService := NewAuthService(mockClient, mockLogger)
 
 	// Act
-	err := authService.EnsureAuthenticated()
+	err := authService.EnsureAuthenticated(context.Background())
 
 	// Assert
 	if err == nil {
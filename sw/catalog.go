@@ -0,0 +1,392 @@
+package sw
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultCatalogPath is where the activity catalog is kept unless
+// catalog_path is configured
+const DefaultCatalogPath = "~/.syncwich/catalog.jsonl"
+
+// CatalogEntry is everything syncwich knows about an activity it synced
+// into a save directory
+type CatalogEntry struct {
+	SaveDir     string                   `json:"save_dir"`
+	Activity    CatalogActivity          `json:"activity"`
+	Exports     map[string]CatalogExport `json:"exports"` // by export format
+	FirstSynced time.Time                `json:"first_synced"`
+	LastSynced  time.Time                `json:"last_synced"`
+	// Fingerprint is the ActivityFingerprint of the activity when its
+	// exports were last downloaded
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Tombstoned is when the activity was found deleted upstream
+	Tombstoned *time.Time `json:"tombstoned,omitempty"`
+	Trashed    bool       `json:"trashed,omitempty"`
+}
+
+// Date returns the date of the activity, or the start of the week it was
+// listed in if the databrowser showed no date
+func (e *CatalogEntry) Date() string {
+	if e.Activity.Date != "" {
+		return e.Activity.Date
+	}
+	return e.Activity.WeekStart.Format("2006-01-02")
+}
+
+// CatalogActivity is the ActivityInfo of an activity as the catalog
+// stores it
+type CatalogActivity struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	TypeEmoji       string          `json:"type_emoji,omitempty"`
+	Date            string          `json:"date,omitempty"`
+	DistanceKm      float64         `json:"distance_km,omitempty"`
+	TrainingType    string          `json:"training_type,omitempty"`
+	Duration        time.Duration   `json:"duration,omitempty"`
+	PacePerKm       time.Duration   `json:"pace_per_km,omitempty"`
+	SpeedKmh        float64         `json:"speed_kmh,omitempty"`
+	AscentM         int             `json:"ascent_m,omitempty"`
+	EnergyKcal      int             `json:"energy_kcal,omitempty"`
+	AvgHeartRate    int             `json:"avg_heart_rate,omitempty"`
+	VO2max          float64         `json:"vo2max,omitempty"`
+	TRIMP           int             `json:"trimp,omitempty"`
+	TRIMPColor      string          `json:"trimp_color,omitempty"`
+	Weather         *CatalogWeather `json:"weather,omitempty"`
+	DescentM        int             `json:"descent_m,omitempty"`
+	Title           string          `json:"title,omitempty"`
+	EfficiencyIndex float64         `json:"efficiency_index,omitempty"`
+	WeekStart       time.Time       `json:"week_start"`
+	WeekEnd         time.Time       `json:"week_end"`
+}
+
+// CatalogWeather is the Weather of an activity as the catalog stores it
+type CatalogWeather struct {
+	TemperatureC  float64 `json:"temperature_c"`
+	HumidityPct   float64 `json:"humidity_pct,omitempty"`
+	DewPointC     float64 `json:"dew_point_c,omitempty"`
+	CloudCoverPct float64 `json:"cloud_cover_pct,omitempty"`
+	PressureHPa   float64 `json:"pressure_hpa,omitempty"`
+	WindSpeedKmh  float64 `json:"wind_speed_kmh,omitempty"`
+	WindDegree    float64 `json:"wind_degree,omitempty"`
+}
+
+// newCatalogActivity converts an ActivityInfo for the catalog
+func newCatalogActivity(a ActivityInfo) CatalogActivity {
+	var weather *CatalogWeather
+	if a.Weather != nil {
+		w := CatalogWeather(*a.Weather)
+		weather = &w
+	}
+	return CatalogActivity{
+		ID:              a.ID,
+		Type:            a.Type,
+		TypeEmoji:       a.TypeEmoji,
+		Date:            a.Date,
+		DistanceKm:      a.DistanceKm,
+		TrainingType:    a.TrainingType,
+		Duration:        a.Duration,
+		PacePerKm:       a.PacePerKm,
+		SpeedKmh:        a.SpeedKmh,
+		AscentM:         a.AscentM,
+		EnergyKcal:      a.EnergyKcal,
+		AvgHeartRate:    a.AvgHeartRate,
+		VO2max:          a.VO2max,
+		TRIMP:           a.TRIMP,
+		TRIMPColor:      a.TRIMPColor,
+		Weather:         weather,
+		DescentM:        a.DescentM,
+		Title:           a.Title,
+		EfficiencyIndex: a.EfficiencyIndex,
+		WeekStart:       a.WeekStart,
+		WeekEnd:         a.WeekEnd,
+	}
+}
+
+// ActivityInfo converts the stored activity back
+func (a CatalogActivity) ActivityInfo() ActivityInfo {
+	var weather *Weather
+	if a.Weather != nil {
+		w := Weather(*a.Weather)
+		weather = &w
+	}
+	return ActivityInfo{
+		ID:              a.ID,
+		Type:            a.Type,
+		TypeEmoji:       a.TypeEmoji,
+		Date:            a.Date,
+		DistanceKm:      a.DistanceKm,
+		TrainingType:    a.TrainingType,
+		Duration:        a.Duration,
+		PacePerKm:       a.PacePerKm,
+		SpeedKmh:        a.SpeedKmh,
+		AscentM:         a.AscentM,
+		EnergyKcal:      a.EnergyKcal,
+		AvgHeartRate:    a.AvgHeartRate,
+		VO2max:          a.VO2max,
+		TRIMP:           a.TRIMP,
+		TRIMPColor:      a.TRIMPColor,
+		Weather:         weather,
+		DescentM:        a.DescentM,
+		Title:           a.Title,
+		EfficiencyIndex: a.EfficiencyIndex,
+		WeekStart:       a.WeekStart,
+		WeekEnd:         a.WeekEnd,
+	}
+}
+
+// CatalogExport is a downloaded export of an activity. Size and SHA256 are
+// unknown for files that were on disk before the catalog existed.
+type CatalogExport struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Downloaded time.Time `json:"downloaded,omitzero"`
+}
+
+// Catalog is the local record of every synced activity and its exports,
+// kept as JSON Lines with one entry per line. Updates are appended, so an
+// interrupted run loses nothing; the last line of an activity wins.
+// Compact rewrites the file with one line per activity.
+//
+// One file holds the entries of every save directory. A Catalog only
+// shows those of the save directory it was opened for, so archives in
+// other directories don't count as downloaded.
+type Catalog struct {
+	fs      FileSystem
+	path    string // empty keeps the catalog in memory
+	saveDir string
+	entries map[string]*CatalogEntry // of saveDir, by activity ID
+	other   map[string]*CatalogEntry // of other save directories, kept when compacting
+	lines   int                      // lines in the file, to tell when compacting pays off
+}
+
+// OpenCatalog reads the entries of saveDir from the catalog at path
+// through fs. A missing file is an empty catalog.
+func OpenCatalog(fs FileSystem, path, saveDir string) (*Catalog, error) {
+	c := NewMemoryCatalog(saveDir)
+	c.fs, c.path = fs, path
+
+	data, err := fs.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry CatalogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("failed to read catalog %s: %w", path, err)
+		}
+		if entry.SaveDir == c.saveDir {
+			c.entries[entry.Activity.ID] = &entry
+		} else {
+			c.other[entry.SaveDir+"\x00"+entry.Activity.ID] = &entry
+		}
+		c.lines++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// NewMemoryCatalog returns an empty catalog for saveDir that isn't saved
+// anywhere, e.g. for replaying a cassette without touching the real one
+func NewMemoryCatalog(saveDir string) *Catalog {
+	if abs, err := filepath.Abs(saveDir); err == nil {
+		saveDir = abs
+	}
+	return &Catalog{
+		saveDir: saveDir,
+		entries: make(map[string]*CatalogEntry),
+		other:   make(map[string]*CatalogEntry),
+	}
+}
+
+// Path returns the file the catalog is stored in
+func (c *Catalog) Path() string {
+	return c.path
+}
+
+// SaveDir returns the save directory whose entries the catalog shows
+func (c *Catalog) SaveDir() string {
+	return c.saveDir
+}
+
+// Get returns the entry of an activity, or nil if it was never synced
+func (c *Catalog) Get(activityID string) *CatalogEntry {
+	return c.entries[activityID]
+}
+
+// Export returns the catalogued export of an activity in format
+func (c *Catalog) Export(activityID, format string) (CatalogExport, bool) {
+	entry := c.entries[activityID]
+	if entry == nil {
+		return CatalogExport{}, false
+	}
+	export, ok := entry.Exports[format]
+	return export, ok
+}
+
+// Entries returns every entry of the save directory, newest activity first
+func (c *Catalog) Entries() []*CatalogEntry {
+	entries := make([]*CatalogEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sortCatalogEntries(entries)
+	return entries
+}
+
+// sortCatalogEntries sorts entries by save directory, then newest activity
+// first
+func sortCatalogEntries(entries []*CatalogEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.SaveDir != b.SaveDir:
+			return a.SaveDir < b.SaveDir
+		case a.Activity.Date != b.Activity.Date:
+			return a.Activity.Date > b.Activity.Date
+		}
+		return a.Activity.ID > b.Activity.ID
+	})
+}
+
+// Record stores the latest metadata of activity and the exports in
+// results that are on disk, and appends the entry to the catalog file. The
+// activity fingerprint is only updated once every format group succeeded
+// or isn't available at all, so a failed re-download is tried again on the
+// next run. An activity that shows up again loses its tombstone.
+func (c *Catalog) Record(activity ActivityInfo, results []DownloadResult, now time.Time) error {
+	entry := c.entries[activity.ID]
+	if entry == nil {
+		entry = &CatalogEntry{SaveDir: c.saveDir, FirstSynced: now, Exports: make(map[string]CatalogExport)}
+	}
+	entry.Activity = newCatalogActivity(activity)
+	entry.LastSynced = now
+	entry.Tombstoned = nil
+	entry.Trashed = false
+
+	complete := true
+	for _, result := range results {
+		if !result.Success && result.FileType != "NONE" {
+			complete = false
+		}
+	}
+	if complete {
+		entry.Fingerprint = ActivityFingerprint(activity)
+	}
+
+	for _, result := range results {
+		if !result.Success || result.FilePath == "" {
+			continue
+		}
+		export := CatalogExport{Path: result.FilePath, Size: result.Size, SHA256: result.SHA256}
+		if previous, ok := entry.Exports[result.Format]; ok && result.SHA256 == "" && previous.Path == result.FilePath {
+			export = previous // existed; keep what we know about it
+		}
+		if result.SHA256 != "" && !result.Existed {
+			export.Downloaded = now
+		}
+		entry.Exports[result.Format] = export
+	}
+	c.entries[activity.ID] = entry
+
+	return c.append(entry)
+}
+
+// MoveExport records that the export of an activity in format now is at
+// path. Activities that were never synced are left out.
+func (c *Catalog) MoveExport(activityID, format, path string, now time.Time) error {
+	entry := c.entries[activityID]
+	if entry == nil {
+		return nil
+	}
+	export := entry.Exports[format]
+	export.Path = path
+	if entry.Exports == nil {
+		entry.Exports = make(map[string]CatalogExport)
+	}
+	entry.Exports[format] = export
+	entry.LastSynced = now
+	return c.append(entry)
+}
+
+// Tombstone marks an activity as deleted upstream, keeping the time it was
+// first noticed
+func (c *Catalog) Tombstone(activityID string, trashed bool, now time.Time) error {
+	entry := c.entries[activityID]
+	if entry == nil {
+		return nil
+	}
+	if entry.Tombstoned == nil {
+		entry.Tombstoned = &now
+	}
+	entry.Trashed = trashed
+	return c.append(entry)
+}
+
+// append writes entry as a new line at the end of the catalog file
+func (c *Catalog) append(entry *CatalogEntry) error {
+	if c.path == "" {
+		return nil
+	}
+	if err := c.fs.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := c.fs.AppendFile(c.path, append(line, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to append to catalog: %w", err)
+	}
+	c.lines++
+	return nil
+}
+
+// Compact rewrites the catalog file with one line per activity. It does
+// nothing if the file has no superseded lines.
+func (c *Catalog) Compact() error {
+	if c.path == "" || c.lines <= len(c.entries)+len(c.other) {
+		return nil
+	}
+
+	entries := c.Entries()
+	for _, entry := range c.other {
+		entries = append(entries, entry)
+	}
+	sortCatalogEntries(entries[len(c.entries):])
+
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := c.fs.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to compact catalog: %w", err)
+	}
+	c.lines = len(entries)
+	return nil
+}
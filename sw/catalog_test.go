@@ -0,0 +1,147 @@
+package sw
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/pkg/errs"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+func TestCatalog_RecordAndReopen(t *testing.T) {
+	fs := NewMockFileSystem()
+	path := "/home/.syncwich/catalog.jsonl"
+	catalog, err := OpenCatalog(fs, path, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Date(2025, 6, 1, 7, 0, 0, 0, time.UTC)
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26", DistanceKm: 10, Weather: &Weather{TemperatureC: -3}}
+	results := []DownloadResult{{ActivityID: "12345", Success: true, Format: "fit-original", FilePath: "/a/12345.fit", Size: 3, SHA256: "abc"}}
+	if err := catalog.Record(activity, results, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run finds the file on disk and corrects the distance
+	activity.DistanceKm = 9.2
+	existed := []DownloadResult{{ActivityID: "12345", Success: true, Format: "fit-original", FilePath: "/a/12345.fit", Existed: true}}
+	if err := catalog.Record(activity, existed, first.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenCatalog(fs, path, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := reopened.Get("12345")
+	if entry == nil {
+		t.Fatal("entry missing after reopening")
+	}
+	if info := entry.Activity.ActivityInfo(); info.Weather == nil || info.Weather.TemperatureC != -3 {
+		t.Errorf("Weather = %+v, want -3 °C", info.Weather)
+	}
+	if entry.Activity.DistanceKm != 9.2 || !entry.FirstSynced.Equal(first) || !entry.LastSynced.Equal(first.Add(24*time.Hour)) {
+		t.Errorf("entry = %+v", entry)
+	}
+	if export := entry.Exports["fit-original"]; export.SHA256 != "abc" || !export.Downloaded.Equal(first) {
+		t.Errorf("export = %+v, want the hash of the first download kept", export)
+	}
+
+	if err := reopened.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(fs.Files[path]), "\n"); lines != 1 {
+		t.Errorf("compacted catalog has %d lines, want 1", lines)
+	}
+}
+
+// Each save directory only sees its own entries, and compacting keeps
+// those of the others
+func TestCatalog_SeparatesSaveDirs(t *testing.T) {
+	fs := NewMockFileSystem()
+	path := "/home/.syncwich/catalog.jsonl"
+	now := time.Date(2025, 6, 1, 7, 0, 0, 0, time.UTC)
+	for _, saveDir := range []string{"/a", "/b"} {
+		catalog, err := OpenCatalog(fs, path, saveDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := []DownloadResult{{ActivityID: "1", Success: true, Format: "fit-original", FilePath: saveDir + "/1.fit", Size: 3, SHA256: "abc"}}
+		for range 2 {
+			if err := catalog.Record(ActivityInfo{ID: "1"}, results, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	catalog, err := OpenCatalog(fs, path, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(fs.Files[path]), "\n"); lines != 2 {
+		t.Errorf("compacted catalog has %d lines, want one per save directory", lines)
+	}
+	for _, saveDir := range []string{"/a", "/b"} {
+		catalog, err := OpenCatalog(fs, path, saveDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if export, ok := catalog.Export("1", "fit-original"); !ok || export.Path != saveDir+"/1.fit" {
+			t.Errorf("%s: export = %+v, %v", saveDir, export, ok)
+		}
+	}
+}
+
+func TestDownloadActivity_CatalogFindsEarlierLayout(t *testing.T) {
+	mockClient := &MockRunalyzeClient{FitData: []byte("fit")}
+	mockFS := NewMockFileSystem()
+	catalog := NewMemoryCatalog("/tmp/activities")
+	service := NewDownloadService(mockClient, mockFS, &MockLogger{})
+	service.SetCatalog(catalog)
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26"}
+
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+	if !result.Success || result.Existed {
+		t.Fatalf("first download: %+v", result)
+	}
+
+	// A new layout puts the export elsewhere; the catalog still finds it
+	service.SetLayout(errs.Check2(ParseLayout("{year}/{id}.{ext}")))
+	again := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+	if !again.Existed || again.FilePath != result.FilePath || len(mockClient.ExportCalls) != 1 {
+		t.Errorf("catalogued export fetched again: %+v, calls %v", again, mockClient.ExportCalls)
+	}
+
+	// Deleted locally: downloaded again where the layout puts it now
+	delete(mockFS.Files, result.FilePath)
+	again = singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+	if again.Existed || again.FilePath != "/tmp/activities/2025/12345.fit" || len(mockClient.ExportCalls) != 2 {
+		t.Errorf("deleted export not downloaded again: %+v, calls %v", again, mockClient.ExportCalls)
+	}
+}
+
+// A catalog path outside the save directory, e.g. from a catalog opened
+// for another directory, doesn't count
+func TestDownloadActivity_CatalogPathOutsideSaveDir(t *testing.T) {
+	mockClient := &MockRunalyzeClient{FitData: []byte("fit")}
+	mockFS := NewMockFileSystem()
+	mockFS.Files["/elsewhere/12345.fit"] = []byte("fit")
+	catalog := NewMemoryCatalog("/tmp/activities")
+	results := []DownloadResult{{ActivityID: "12345", Success: true, Format: runalyze.FitFormat, FilePath: "/elsewhere/12345.fit"}}
+	if err := catalog.Record(ActivityInfo{ID: "12345"}, results, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	service := NewDownloadService(mockClient, mockFS, &MockLogger{})
+	service.SetCatalog(catalog)
+
+	result := singleResult(t, service.DownloadActivity(context.Background(), ActivityInfo{ID: "12345"}, "/tmp/activities"))
+	if result.Existed || result.FilePath != "/tmp/activities/12345.fit" {
+		t.Errorf("result = %+v, want a download into the save directory", result)
+	}
+}
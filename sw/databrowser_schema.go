@@ -0,0 +1,140 @@
+package sw
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// headerMetrics maps databrowser header tooltips (falling back to the
+// header label) to the metric the column shows. Runalyze lets users pick
+// and order the columns, so the header is the only reliable way to tell
+// e.g. average from maximum heart rate.
+var headerMetrics = map[string]metric{
+	"Activity type":          metricTrainingType,
+	"Distance":               metricDistance,
+	"Duration":               metricDuration,
+	"Pace":                   metricPace,
+	"Speed":                  metricPace,
+	"Ascent":                 metricAscent,
+	"Descent":                metricDescent,
+	"Energy":                 metricEnergy,
+	"avg. Heart rate":        metricHeartRate,
+	"Effective VO2max":       metricVO2max,
+	"TRIMP":                  metricTRIMP,
+	"Temperature":            metricTemperature,
+	"Title":                  metricTitle,
+	"Efficiency Index":       metricEfficiencyIndex,
+	"Ground contact time":    metricIgnored,
+	"Vertical oscillation":   metricIgnored,
+	"Ground contact balance": metricIgnored,
+}
+
+// iconMetrics identify the columns without a header label by what their
+// cells contain
+var iconMetrics = []struct {
+	selector string
+	metric   metric
+}{
+	{"a[href*='/health/note/']", metricDate},
+	{"i[class*='icons8-']", metricSport},
+	{".tooltip-content", metricWeather},
+	{"i.vo2max-icon", metricIgnored},
+	{"i.fa-wrench", metricIgnored},
+}
+
+// databrowserSchema is the column layout of a databrowser table
+type databrowserSchema struct {
+	metrics []metric
+	labels  []string // header label per column, "" for icon columns
+	content []bool   // whether any row had text or markup in the column
+	// headerKnown is whether any header label or tooltip is in
+	// headerMetrics; it isn't when Runalyze's UI is in another language
+	headerKnown bool
+}
+
+// parseDatabrowserSchema reads the column layout from the table header.
+// It returns nil if the page has no header.
+func parseDatabrowserSchema(doc *goquery.Document) *databrowserSchema {
+	header := doc.Find("thead tr").First()
+	if header.Length() == 0 {
+		return nil
+	}
+
+	schema := &databrowserSchema{}
+	header.Children().Each(func(i int, cell *goquery.Selection) {
+		label := normalizeSpaces(cell.Find("span.truncate").First().Text())
+		tip, _ := cell.Find("[data-tip]").First().Attr("data-tip")
+
+		m, ok := headerMetrics[normalizeSpaces(tip)]
+		if !ok {
+			m, ok = headerMetrics[label]
+		}
+		schema.headerKnown = schema.headerKnown || ok
+		if label == "" {
+			label = normalizeSpaces(tip)
+		}
+
+		// A header cell can span several columns
+		span := 1
+		if colspan, ok := cell.Attr("colspan"); ok {
+			fmt.Sscanf(colspan, "%d", &span)
+		}
+		for j := 0; j < max(span, 1); j++ {
+			schema.metrics = append(schema.metrics, m)
+			schema.labels = append(schema.labels, label)
+		}
+	})
+	schema.content = make([]bool, len(schema.metrics))
+
+	// Identify unlabeled columns by their cells
+	doc.Find("tr[data-activity-id]").Each(func(_ int, row *goquery.Selection) {
+		row.Children().Each(func(i int, td *goquery.Selection) {
+			if i >= len(schema.metrics) {
+				return
+			}
+			if inner, _ := td.Html(); strings.TrimSpace(inner) != "" {
+				schema.content[i] = true
+			}
+			if schema.metrics[i] != metricUnknown || schema.labels[i] != "" {
+				return
+			}
+			for _, icon := range iconMetrics {
+				if td.Find(icon.selector).Length() > 0 {
+					schema.metrics[i] = icon.metric
+					return
+				}
+			}
+		})
+	})
+
+	return schema
+}
+
+// parseRow fills the metrics of a row into info by column
+func (schema *databrowserSchema) parseRow(s *goquery.Selection, info *ActivityInfo) {
+	s.Children().Each(func(i int, td *goquery.Selection) {
+		if i < len(schema.metrics) {
+			applyMetric(info, schema.metrics[i], td)
+		}
+	})
+}
+
+// layoutReport describes how each column was mapped, and lists the columns
+// that weren't, so users with a custom column setup can see what's parsed
+func (schema *databrowserSchema) layoutReport() (columns, unknown []string) {
+	for i, m := range schema.metrics {
+		label := schema.labels[i]
+		if label == "" {
+			label = "(no header)"
+		}
+		switch {
+		case m != metricUnknown:
+			columns = append(columns, fmt.Sprintf("%d:%s=%s", i, label, m))
+		case schema.labels[i] != "" || schema.content[i]:
+			unknown = append(unknown, fmt.Sprintf("%d:%s", i, label))
+		}
+	}
+	return columns, unknown
+}
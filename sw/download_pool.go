@@ -0,0 +1,79 @@
+package sw
+
+import (
+	"context"
+	"sync"
+)
+
+// activityDownload is an activity handed to a download worker
+type activityDownload struct {
+	activity ActivityInfo
+	results  chan []DownloadResult // receives the results once downloaded
+}
+
+// downloadEach downloads every activity iter yields and calls done with
+// the results of each, in the order iter yielded them. With a concurrency
+// above 1 the downloads run on that many workers while done is called from
+// the calling goroutine. It stops if ctx is cancelled; the activities that
+// were in flight are not passed to done.
+func (ds *DownloadService) downloadEach(ctx context.Context, iter *ActivityIterator, saveDir string, done func(activity ActivityInfo, results []DownloadResult)) {
+	if ds.concurrency <= 1 {
+		for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
+			results := ds.DownloadActivity(ctx, activity, saveDir)
+			if ctx.Err() != nil {
+				return
+			}
+			done(activity, results)
+		}
+		return
+	}
+
+	// Every activity handed to a worker is also queued in pending, which
+	// keeps iteration order. Its buffer bounds how far the listing runs
+	// ahead of the oldest download that hasn't been passed to done.
+	jobs := make(chan *activityDownload)
+	pending := make(chan *activityDownload, ds.concurrency)
+
+	var workers sync.WaitGroup
+	for range ds.concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				job.results <- ds.DownloadActivity(ctx, job.activity, saveDir)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
+			job := &activityDownload{activity: activity, results: make(chan []DownloadResult, 1)}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for job := range pending {
+		results := <-job.results
+		if ctx.Err() != nil {
+			break
+		}
+		done(job.activity, results)
+	}
+
+	// Once the listing and the workers have stopped, iter and the state
+	// they update are safe to read
+	for range pending {
+	}
+	workers.Wait()
+}
@@ -1,155 +1,407 @@
 package sw
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/roessland/syncwich/pkg/errs"
+	"github.com/roessland/syncwich/runalyze"
 )
 
 // DownloadService handles the core download logic without presentation concerns
 type DownloadService struct {
-	client RunalyzeClient
-	fs     FileSystem
-	logger Logger
+	client     RunalyzeClient
+	fs         FileSystem
+	logger     Logger
+	formats    []FormatGroup
+	layout     Layout
+	progress   DownloadProgressFunc
+	catalog    *Catalog
+	tombstones *TombstoneService
+	now        func() time.Time
+
+	concurrency int
+	mu          sync.Mutex // guards catalog and tombstones while workers download
 }
 
+// DownloadProgressFunc reports the bytes of an export received so far.
+// total is -1 when the size isn't known.
+type DownloadProgressFunc func(activity ActivityInfo, format string, written, total int64)
+
 // NewDownloadService creates a new download service
 func NewDownloadService(client RunalyzeClient, fs FileSystem, logger Logger) *DownloadService {
 	return &DownloadService{
-		client: client,
-		fs:     fs,
-		logger: logger,
+		client:      client,
+		fs:          fs,
+		logger:      logger,
+		formats:     errs.Check2(ParseFormats(DefaultFormats)),
+		layout:      errs.Check2(ParseLayout(DefaultLayout)),
+		now:         time.Now,
+		concurrency: 1,
 	}
 }
 
-// DownloadActivity downloads a single activity and returns structured results
-func (ds *DownloadService) DownloadActivity(activity ActivityInfo, saveDir string) DownloadResult {
-	fitPath := filepath.Join(saveDir, activity.ID+".fit")
-	tcxPath := filepath.Join(saveDir, activity.ID+".tcx")
+// SetFormats sets the export formats to download for each activity (optional).
+// Defaults to DefaultFormats.
+func (ds *DownloadService) SetFormats(formats []FormatGroup) {
+	ds.formats = formats
+}
 
-	// Check if either file already exists
-	if ds.fs.Exists(fitPath) {
-		return DownloadResult{
-			ActivityID: activity.ID,
-			Success:    true,
-			FileType:   "FIT",
-			FilePath:   fitPath,
-			Existed:    true,
+// SetLayout sets where exports are saved in the save directory (optional).
+// Defaults to DefaultLayout.
+func (ds *DownloadService) SetLayout(layout Layout) {
+	ds.layout = layout
+}
+
+// SetProgress sets a callback for byte-level download progress (optional).
+// It is called from the download workers, so with a concurrency above 1 it
+// must be safe for concurrent use.
+func (ds *DownloadService) SetProgress(progress DownloadProgressFunc) {
+	ds.progress = progress
+}
+
+// SetCatalog sets the activity catalog (optional). Downloads are recorded
+// in it, and exports it lists are found wherever the layout they were saved
+// under put them. Activities whose fingerprint changed upstream since are
+// downloaded again, keeping the earlier exports in VersionsDir. It should
+// be opened for the save directory downloads go to.
+func (ds *DownloadService) SetCatalog(catalog *Catalog) {
+	ds.catalog = catalog
+}
+
+// SetConcurrency sets how many activities are downloaded at once
+// (optional). Defaults to 1. Every worker shares the client, and with it
+// the client's rate limit.
+func (ds *DownloadService) SetConcurrency(concurrency int) {
+	ds.concurrency = max(concurrency, 1)
+}
+
+// SetTombstones enables detection of activities deleted upstream (optional)
+func (ds *DownloadService) SetTombstones(tombstones *TombstoneService) {
+	ds.tombstones = tombstones
+}
+
+// DownloadActivity downloads every configured export format of a single
+// activity and returns one result per format group
+func (ds *DownloadService) DownloadActivity(ctx context.Context, activity ActivityInfo, saveDir string) []DownloadResult {
+	ds.logger.Debug("processing activity", "activity_id", activity.ID, "type", activity.Type)
+
+	ds.mu.Lock()
+	changed := ds.catalog != nil && ds.catalog.changedUpstream(activity)
+	ds.mu.Unlock()
+	if changed {
+		ds.logger.Info("activity changed upstream, downloading again", "activity_id", activity.ID)
+	}
+
+	results := make([]DownloadResult, 0, len(ds.formats))
+	for _, group := range ds.formats {
+		var stats runalyze.RequestStats
+		result := ds.downloadFormatGroup(runalyze.WithRequestStats(ctx, &stats), activity, group, saveDir, changed)
+		result.Attempts = stats.Attempts
+		if result.Error != nil {
+			result.Transient = runalyze.IsTransient(result.Error)
+		}
+		results = append(results, result)
+		if ctx.Err() != nil {
+			break
 		}
 	}
-	if ds.fs.Exists(tcxPath) {
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.catalog != nil && ctx.Err() == nil {
+		if err := ds.catalog.Record(activity, results, ds.now()); err != nil {
+			ds.logger.Warn("failed to record activity in catalog", "activity_id", activity.ID, "error", err)
+		}
+	}
+	return results
+}
+
+// watchRemoteDeletes makes iter compare every week it fetches with the
+// catalog, collecting activities deleted upstream into tombstones
+func (ds *DownloadService) watchRemoteDeletes(iter *ActivityIterator, tombstones *[]Tombstone) {
+	if ds.tombstones == nil {
+		return
+	}
+	iter.SetWeekFunc(func(weekStart time.Time, activities []ActivityInfo) {
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		*tombstones = append(*tombstones, ds.tombstones.CheckWeek(weekStart, activities)...)
+	})
+}
+
+// saveState compacts the catalog, if there is one. Every update is already
+// appended, so a failure is logged rather than failing the run.
+func (ds *DownloadService) saveState() {
+	if ds.catalog != nil {
+		if err := ds.catalog.Compact(); err != nil {
+			ds.logger.Warn("failed to compact catalog", "error", err)
+		}
+	}
+}
+
+// downloadFormatGroup downloads the first available format of a group. If
+// the activity changed upstream, a format already on disk is downloaded
+// again.
+func (ds *DownloadService) downloadFormatGroup(ctx context.Context, activity ActivityInfo, group FormatGroup, saveDir string, changed bool) DownloadResult {
+	// Any format of the group already on disk satisfies it
+	for _, format := range group {
+		path, ok := ds.existingExport(activity, format, saveDir)
+		if !ok {
+			continue
+		}
+		if changed {
+			return ds.redownload(ctx, activity, format, path, ds.layout.Path(saveDir, activity, format), saveDir)
+		}
 		return DownloadResult{
 			ActivityID: activity.ID,
 			Success:    true,
-			FileType:   "TCX",
-			FilePath:   tcxPath,
+			Format:     format,
+			FileType:   formatLabel(format),
+			FilePath:   path,
 			Existed:    true,
 		}
 	}
 
-	// Try to download FIT file first
-	fitData, _, err := ds.client.GetFit(activity.ID)
-	if err != nil {
-		// Check if it's a 404 error
-		if isNotFoundError(err) {
-			// FIT failed, try TCX
-			tcxData, _, err := ds.client.GetTcx(activity.ID)
-			if err != nil {
-				if isNotFoundError(err) {
-					// Neither available
-					return DownloadResult{
-						ActivityID: activity.ID,
-						Success:    false,
-						FileType:   "NONE",
-						Error:      fmt.Errorf("neither FIT nor TCX available for activity %s", activity.ID),
-					}
-				}
-				// Other TCX error
-				return DownloadResult{
-					ActivityID: activity.ID,
-					Success:    false,
-					FileType:   "TCX",
-					Error:      fmt.Errorf("failed to download TCX file for activity %s: %w", activity.ID, err),
-				}
-			}
+	// Try each format in preference order, moving on only when it's missing
+	for _, format := range group {
+		result, notFound := ds.fetchExport(ctx, activity, format, ds.layout.Path(saveDir, activity, format))
+		if notFound {
+			ds.logger.Debug("export format not available", "activity_id", activity.ID, "format", format)
+			continue
+		}
+		return result
+	}
 
-			// Save TCX file
-			if err := ds.fs.WriteFile(tcxPath, tcxData, 0644); err != nil {
-				return DownloadResult{
-					ActivityID: activity.ID,
-					Success:    false,
-					FileType:   "TCX",
-					Error:      fmt.Errorf("failed to save TCX file for activity %s: %w", activity.ID, err),
-				}
-			}
+	// None of the group's formats exist for this activity
+	return DownloadResult{
+		ActivityID: activity.ID,
+		Success:    false,
+		Format:     group.String(),
+		FileType:   "NONE",
+		Error:      fmt.Errorf("no %s export available for activity %s", groupLabel(group), activity.ID),
+	}
+}
 
-			return DownloadResult{
-				ActivityID: activity.ID,
-				Success:    true,
-				FileType:   "TCX",
-				FilePath:   tcxPath,
-			}
+// existingExport returns where the export of activity in format already
+// is. The catalog is asked first, so exports saved under an earlier layout
+// or with metadata that has changed since are found. Its path only counts
+// if the file is still there, inside saveDir; otherwise, and for exports
+// that predate the catalog, the export is looked for where the layout puts
+// it.
+func (ds *DownloadService) existingExport(activity ActivityInfo, format, saveDir string) (string, bool) {
+	if ds.catalog != nil {
+		ds.mu.Lock()
+		export, ok := ds.catalog.Export(activity.ID, format)
+		ds.mu.Unlock()
+		if ok && withinDir(saveDir, export.Path) && ds.fs.Exists(export.Path) {
+			return export.Path, true
 		}
+	}
+	path := ds.layout.Path(saveDir, activity, format)
+	return path, ds.fs.Exists(path)
+}
 
-		// Other FIT error
+// fetchExport streams an export of activity to path. notFound is true if
+// Runalyze has no export in that format, in which case nothing is written.
+func (ds *DownloadService) fetchExport(ctx context.Context, activity ActivityInfo, format, path string) (result DownloadResult, notFound bool) {
+	label := formatLabel(format)
+
+	var progress runalyze.ProgressFunc
+	if ds.progress != nil {
+		progress = func(written, total int64) {
+			ds.progress(activity, format, written, total)
+		}
+	}
+
+	// Stream straight to disk, hashing on the way; fetchErr tells download
+	// failures apart from failures to save
+	var fetchErr error
+	hash := sha256.New()
+	var size int64
+	err := ds.fs.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ds.fs.WriteFileFrom(path, 0644, func(w io.Writer) error {
+			counter := &countingWriter{w: io.MultiWriter(w, hash)}
+			_, fetchErr = ds.client.StreamExportContext(ctx, activity.ID, format, counter, progress)
+			size = counter.n
+			return fetchErr
+		})
+	}
+	if fetchErr != nil {
+		if isNotFoundError(fetchErr) {
+			return DownloadResult{}, true
+		}
 		return DownloadResult{
 			ActivityID: activity.ID,
 			Success:    false,
-			FileType:   "FIT",
-			Error:      fmt.Errorf("failed to download FIT file for activity %s: %w", activity.ID, err),
-		}
+			Format:     format,
+			FileType:   label,
+			Error:      fmt.Errorf("failed to download %s file for activity %s: %w", label, activity.ID, fetchErr),
+		}, false
 	}
-
-	// Save FIT file
-	if err := ds.fs.WriteFile(fitPath, fitData, 0644); err != nil {
+	if err != nil {
 		return DownloadResult{
 			ActivityID: activity.ID,
 			Success:    false,
-			FileType:   "FIT",
-			Error:      fmt.Errorf("failed to save FIT file for activity %s: %w", activity.ID, err),
-		}
+			Format:     format,
+			FileType:   label,
+			Error:      fmt.Errorf("failed to save %s file for activity %s: %w", label, activity.ID, err),
+		}, false
 	}
 
 	return DownloadResult{
 		ActivityID: activity.ID,
 		Success:    true,
-		FileType:   "FIT",
-		FilePath:   fitPath,
+		Format:     format,
+		FileType:   label,
+		FilePath:   path,
+		Size:       size,
+		SHA256:     hex.EncodeToString(hash.Sum(nil)),
+	}, false
+}
+
+// redownload downloads an export at path again after its activity changed
+// upstream, saving it at newPath, where the layout now puts it. The file at
+// path is moved to VersionsDir first. It is moved back if the download
+// fails, and moved to newPath if the download turns out identical to it.
+func (ds *DownloadService) redownload(ctx context.Context, activity ActivityInfo, format, path, newPath, saveDir string) DownloadResult {
+	label := formatLabel(format)
+	previous := versionPath(saveDir, activity.ID, path, ds.now())
+	if err := ds.fs.MkdirAll(filepath.Dir(previous), 0755); err != nil {
+		return DownloadResult{
+			ActivityID: activity.ID,
+			Success:    false,
+			Format:     format,
+			FileType:   label,
+			Error:      fmt.Errorf("failed to create versions directory: %w", err),
+		}
+	}
+	if err := ds.fs.Rename(path, previous); err != nil {
+		return DownloadResult{
+			ActivityID: activity.ID,
+			Success:    false,
+			Format:     format,
+			FileType:   label,
+			Error:      fmt.Errorf("failed to keep earlier version of %s: %w", path, err),
+		}
+	}
+
+	result, notFound := ds.fetchExport(ctx, activity, format, newPath)
+	ds.mu.Lock()
+	old, known := ds.catalog.Export(activity.ID, format)
+	ds.mu.Unlock()
+	unchanged := result.Success && known && old.SHA256 != "" && old.Size == result.Size && old.SHA256 == result.SHA256
+	restore := ""
+	switch {
+	case notFound || !result.Success:
+		restore = path
+	case unchanged:
+		restore = newPath
+	}
+	if restore != "" {
+		if err := ds.fs.Rename(previous, restore); err != nil {
+			ds.logger.Warn("failed to restore earlier version", "activity_id", activity.ID, "path", previous, "error", err)
+		}
+	}
+
+	switch {
+	case notFound:
+		// Runalyze dropped the format; keep what we have
+		return DownloadResult{
+			ActivityID: activity.ID,
+			Success:    true,
+			Format:     format,
+			FileType:   label,
+			FilePath:   path,
+			Existed:    true,
+		}
+	case !result.Success:
+		return result
+	case unchanged:
+		result.Existed = true
+		return result
+	}
+
+	ds.logger.Info("export changed upstream, kept earlier version", "activity_id", activity.ID, "format", format, "previous", previous)
+	result.Updated = true
+	result.PreviousPath = previous
+	return result
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// groupLabel joins the labels of a group's formats, e.g. "FIT/TCX"
+func groupLabel(group FormatGroup) string {
+	labels := make([]string, len(group))
+	for i, format := range group {
+		labels[i] = formatLabel(format)
 	}
+	return strings.Join(labels, "/")
 }
 
-// DownloadActivities downloads multiple activities and returns a summary
-func (ds *DownloadService) DownloadActivities(iter *ActivityIterator, saveDir string) (*DownloadSummary, error) {
+// DownloadActivities downloads multiple activities and returns a summary.
+// If ctx is cancelled the summary covers the activities finished so far and
+// is marked as interrupted.
+func (ds *DownloadService) DownloadActivities(ctx context.Context, iter *ActivityIterator, saveDir string) (*DownloadSummary, error) {
 	// Ensure save directory exists
 	if err := ds.fs.MkdirAll(saveDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create save directory: %w", err)
 	}
 
 	var results []DownloadResult
+	var tombstones []Tombstone
 	processedCount := 0
 	errorCount := 0
+	retryableCount := 0
+	iter.SetContext(ctx)
+	ds.watchRemoteDeletes(iter, &tombstones)
 
-	// Download all activities
-	for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
-		ds.logger.Debug("processing activity", "activity_id", activity.ID, "type", activity.Type)
-
-		result := ds.DownloadActivity(activity, saveDir)
-		results = append(results, result)
+	// Download all activities. An activity whose download was aborted by
+	// ctx isn't passed on, so it doesn't count as a failure.
+	ds.downloadEach(ctx, iter, saveDir, func(activity ActivityInfo, activityResults []DownloadResult) {
+		results = append(results, activityResults...)
 
 		processedCount++
-		if !result.Success {
-			errorCount++
+		for _, result := range activityResults {
+			if !result.Success {
+				errorCount++
+			}
+			if result.Retryable() {
+				retryableCount++
+			}
 		}
+	})
 
-		// Small delay to be nice to the server
-		if !result.Existed {
-			time.Sleep(300 * time.Millisecond)
-		}
-	}
+	ds.saveState()
 
-	return &DownloadSummary{
-		Processed: processedCount,
-		Errors:    errorCount,
-		Results:   results,
-	}, nil
+	summary := &DownloadSummary{
+		Processed:   processedCount,
+		Errors:      errorCount,
+		Retryable:   retryableCount,
+		Results:     results,
+		Interrupted: ctx.Err() != nil,
+		Tombstones:  tombstones,
+	}
+	if err := iter.Err(); err != nil && !summary.Interrupted {
+		return summary, err
+	}
+	return summary, nil
 }
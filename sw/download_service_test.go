@@ -1,11 +1,28 @@
 package sw
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
+
+	"github.com/roessland/syncwich/runalyze"
 )
 
+// singleResult unwraps the result of a download with the default single
+// format group
+func singleResult(t *testing.T, results []DownloadResult) DownloadResult {
+	t.Helper()
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	return results[0]
+}
+
 func TestDownloadActivity_HappyPath_FIT(t *testing.T) {
 	// Arrange
 	mockClient := &MockRunalyzeClient{
@@ -19,7 +36,7 @@ func TestDownloadActivity_HappyPath_FIT(t *testing.T) {
 	saveDir := "/tmp/activities"
 
 	// Act
-	result := service.DownloadActivity(activity, saveDir)
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, saveDir))
 
 	// Assert
 	if !result.Success {
@@ -60,7 +77,7 @@ func TestDownloadActivity_FallbackToTCX(t *testing.T) {
 	saveDir := "/tmp/activities"
 
 	// Act
-	result := service.DownloadActivity(activity, saveDir)
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, saveDir))
 
 	// Assert
 	if !result.Success {
@@ -98,7 +115,7 @@ func TestDownloadActivity_FileAlreadyExists_FIT(t *testing.T) {
 	activity := ActivityInfo{ID: "12345", Type: "running"}
 
 	// Act
-	result := service.DownloadActivity(activity, "/tmp/activities")
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
 
 	// Assert
 	if !result.Success {
@@ -131,7 +148,7 @@ func TestDownloadActivity_FileAlreadyExists_TCX(t *testing.T) {
 	activity := ActivityInfo{ID: "12345", Type: "running"}
 
 	// Act
-	result := service.DownloadActivity(activity, "/tmp/activities")
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
 
 	// Assert
 	if !result.Success {
@@ -158,7 +175,7 @@ func TestDownloadActivity_NeitherFormatAvailable(t *testing.T) {
 	activity := ActivityInfo{ID: "12345", Type: "manual"}
 
 	// Act
-	result := service.DownloadActivity(activity, "/tmp/activities")
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
 
 	// Assert
 	if result.Success {
@@ -189,7 +206,7 @@ func TestDownloadActivity_FITDownloadError(t *testing.T) {
 	activity := ActivityInfo{ID: "12345", Type: "running"}
 
 	// Act
-	result := service.DownloadActivity(activity, "/tmp/activities")
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
 
 	// Assert
 	if result.Success {
@@ -216,7 +233,7 @@ func TestDownloadActivity_FileSaveError(t *testing.T) {
 	activity := ActivityInfo{ID: "12345", Type: "running"}
 
 	// Act
-	result := service.DownloadActivity(activity, "/tmp/activities")
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
 
 	// Assert
 	if result.Success {
@@ -229,3 +246,193 @@ func TestDownloadActivity_FileSaveError(t *testing.T) {
 		t.Error("Expected error on file save failure")
 	}
 }
+
+func TestDownloadActivity_ContextCancelled(t *testing.T) {
+	// Arrange - context is already cancelled, so no export should be fetched
+	mockClient := &MockRunalyzeClient{
+		FitData: []byte("fake fit data"),
+	}
+	mockFS := NewMockFileSystem()
+	mockLogger := &MockLogger{}
+	service := NewDownloadService(mockClient, mockFS, mockLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	activity := ActivityInfo{ID: "12345", Type: "running"}
+
+	// Act
+	result := singleResult(t, service.DownloadActivity(ctx, activity, "/tmp/activities"))
+
+	// Assert
+	if result.Success {
+		t.Error("Expected failure when context is cancelled")
+	}
+	if !errors.Is(result.Error, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", result.Error)
+	}
+	if len(mockFS.WriteCalls) != 0 {
+		t.Errorf("Expected no write calls, got %d", len(mockFS.WriteCalls))
+	}
+}
+
+func TestDownloadActivity_RecordsAttemptsAndFailureKind(t *testing.T) {
+	tests := []struct {
+		name          string
+		fitError      error
+		tcxError      error
+		wantAttempts  int
+		wantTransient bool
+	}{
+		{
+			name:          "WAF 502 is transient",
+			fitError:      createBadGatewayError(),
+			wantAttempts:  1,
+			wantTransient: true,
+		},
+		{
+			name:          "missing exports are permanent",
+			fitError:      createNotFoundError(),
+			tcxError:      createNotFoundError(),
+			wantAttempts:  2,
+			wantTransient: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockRunalyzeClient{FitError: tt.fitError, TcxError: tt.tcxError}
+			service := NewDownloadService(mockClient, NewMockFileSystem(), &MockLogger{})
+
+			result := singleResult(t, service.DownloadActivity(context.Background(), ActivityInfo{ID: "12345"}, "/tmp/activities"))
+
+			if result.Success {
+				t.Fatal("Expected failure")
+			}
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", result.Attempts, tt.wantAttempts)
+			}
+			if result.Transient != tt.wantTransient {
+				t.Errorf("Transient = %v, want %v", result.Transient, tt.wantTransient)
+			}
+		})
+	}
+}
+
+func TestDownloadResult_Retryable(t *testing.T) {
+	diskFull := &os.PathError{Op: "write", Path: "/tmp/activities/1.fit", Err: syscall.ENOSPC}
+	tests := []struct {
+		name   string
+		result DownloadResult
+		want   bool
+	}{
+		{"success", DownloadResult{Success: true}, false},
+		{"no format of the group", DownloadResult{FileType: "NONE", Error: errors.New("no FIT/TCX export available")}, false},
+		{"permanent 404", DownloadResult{FileType: "FIT", Error: createNotFoundError()}, false},
+		{"parse failure", DownloadResult{FileType: "FIT", Error: errors.New("unexpected response")}, false},
+		{"WAF 502", DownloadResult{FileType: "FIT", Error: createBadGatewayError(), Transient: true}, true},
+		{"expired session", DownloadResult{FileType: "FIT", Error: fmt.Errorf("export: %w", runalyze.ErrRedirectedToLogin)}, true},
+		{"disk full", DownloadResult{FileType: "FIT", Error: fmt.Errorf("failed to save FIT file: %w", diskFull)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.Retryable(); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadActivity_MultipleFormats(t *testing.T) {
+	// Arrange - FIT exists locally, GPX downloads, CSV is missing upstream
+	mockClient := &MockRunalyzeClient{
+		Exports: map[string][]byte{"gpx": []byte("fake gpx data")},
+	}
+	mockFS := NewMockFileSystem()
+	mockFS.Files[filepath.Join("/tmp/activities", "12345.fit")] = []byte("existing fit")
+	service := NewDownloadService(mockClient, mockFS, &MockLogger{})
+
+	formats, err := ParseFormats("fit-original|tcx,gpx,csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.SetFormats(formats)
+
+	// Act
+	results := service.DownloadActivity(context.Background(), ActivityInfo{ID: "12345"}, "/tmp/activities")
+
+	// Assert
+	if len(results) != 3 {
+		t.Fatalf("Expected one result per format group, got %d", len(results))
+	}
+
+	fit, gpx, csv := results[0], results[1], results[2]
+	if !fit.Existed || fit.Format != "fit-original" || fit.FileType != "FIT" {
+		t.Errorf("FIT result = %+v, want existing fit-original", fit)
+	}
+	if !gpx.Success || gpx.Existed || gpx.FileType != "GPX" {
+		t.Errorf("GPX result = %+v, want fresh GPX download", gpx)
+	}
+	if want := filepath.Join("/tmp/activities", "12345.gpx"); gpx.FilePath != want {
+		t.Errorf("GPX path = %s, want %s", gpx.FilePath, want)
+	}
+	if csv.Success || csv.FileType != "NONE" || csv.Format != "csv" {
+		t.Errorf("CSV result = %+v, want unavailable", csv)
+	}
+
+	// The existing FIT must not be fetched again
+	for _, call := range mockClient.ExportCalls {
+		if call == "fit-original" || call == "tcx" {
+			t.Errorf("Unexpected export request for %s", call)
+		}
+	}
+}
+
+func TestDownloadActivity_ReportsProgress(t *testing.T) {
+	mockClient := &MockRunalyzeClient{
+		FitData: []byte("fake fit data"),
+	}
+	service := NewDownloadService(mockClient, NewMockFileSystem(), &MockLogger{})
+
+	var formats []string
+	var lastWritten, lastTotal int64
+	service.SetProgress(func(activity ActivityInfo, format string, written, total int64) {
+		if activity.ID != "12345" {
+			t.Errorf("progress for activity %s, want 12345", activity.ID)
+		}
+		formats = append(formats, format)
+		lastWritten, lastTotal = written, total
+	})
+
+	result := singleResult(t, service.DownloadActivity(context.Background(), ActivityInfo{ID: "12345"}, "/tmp/activities"))
+	if !result.Success {
+		t.Fatalf("Expected success, got failure: %v", result.Error)
+	}
+	if len(formats) == 0 || formats[0] != "fit-original" {
+		t.Fatalf("Expected FIT progress, got %v", formats)
+	}
+	if lastWritten != 13 || lastTotal != 13 {
+		t.Errorf("Expected final progress 13/13, got %d/%d", lastWritten, lastTotal)
+	}
+}
+
+// A download that fails halfway must not leave a partial file behind
+func TestOSFileSystem_WriteFileFrom_RemovesPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "1.fit")
+	fs := NewOSFileSystem()
+
+	err := fs.WriteFileFrom(path, 0644, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return errors.New("connection reset")
+	})
+	if err == nil {
+		t.Fatal("Expected the write error to be returned")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected no files after a failed download, got %d", len(entries))
+	}
+}
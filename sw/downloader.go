@@ -1,7 +1,9 @@
 package sw
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
@@ -9,49 +11,107 @@ import (
 	"github.com/roessland/syncwich/runalyze"
 )
 
-// DownloadConfig holds all configuration needed for downloading activities
-type DownloadConfig struct {
+// ClientConfig holds what every command needs to talk to Runalyze
+type ClientConfig struct {
+	BaseURL    string // Runalyze instance; empty means runalyze.DefaultBaseURL
 	Username   string
 	Password   string
 	CookiePath string
-	UntilStr   string
-	SinceStr   string
-	SaveDir    string
-	JSONMode   bool
+	// CookieStore selects where the session is kept: "file" (default),
+	// "encrypted" or "memory"; see NewCookieStore
+	CookieStore       string
+	PassphraseCommand string
+	RateLimit         runalyze.RateLimit
+	RetryPolicy       runalyze.RetryPolicy // zero means runalyze.DefaultRetryPolicy
+	UnsafeTrace       bool                 // disables redaction of secrets in trace logs
+	// RecordDir records all HTTP traffic to a cassette directory; ReplayDir
+	// replays one offline. See runalyze.WithCassette.
+	RecordDir string
+	ReplayDir string
+}
+
+// DownloadConfig holds all configuration needed for downloading activities
+type DownloadConfig struct {
+	ClientConfig
+	UntilStr string
+	SinceStr string
+	SaveDir  string
+	Formats  string // export format preference list, see ParseFormats
+	Layout   string // where exports are saved, see ParseLayout
+	// CatalogPath is the activity catalog file; empty means
+	// DefaultCatalogPath
+	CatalogPath string
+	// SinceLastOverlap is how far before the high-water mark --since last
+	// starts; zero means DefaultSinceLastOverlap
+	SinceLastOverlap time.Duration
+	// OnRemoteDelete says what to do with local files of activities deleted
+	// in Runalyze, see ParseRemoteDeleteMode
+	OnRemoteDelete string
+	// PrefetchWeeks is how many databrowser weeks are fetched ahead of the
+	// week being downloaded; zero fetches each week when it is reached
+	PrefetchWeeks int
+	// Concurrency is how many activities are downloaded at once; zero
+	// means 1
+	Concurrency int
+	JSONMode    bool
 }
 
 // isNotFoundError checks if the error indicates a 404 Not Found response
 func isNotFoundError(err error) bool {
-	if err == nil {
-		return false
-	}
-	// Check if the error message contains status code 404
-	return fmt.Sprintf("%v", err) == "unexpected status code: 404"
+	return runalyze.IsNotFound(err)
 }
 
-// Download performs the main download orchestration using the new service-based architecture
-func Download(config DownloadConfig) error {
-	// 1. Validate and parse dates
-	since, until, err := ValidateAndParseDates(config.UntilStr, config.SinceStr)
+// Download performs the main download orchestration using the new service-based architecture.
+// Cancelling ctx (Ctrl-C, a deadline) aborts the in-flight request; the
+// activities finished so far are still summarized before ctx.Err() is returned.
+func Download(ctx context.Context, config DownloadConfig) error {
+	// 1. Validate and parse dates. --since last is resolved once the sync
+	// state is loaded.
+	sinceStr := config.SinceStr
+	if sinceStr == SinceLast {
+		sinceStr = ""
+	}
+	since, until, err := ValidateAndParseDates(config.UntilStr, sinceStr)
 	if err != nil {
 		return err
 	}
 
+	formats, err := ParseFormats(config.Formats)
+	if err != nil {
+		return err
+	}
+
+	layout, err := ParseLayout(config.Layout)
+	if err != nil {
+		return err
+	}
+
+	remoteDeleteMode, err := ParseRemoteDeleteMode(config.OnRemoteDelete)
+	if err != nil {
+		return err
+	}
+	if config.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d", config.Concurrency)
+	}
+	if config.PrefetchWeeks < 0 {
+		return fmt.Errorf("invalid prefetch weeks %d", config.PrefetchWeeks)
+	}
+
 	// 2. Setup dependencies
-	_, logger, presentation, err := setupDependencies(config)
+	ol, logger, presentation, err := setupDependencies(config.JSONMode)
 	if err != nil {
 		return err
 	}
 
 	// 3. Validate credentials
-	if err := validateCredentials(config); err != nil {
+	if err := validateCredentials(config.ClientConfig); err != nil {
 		return err
 	}
 
-	logger.Info("starting download process", "username", config.Username)
+	logger.Info("starting download process", "username", config.Username, "formats", config.Formats)
 
 	// 4. Create and authenticate client
-	client, err := createAndAuthenticateClient(config, logger, presentation)
+	client, err := createAndAuthenticateClient(ctx, config.ClientConfig, ol, logger, presentation)
 	if err != nil {
 		return err
 	}
@@ -59,6 +119,14 @@ func Download(config DownloadConfig) error {
 	// 5. Setup services
 	fs := NewOSFileSystem()
 	downloadService := NewDownloadService(client, fs, logger)
+	downloadService.SetFormats(formats)
+	downloadService.SetLayout(layout)
+	downloadService.SetConcurrency(config.Concurrency)
+	if config.Concurrency <= 1 {
+		// Progress redraws one activity line in place, which only works
+		// while one activity downloads at a time
+		downloadService.SetProgress(presentation.ShowDownloadProgress)
+	}
 
 	// 6. Prepare download directory
 	expandedSaveDir, err := prepareDownloadDirectory(config.SaveDir, fs, presentation)
@@ -66,18 +134,71 @@ func Download(config DownloadConfig) error {
 		return err
 	}
 
+	catalog := NewMemoryCatalog(expandedSaveDir)
+	if config.ReplayDir == "" || config.CatalogPath != "" {
+		// A replay only gets a catalog file if one is given, so it doesn't
+		// fill the real one with activities that aren't in Runalyze
+		catalog, err = openCatalog(fs, config.CatalogPath, expandedSaveDir)
+		if err != nil {
+			presentation.ShowError(err, "Failed to open activity catalog")
+			return err
+		}
+	}
+	downloadService.SetCatalog(catalog)
+	downloadService.SetTombstones(NewTombstoneService(fs, logger, expandedSaveDir, catalog, remoteDeleteMode))
+
+	// A replay starts from an empty sync state and doesn't save it, so it
+	// neither follows nor moves the high-water mark of the save directory
+	syncState := &SyncState{}
+	if config.ReplayDir == "" {
+		syncState, err = LoadSyncState(fs, filepath.Join(expandedSaveDir, SyncStateFile))
+		if err != nil {
+			presentation.ShowError(err, "Failed to load sync state")
+			return err
+		}
+	}
+	if config.SinceStr == SinceLast {
+		since = resolveSinceLast(syncState, since, until, config.SinceLastOverlap, logger, presentation)
+	}
+
 	// 7. Download activities
-	summary, err := downloadActivities(client, downloadService, presentation, since, until, expandedSaveDir, logger)
+	summary, err := downloadActivities(ctx, client, downloadService, presentation, since, until, config.PrefetchWeeks, expandedSaveDir, logger)
 	if err != nil {
 		return err
 	}
 
-	// 8. Show final results
+	// 8. Move the high-water mark unless a later run could get something
+	// this one missed. Exports Runalyze doesn't have never will be.
+	if config.ReplayDir == "" && !summary.Interrupted && summary.Retryable == 0 && summary.ListError == nil {
+		syncState.Advance(since, until, time.Now())
+		if err := syncState.Save(fs); err != nil {
+			logger.Warn("failed to save sync state", "error", err)
+		}
+	}
+
+	// 9. Show final results
 	summary.Since = since
 	summary.Until = until
 	presentation.ShowFinalResults(summary)
 	presentation.ShowJSONResults(summary, config.JSONMode)
 
+	if summary.Interrupted {
+		logger.Warn("download interrupted",
+			"processed", summary.Processed,
+			"errors", summary.Errors,
+			"reason", ctx.Err())
+		return fmt.Errorf("download interrupted: %w", ctx.Err())
+	}
+
+	if summary.ListError != nil {
+		// Exit non-zero so cron jobs notice, e.g. an expired session
+		logger.Warn("download stopped early",
+			"processed", summary.Processed,
+			"errors", summary.Errors,
+			"error", summary.ListError)
+		return fmt.Errorf("failed to fetch activity list: %w", summary.ListError)
+	}
+
 	logger.Info("download completed",
 		"processed", summary.Processed,
 		"errors", summary.Errors)
@@ -85,9 +206,35 @@ func Download(config DownloadConfig) error {
 	return nil
 }
 
+// resolveSinceLast returns where a --since last run starts, warning when
+// the previous complete run is longer ago than usual. Without one it falls
+// back to defaultSince.
+func resolveSinceLast(state *SyncState, defaultSince, until time.Time, overlap time.Duration, logger Logger, presentation *PresentationService) time.Time {
+	if overlap <= 0 {
+		overlap = DefaultSinceLastOverlap
+	}
+	since, ok := state.Since(until, overlap)
+	if !ok {
+		presentation.ShowStatus("No previous complete run, starting from %s", defaultSince.Format("2006-01-02"))
+		return defaultSince
+	}
+
+	gap := until.Sub(state.HighWaterMark)
+	if usual := state.UsualGap(); gap > usual {
+		weeks := int(gap.Hours()/24/7 + 0.5)
+		logger.Warn("previous complete run is longer ago than usual, backfilling",
+			"high_water_mark", state.HighWaterMark.Format("2006-01-02"),
+			"gap_weeks", weeks,
+			"usual_gap_days", int(usual.Hours()/24))
+		presentation.ShowWarning("The previous complete run covered up to %s, %d weeks ago. Backfilling the gap.",
+			state.HighWaterMark.Format("2006-01-02"), weeks)
+	}
+	return since
+}
+
 // setupDependencies creates the output logger and presentation service
-func setupDependencies(config DownloadConfig) (*output.OutputLogger, Logger, *PresentationService, error) {
-	ol, err := output.New(config.JSONMode)
+func setupDependencies(jsonMode bool) (*output.OutputLogger, Logger, *PresentationService, error) {
+	ol, err := output.New(jsonMode)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to create output system: %w", err)
 	}
@@ -98,8 +245,12 @@ func setupDependencies(config DownloadConfig) (*output.OutputLogger, Logger, *Pr
 	return ol, logger, presentation, nil
 }
 
-// validateCredentials checks that username and password are provided
-func validateCredentials(config DownloadConfig) error {
+// validateCredentials checks that username and password are provided.
+// Replaying a cassette needs none, since the login is replayed too.
+func validateCredentials(config ClientConfig) error {
+	if config.ReplayDir != "" {
+		return nil
+	}
 	if config.Username == "" || config.Password == "" {
 		return fmt.Errorf("username and password must be provided via config file, environment variables, or command line flags")
 	}
@@ -107,9 +258,9 @@ func validateCredentials(config DownloadConfig) error {
 }
 
 // createAndAuthenticateClient creates a Runalyze client and ensures it's authenticated
-func createAndAuthenticateClient(config DownloadConfig, logger Logger, presentation *PresentationService) (*runalyze.Client, error) {
+func createAndAuthenticateClient(ctx context.Context, config ClientConfig, ol *output.OutputLogger, logger Logger, presentation *PresentationService) (*runalyze.Client, error) {
 	// Create client
-	client, err := runalyze.New(config.Username, config.Password, config.CookiePath)
+	client, err := newClient(config, ol)
 	if err != nil {
 		presentation.ShowError(err, "Failed to create Runalyze client")
 		return nil, err
@@ -119,7 +270,7 @@ func createAndAuthenticateClient(config DownloadConfig, logger Logger, presentat
 	presentation.ShowProgress("Verifying login credentials...")
 	authService := NewAuthService(client, logger)
 
-	if err := authService.EnsureAuthenticated(); err != nil {
+	if err := authService.EnsureAuthenticated(ctx); err != nil {
 		presentation.ShowError(err, "Failed to authenticate with Runalyze")
 		return nil, err
 	}
@@ -128,9 +279,90 @@ func createAndAuthenticateClient(config DownloadConfig, logger Logger, presentat
 	return client, nil
 }
 
+// newClient creates a Runalyze client that logs through the output system
+func newClient(config ClientConfig, ol *output.OutputLogger) (*runalyze.Client, error) {
+	storeKind := config.CookieStore
+	if config.ReplayDir != "" {
+		// Start logged out so the recorded login is replayed, and leave
+		// the real session alone.
+		storeKind = "memory"
+	}
+	store, err := NewCookieStore(storeKind, config.CookiePath, config.PassphraseCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []runalyze.Option{
+		runalyze.WithBaseURL(config.BaseURL),
+		runalyze.WithCredentials(config.Username, config.Password),
+		runalyze.WithCookieStore(store),
+		runalyze.WithSlogLogger(ol.Slog().With("component", "runalyze")),
+		runalyze.WithRateLimit(config.RateLimit),
+		runalyze.WithUnsafeTrace(config.UnsafeTrace),
+	}
+	if config.RetryPolicy != (runalyze.RetryPolicy{}) {
+		opts = append(opts, runalyze.WithRetryPolicy(config.RetryPolicy))
+	}
+	switch {
+	case config.RecordDir != "" && config.ReplayDir != "":
+		return nil, fmt.Errorf("cannot record and replay a cassette at the same time")
+	case config.RecordDir != "":
+		dir, err := homedir.Expand(config.RecordDir)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, runalyze.WithCassette(dir, runalyze.CassetteRecord))
+	case config.ReplayDir != "":
+		dir, err := homedir.Expand(config.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, runalyze.WithCassette(dir, runalyze.CassetteReplay))
+	}
+
+	return runalyze.NewClient(opts...)
+}
+
+// NewCookieStore returns the cookie store named by kind. The encrypted
+// store takes its passphrase from passphraseCommand if set, otherwise from
+// $SW_COOKIE_PASSPHRASE.
+func NewCookieStore(kind, cookiePath, passphraseCommand string) (runalyze.CookieStore, error) {
+	switch kind {
+	case "", "file":
+		return runalyze.NewFileCookieStoreAt(cookiePath)
+	case "encrypted":
+		passphrase := runalyze.PassphraseFromEnv(runalyze.PassphraseEnv)
+		if passphraseCommand != "" {
+			passphrase = runalyze.PassphraseFromCommand(passphraseCommand)
+		}
+		return runalyze.NewEncryptedFileCookieStoreAt(cookiePath, passphrase)
+	case "memory":
+		return runalyze.NewMemoryCookieStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown cookie store %q (want file, encrypted or memory)", kind)
+	}
+}
+
+// openCatalog opens the entries of saveDir in the activity catalog at path,
+// or at DefaultCatalogPath if path is empty
+func openCatalog(fs FileSystem, path, saveDir string) (*Catalog, error) {
+	if path == "" {
+		path = DefaultCatalogPath
+	}
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	return OpenCatalog(fs, expanded, saveDir)
+}
+
 // prepareDownloadDirectory expands and creates the download directory
 func prepareDownloadDirectory(saveDir string, fs FileSystem, presentation *PresentationService) (string, error) {
 	expandedSaveDir, err := homedir.Expand(saveDir)
+	if err == nil {
+		// Absolute, since the catalog keeps export paths across runs
+		expandedSaveDir, err = filepath.Abs(expandedSaveDir)
+	}
 	if err != nil {
 		presentation.ShowError(err, "Failed to expand save directory path")
 		return "", err
@@ -145,7 +377,7 @@ func prepareDownloadDirectory(saveDir string, fs FileSystem, presentation *Prese
 }
 
 // downloadActivities orchestrates the download of all activities in the date range
-func downloadActivities(client *runalyze.Client, downloadService *DownloadService, presentation *PresentationService, since, until time.Time, saveDir string, logger Logger) (*DownloadSummary, error) {
+func downloadActivities(ctx context.Context, client *runalyze.Client, downloadService *DownloadService, presentation *PresentationService, since, until time.Time, prefetchWeeks int, saveDir string, logger Logger) (*DownloadSummary, error) {
 	logger.Info("download configuration",
 		"since", since.Format("2006-01-02"),
 		"until", until.Format("2006-01-02"))
@@ -153,54 +385,71 @@ func downloadActivities(client *runalyze.Client, downloadService *DownloadServic
 	// Create an iterator starting from the specified Monday
 	iter := NewActivityIteratorWithSince(client, until, since)
 	iter.SetLogger(logger)
+	iter.SetContext(ctx)
+	iter.SetPrefetch(prefetchWeeks)
+	defer iter.Close()
 
 	presentation.ShowStatus("Downloading activities from %s to %s", since.Format("2006-01-02"), until.Format("2006-01-02"))
 
 	// Track for week headers
 	var currentWeekStart time.Time
 	var results []DownloadResult
+	var tombstones []Tombstone
 	processedCount := 0
 	errorCount := 0
+	retryableCount := 0
+	downloadService.watchRemoteDeletes(iter, &tombstones)
 
-	// Download all activities with presentation
-	for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
+	// Download all activities in every configured format. Results come
+	// back in listing order, however many workers download them; an
+	// activity whose download was aborted by ctx isn't passed on.
+	downloadService.downloadEach(ctx, iter, saveDir, func(activity ActivityInfo, activityResults []DownloadResult) {
 		// Show week header when we encounter a new week
 		if activity.WeekStart != currentWeekStart {
 			currentWeekStart = activity.WeekStart
 			presentation.ShowWeekHeader(activity.WeekStart, activity.WeekEnd)
 		}
-
-		logger.Debug("processing activity", "activity_id", activity.ID, "type", activity.Type)
-
-		// Download the activity
-		result := downloadService.DownloadActivity(activity, saveDir)
-		results = append(results, result)
-
-		// Show the result
-		presentation.ShowActivityResult(activity, result)
+		results = append(results, activityResults...)
 
 		processedCount++
-		if !result.Success {
-			errorCount++
-			errMsg := ""
-			if result.Error != nil {
-				errMsg = result.Error.Error()
+		for _, result := range activityResults {
+			// Show the result
+			presentation.ShowActivityResult(activity, result)
+
+			if !result.Success {
+				errorCount++
+				if result.Retryable() {
+					retryableCount++
+				}
+				errMsg := ""
+				if result.Error != nil {
+					errMsg = result.Error.Error()
+				}
+				logger.Warn("activity download failed",
+					"activity_id", activity.ID,
+					"format", result.Format,
+					"file_type", result.FileType,
+					"attempts", result.Attempts,
+					"transient", result.Transient,
+					"error", errMsg)
 			}
-			logger.Warn("activity download failed",
-				"activity_id", activity.ID,
-				"file_type", result.FileType,
-				"error", errMsg)
 		}
+	})
 
-		// Small delay to be nice to the server (only if we actually downloaded)
-		if !result.Existed {
-			time.Sleep(300 * time.Millisecond)
-		}
+	interrupted := ctx.Err() != nil
+	listErr := iter.Err()
+	if listErr != nil && !interrupted {
+		presentation.ShowError(listErr, "Failed to fetch activity list, stopping early")
 	}
+	downloadService.saveState()
 
 	return &DownloadSummary{
-		Processed: processedCount,
-		Errors:    errorCount,
-		Results:   results,
+		Processed:   processedCount,
+		Errors:      errorCount,
+		Retryable:   retryableCount,
+		Results:     results,
+		Interrupted: interrupted,
+		Tombstones:  tombstones,
+		ListError:   listErr,
 	}, nil
 }
@@ -0,0 +1,881 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/runalyze"
+	"github.com/roessland/syncwich/runalyze/runalyzetest"
+)
+
+// End-to-end tests against runalyzetest's fake Runalyze, going through the
+// real runalyze.Client instead of MockRunalyzeClient.
+
+var e2eMonday = time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+
+// newE2EServer serves three activities over the two weeks starting
+// e2eMonday-7d and an empty week before them
+func newE2EServer(t *testing.T) *runalyzetest.Server {
+	t.Helper()
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "301", Date: e2eMonday.Add(7 * time.Hour), Sport: "Running", DistanceKm: 6.5})
+	srv.AddActivity(runalyzetest.Activity{ID: "302", Date: e2eMonday.AddDate(0, 0, 2).Add(18 * time.Hour), Sport: "Cycling", DistanceKm: 42.3})
+	srv.AddActivity(runalyzetest.Activity{ID: "201", Date: e2eMonday.AddDate(0, 0, -5), Sport: "Swimming", DistanceKm: 1.5})
+	return srv
+}
+
+func newE2EClient(t *testing.T, srv *runalyzetest.Server) *runalyze.Client {
+	t.Helper()
+	client, err := runalyze.NewClient(
+		runalyze.WithBaseURL(srv.URL),
+		runalyze.WithCredentials(srv.Username, srv.Password),
+		runalyze.WithRateLimit(runalyze.RateLimit{}),
+		runalyze.WithRetryPolicy(runalyze.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func e2eConfig(srv *runalyzetest.Server, saveDir string) DownloadConfig {
+	return DownloadConfig{
+		ClientConfig: e2eClientConfig(srv),
+		SinceStr:     e2eMonday.AddDate(0, 0, -14).Format("2006-01-02"),
+		UntilStr:     e2eMonday.AddDate(0, 0, 6).Format("2006-01-02"),
+		SaveDir:      saveDir,
+		CatalogPath:  filepath.Join(saveDir, "catalog.jsonl"),
+		JSONMode:     true,
+	}
+}
+
+func e2eClientConfig(srv *runalyzetest.Server) ClientConfig {
+	return ClientConfig{
+		BaseURL:     srv.URL,
+		Username:    srv.Username,
+		Password:    srv.Password,
+		CookieStore: "memory",
+		RetryPolicy: runalyze.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+}
+
+func TestE2E_AuthService_LogsIn(t *testing.T) {
+	srv := newE2EServer(t)
+	auth := NewAuthService(newE2EClient(t, srv), &MockLogger{})
+
+	if err := auth.EnsureAuthenticated(context.Background()); err != nil {
+		t.Fatalf("EnsureAuthenticated: %v", err)
+	}
+	if srv.Logins() != 1 {
+		t.Errorf("Logins() = %d, want 1", srv.Logins())
+	}
+
+	// The session is reused
+	if err := auth.EnsureAuthenticated(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Logins() != 1 {
+		t.Errorf("Logins() = %d after second call, want 1", srv.Logins())
+	}
+}
+
+func TestE2E_AuthService_WrongPassword(t *testing.T) {
+	srv := newE2EServer(t)
+	client := newE2EClient(t, srv)
+	srv.Password = "changed since"
+	auth := NewAuthService(client, &MockLogger{})
+
+	err := auth.EnsureAuthenticated(context.Background())
+	if !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("err = %v, want ErrRedirectedToLogin", err)
+	}
+}
+
+func TestE2E_AuthLogin_RejectedKeepsStoredSession(t *testing.T) {
+	srv := newE2EServer(t)
+	config := AuthConfig{ClientConfig: e2eClientConfig(srv), JSONMode: true}
+	config.CookieStore = "file"
+	config.CookiePath = filepath.Join(t.TempDir(), "cookies.json")
+	ctx := context.Background()
+
+	if err := AuthLogin(ctx, config); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	stored, err := os.ReadFile(config.CookiePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A mistyped password doesn't cost the session that still works
+	config.Password = "mistyped"
+	if err := AuthLogin(ctx, config); err == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+	if after, err := os.ReadFile(config.CookiePath); err != nil || string(after) != string(stored) {
+		t.Errorf("cookie store changed by a rejected login: %v\n%s", err, after)
+	}
+	config.Password = srv.Password
+	if err := AuthWhoAmI(ctx, config); err != nil {
+		t.Errorf("whoami with the kept session: %v", err)
+	}
+}
+
+func TestE2E_ActivityIterator_WalksWeeks(t *testing.T) {
+	srv := newE2EServer(t)
+	client := newE2EClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	iter := NewActivityIteratorWithSince(client, e2eMonday, e2eMonday.AddDate(0, 0, -14))
+	var ids []string
+	for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
+		ids = append(ids, activity.ID)
+		if activity.ID == "302" && (activity.Date != "2025-05-28" || activity.DistanceKm != 42.3 || activity.TypeEmoji != "🚴") {
+			t.Errorf("activity 302 parsed as %+v", activity)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iterator error: %v", err)
+	}
+
+	want := []string{"302", "301", "201"}
+	if len(ids) != len(want) {
+		t.Fatalf("got activities %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("got activities %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestE2E_ActivityIterator_Prefetch(t *testing.T) {
+	srv := newE2EServer(t)
+	client := newE2EClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	walk := func(prefetch int) []string {
+		t.Helper()
+		iter := NewActivityIteratorWithSince(client, e2eMonday, e2eMonday.AddDate(0, 0, -14))
+		iter.SetPrefetch(prefetch)
+		defer iter.Close()
+		var ids []string
+		for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
+			ids = append(ids, activity.ID)
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatalf("prefetch %d: iterator error: %v", prefetch, err)
+		}
+		return ids
+	}
+
+	want := strings.Join(walk(0), ",")
+	for _, prefetch := range []int{1, 2, 8} {
+		if got := strings.Join(walk(prefetch), ","); got != want {
+			t.Errorf("prefetch %d: got activities %s, want %s", prefetch, got, want)
+		}
+	}
+}
+
+func TestE2E_ActivityIterator_PrefetchIsBounded(t *testing.T) {
+	srv := newE2EServer(t)
+	client := newE2EClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	weeksFetched := func() int {
+		n := 0
+		for _, r := range srv.Requests() {
+			if strings.HasSuffix(r, "/databrowser") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// A year of weeks, but only the first activity is taken
+	iter := NewActivityIteratorWithSince(client, e2eMonday, e2eMonday.AddDate(-1, 0, 0))
+	iter.SetPrefetch(2)
+	if _, ok := iter.Next(); !ok {
+		t.Fatalf("no activity: %v", iter.Err())
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := weeksFetched(); n > 3 {
+		t.Errorf("fetched %d weeks, want at most the current one and 2 ahead", n)
+	}
+
+	iter.Close()
+	for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+	}
+	if err := iter.Err(); err != nil {
+		t.Errorf("Err() after Close = %v, want nil", err)
+	}
+	if n := weeksFetched(); n > 3 {
+		t.Errorf("fetched %d weeks after Close, want at most 3", n)
+	}
+}
+
+func TestE2E_Download(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+
+	if err := Download(context.Background(), e2eConfig(srv, saveDir)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	for _, id := range []string{"301", "302", "201"} {
+		data, err := os.ReadFile(filepath.Join(saveDir, id+".fit"))
+		if err != nil {
+			t.Errorf("activity %s: %v", id, err)
+			continue
+		}
+		if string(data) != string(runalyzetest.ExportContent(id, runalyze.FitFormat)) {
+			t.Errorf("activity %s: unexpected content %q", id, data)
+		}
+	}
+
+	// A second run finds every file and downloads nothing
+	if err := Download(context.Background(), e2eConfig(srv, saveDir)); err != nil {
+		t.Fatalf("second Download: %v", err)
+	}
+	if n := srv.ExportsServed("301", runalyze.FitFormat); n != 1 {
+		t.Errorf("activity 301 FIT served %d times, want 1", n)
+	}
+}
+
+func TestE2E_Download_FallsBackToTCX(t *testing.T) {
+	srv := newE2EServer(t)
+	srv.MissingFormat(runalyze.FitFormat)
+	saveDir := t.TempDir()
+
+	if err := Download(context.Background(), e2eConfig(srv, saveDir)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "301.tcx")); err != nil {
+		t.Errorf("expected TCX fallback: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "301.fit")); err == nil {
+		t.Error("FIT file written although the server has none")
+	}
+}
+
+func TestE2E_Download_SurvivesBadGateway(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+
+	srv.BadGateway(2)
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "201.fit")); err != nil {
+		t.Errorf("expected all activities after retried 502s: %v", err)
+	}
+}
+
+// A session that expires halfway makes the remaining requests fail instead
+// of hanging or writing login pages to disk.
+func TestE2E_Download_SessionExpiresMidRun(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+
+	// Authentication check, its retry after login, the first week and one export
+	srv.ExpireSessionsAfter(4)
+	err := Download(context.Background(), e2eConfig(srv, saveDir))
+	if !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("err = %v, want runalyze.ErrRedirectedToLogin", err)
+	}
+
+	exports, _ := filepath.Glob(filepath.Join(saveDir, "*.fit"))
+	if len(exports) != 1 {
+		t.Fatalf("got %d exports, want only the one before the session expired", len(exports))
+	}
+}
+
+func TestE2E_Download_SlowServerTimesOut(t *testing.T) {
+	srv := newE2EServer(t)
+	srv.Latency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := Download(ctx, e2eConfig(srv, t.TempDir()))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestE2E_FetchActivityDetails(t *testing.T) {
+	srv := newE2EServer(t)
+	srv.AddActivity(runalyzetest.Activity{
+		ID: "303", Date: e2eMonday.AddDate(0, 0, 3).Add(6 * time.Hour), Sport: "Running",
+		DistanceKm: 12.4, Duration: 58*time.Minute + 7*time.Second,
+		Title: "Tempo", Notes: "Felt good", TrainingType: "Tempo run", Equipment: []string{"Pegasus 40"},
+	})
+	srv.MissingFormat("kml")
+	client := newE2EClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := FetchActivityDetails(context.Background(), client, "303")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Title != "Tempo" || details.Notes != "Felt good" || details.Sport != "Running" || details.TrainingType != "Tempo run" {
+		t.Errorf("Unexpected details: %+v", details)
+	}
+	if details.DistanceKm != 12.4 || details.Duration != 58*time.Minute+7*time.Second {
+		t.Errorf("DistanceKm, Duration = %v, %v", details.DistanceKm, details.Duration)
+	}
+	if len(details.Equipment) != 1 || details.Equipment[0] != "Pegasus 40" {
+		t.Errorf("Equipment = %v", details.Equipment)
+	}
+	for _, format := range details.ExportFormats {
+		if format == "kml" {
+			t.Errorf("ExportFormats = %v, should not offer kml", details.ExportFormats)
+		}
+	}
+
+	if _, err := FetchActivityDetails(context.Background(), client, "999"); !runalyze.IsNotFound(err) {
+		t.Errorf("Expected a not found error for an unknown activity, got %v", err)
+	}
+}
+
+func TestE2E_DownloadHealth(t *testing.T) {
+	srv := newE2EServer(t)
+	srv.AddHealthNote(runalyzetest.HealthNote{Date: e2eMonday, RestingHeartRate: 47, WeightKg: 71.8, SleepMinutes: 440, HRV: 64, Notes: "Rested"})
+	saveDir := t.TempDir()
+
+	config := HealthConfig{
+		ClientConfig: e2eClientConfig(srv),
+		SinceStr:     e2eMonday.Format("2006-01-02"),
+		UntilStr:     e2eMonday.AddDate(0, 0, 6).Format("2006-01-02"),
+		SaveDir:      saveDir,
+		JSONMode:     true,
+	}
+	if err := DownloadHealth(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	timeline, err := OpenHealthTimeline(filepath.Join(saveDir, "health.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days := timeline.Days(); len(days) != 1 || days[0] != "2025-05-26" {
+		t.Errorf("Days = %v, want only the day with a note", days)
+	}
+	data, err := os.ReadFile(timeline.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.SplitN(string(data), "\n", 2)[0]
+	if first != `{"date":"2025-05-26","resting_hr":47,"weight_kg":71.8,"sleep_minutes":440,"hrv_ms":64,"notes":"Rested"}` {
+		t.Errorf("Unexpected first line %s", first)
+	}
+
+	// Only the empty days are fetched again
+	requests := len(srv.Requests())
+	if err := DownloadHealth(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	fetched := 0
+	for _, r := range srv.Requests()[requests:] {
+		if strings.HasSuffix(r, "/health/note/2025-05-26") {
+			t.Errorf("Unexpected request %s on the second run", r)
+		}
+		if strings.Contains(r, "/health/note/") {
+			fetched++
+		}
+	}
+	if fetched != 6 {
+		t.Errorf("second run fetched %d days, want the 6 empty ones", fetched)
+	}
+}
+
+func TestE2E_SyncEquipment(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "301", Date: e2eMonday.Add(7 * time.Hour), Sport: "Running", DistanceKm: 12.5, Equipment: []string{"Pegasus 40"}})
+	srv.AddActivity(runalyzetest.Activity{ID: "302", Date: e2eMonday.AddDate(0, 0, 2), Sport: "Cycling", DistanceKm: 42.3, Equipment: []string{"Gravel bike"}})
+	srv.AddEquipment(runalyzetest.Equipment{ID: "12", Name: "Pegasus 40", Category: "Shoes", DistanceKm: 795.5, Since: e2eMonday.AddDate(-1, 0, 0)})
+	srv.AddEquipment(runalyzetest.Equipment{ID: "3", Name: "Gravel bike", Category: "Bikes", DistanceKm: 4210, Since: e2eMonday.AddDate(-2, 0, 0)})
+	saveDir := t.TempDir()
+
+	config := EquipmentConfig{
+		ClientConfig: e2eClientConfig(srv),
+		SinceStr:     e2eMonday.Format("2006-01-02"),
+		UntilStr:     e2eMonday.AddDate(0, 0, 6).Format("2006-01-02"),
+		SaveDir:      saveDir,
+		JSONMode:     true,
+	}
+	if err := SyncEquipment(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := LoadEquipmentInventory(NewOSFileSystem(), filepath.Join(saveDir, EquipmentFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Equipment) != 2 || inv.Equipment[0].Name != "Pegasus 40" || !inv.Equipment[0].IsShoe() {
+		t.Errorf("Equipment = %+v", inv.Equipment)
+	}
+	if got := inv.Activities["301"]; got.DistanceKm != 12.5 || len(got.Equipment) != 1 || got.Equipment[0] != "Pegasus 40" {
+		t.Errorf("Assignment of 301 = %+v", got)
+	}
+	if worn := WornShoes(inv, DefaultShoeWarnKm); len(worn) != 0 {
+		t.Errorf("WornShoes = %+v, want none at 795.5 km", worn)
+	}
+
+	// A second sync only fetches the overview
+	requests := len(srv.Requests())
+	if err := SyncEquipment(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range srv.Requests()[requests:] {
+		if strings.HasPrefix(r, "GET /activity/") {
+			t.Errorf("Unexpected request %s on the second sync", r)
+		}
+	}
+
+	if err := ListEquipment(EquipmentConfig{SaveDir: saveDir, ShoeWarnKm: 790, JSONMode: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestE2E_Upload(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "401", Date: e2eMonday.Add(7 * time.Hour), Sport: "Running"})
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"401.fit":         runalyzetest.ExportContent("401", "fit-original"), // still in the account
+		"morning.fit":     []byte("a new run"),
+		"copy-of-401.fit": runalyzetest.ExportContent("401", "fit-original"),
+		"broken.gpx":      []byte("invalid"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := Upload(context.Background(), UploadConfig{
+		ClientConfig: e2eClientConfig(srv),
+		Paths:        []string{dir},
+		JSONMode:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := srv.Uploads()
+	if len(uploads) != 3 {
+		t.Fatalf("Uploads() = %v, want the three files not named after an existing activity", uploads)
+	}
+	for _, name := range uploads {
+		if name == "401.fit" {
+			t.Error("401.fit was uploaded although activity 401 exists")
+		}
+	}
+}
+
+func TestE2E_Edit(t *testing.T) {
+	srv := runalyzetest.NewServer(t)
+	srv.AddActivity(runalyzetest.Activity{ID: "501", Date: e2eMonday.Add(7 * time.Hour), Sport: "Running", TrainingType: "Easy run"})
+	srv.AddActivity(runalyzetest.Activity{ID: "502", Date: e2eMonday.AddDate(0, 0, 1), Sport: "Running"})
+	srv.AddEquipment(runalyzetest.Equipment{ID: "12", Name: "Pegasus 40", Category: "Shoes"})
+	csvPath := filepath.Join(t.TempDir(), "edits.csv")
+	csv := "id,title,type,equipment,privacy\n501,Morning run,Long run,Pegasus 40,public\n502,Commute,,,\n"
+	if err := os.WriteFile(csvPath, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := EditConfig{ClientConfig: e2eClientConfig(srv), CSVPath: csvPath, DryRun: true, JSONMode: true}
+
+	if err := Edit(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := srv.Activity("501"); a.Title != "" {
+		t.Fatalf("dry run saved activity 501: %+v", a)
+	}
+
+	config.DryRun = false
+	if err := Edit(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := srv.Activity("501")
+	if a.Title != "Morning run" || a.TrainingType != "Long run" || !a.Public || len(a.Equipment) != 1 || a.Equipment[0] != "Pegasus 40" || a.Sport != "Running" {
+		t.Errorf("activity 501 = %+v", a)
+	}
+	if b, _ := srv.Activity("502"); b.Title != "Commute" || b.Sport != "Running" {
+		t.Errorf("activity 502 = %+v", b)
+	}
+
+	single := EditConfig{ClientConfig: e2eClientConfig(srv), ActivityID: "502", Changes: map[EditField]string{EditSport: "Skating"}, JSONMode: true}
+	if err := Edit(context.Background(), single); err == nil {
+		t.Error("unknown sport: want an error")
+	}
+}
+
+func TestE2E_Download_TrashesActivitiesDeletedUpstream(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+	config.OnRemoteDelete = "trash"
+
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	srv.DeleteActivity("302")
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("second Download: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, TrashDir, "302.fit")); err != nil {
+		t.Errorf("deleted activity not moved to the trash: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "301.fit")); err != nil {
+		t.Errorf("activity still upstream was moved: %v", err)
+	}
+}
+
+func TestE2E_Download_KeepsVersionOfChangedActivity(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+
+	if err := Download(context.Background(), e2eConfig(srv, saveDir)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	// The ride is cropped in Runalyze
+	ride, _ := srv.Activity("302")
+	ride.DistanceKm = 40.1
+	ride.Exports = map[string][]byte{runalyze.FitFormat: []byte("cropped ride")}
+	srv.AddActivity(ride)
+
+	if err := Download(context.Background(), e2eConfig(srv, saveDir)); err != nil {
+		t.Fatalf("second Download: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(saveDir, "302.fit"))
+	if err != nil || string(data) != "cropped ride" {
+		t.Errorf("302.fit = %q, %v; want the cropped export", data, err)
+	}
+	versions, _ := filepath.Glob(filepath.Join(saveDir, VersionsDir, "302", "*-302.fit"))
+	if len(versions) != 1 {
+		t.Fatalf("got versions %v, want one", versions)
+	}
+	if data, _ := os.ReadFile(versions[0]); string(data) != string(runalyzetest.ExportContent("302", runalyze.FitFormat)) {
+		t.Errorf("earlier version = %q", data)
+	}
+	if n := srv.ExportsServed("301", runalyze.FitFormat); n != 1 {
+		t.Errorf("unchanged activity 301 served %d times, want 1", n)
+	}
+}
+
+func TestE2E_AuthCommands(t *testing.T) {
+	srv := newE2EServer(t)
+	config := AuthConfig{ClientConfig: e2eClientConfig(srv), WarnBefore: 7 * 24 * time.Hour, JSONMode: true}
+	config.CookieStore = "file"
+	config.CookiePath = filepath.Join(t.TempDir(), "cookies.json")
+	ctx := context.Background()
+
+	if err := AuthStatus(ctx, config); !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("status before login: err = %v, want ErrNotLoggedIn", err)
+	}
+	if err := AuthLogin(ctx, config); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if err := AuthStatus(ctx, config); err != nil {
+		t.Errorf("status after login: %v", err)
+	}
+	if err := AuthWhoAmI(ctx, config); err != nil {
+		t.Errorf("whoami: %v", err)
+	}
+	if err := AuthLogout(ctx, config); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if err := AuthWhoAmI(ctx, config); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("whoami after logout: err = %v, want ErrNotLoggedIn", err)
+	}
+	if srv.Logins() != 1 {
+		t.Errorf("Logins() = %d, want only the explicit login", srv.Logins())
+	}
+}
+
+func TestE2E_Download_RecordsCatalog(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	// The second run goes by the catalog and appends a line per activity
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("second Download: %v", err)
+	}
+
+	catalog, err := OpenCatalog(NewOSFileSystem(), config.CatalogPath, saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.lines != 3 {
+		t.Errorf("catalog has %d lines after compacting, want 3", catalog.lines)
+	}
+	entry := catalog.Get("302")
+	if entry == nil {
+		t.Fatal("activity 302 not in the catalog")
+	}
+	export := entry.Exports[runalyze.FitFormat]
+	content := runalyzetest.ExportContent("302", runalyze.FitFormat)
+	if export.Path != filepath.Join(saveDir, "302.fit") || export.Size != int64(len(content)) || len(export.SHA256) != 64 {
+		t.Errorf("export = %+v", export)
+	}
+	if entry.Activity.DistanceKm != 42.3 || entry.FirstSynced.IsZero() || entry.LastSynced.Before(entry.FirstSynced) {
+		t.Errorf("entry = %+v", entry)
+	}
+}
+
+func TestE2E_Download_SinceLast(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+	config.SinceStr = SinceLast
+
+	weeksScanned := func(run func() error) int {
+		t.Helper()
+		requests := len(srv.Requests())
+		if err := run(); err != nil {
+			t.Fatalf("Download: %v", err)
+		}
+		weeks := 0
+		for _, r := range srv.Requests()[requests:] {
+			if strings.HasSuffix(r, "/databrowser") {
+				weeks++
+			}
+		}
+		return weeks
+	}
+	download := func() error { return Download(context.Background(), config) }
+
+	// Without a previous run it falls back to four weeks
+	first := weeksScanned(download)
+	state, err := LoadSyncState(NewOSFileSystem(), filepath.Join(saveDir, SyncStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := e2eMonday.AddDate(0, 0, 7); !state.HighWaterMark.Equal(want) {
+		t.Errorf("HighWaterMark = %s, want %s", state.HighWaterMark, want)
+	}
+
+	// The next run only overlaps the last week
+	if second := weeksScanned(download); second >= first {
+		t.Errorf("second run scanned %d weeks, the first %d", second, first)
+	}
+	if files, _ := filepath.Glob(filepath.Join(saveDir, "*.fit")); len(files) != 3 {
+		t.Errorf("got %d activities, want 3", len(files))
+	}
+}
+
+func TestE2E_Download_ReplayKeepsSyncState(t *testing.T) {
+	srv := newE2EServer(t)
+	cassette := t.TempDir()
+	config := e2eConfig(srv, t.TempDir())
+	config.RecordDir = cassette
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	saveDir := t.TempDir()
+	statePath := filepath.Join(saveDir, SyncStateFile)
+	state := []byte(`{"high_water_mark": "2025-01-06T00:00:00Z", "runs": []}` + "\n")
+	if err := os.WriteFile(statePath, state, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config = e2eConfig(srv, saveDir)
+	config.ReplayDir = cassette
+	config.CatalogPath = ""
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(saveDir, "*.fit")); len(files) != 3 {
+		t.Errorf("replay got %d activities, want 3", len(files))
+	}
+	if got, err := os.ReadFile(statePath); err != nil || string(got) != string(state) {
+		t.Errorf("sync state after replay = %q, %v; want it unchanged", got, err)
+	}
+}
+
+func TestE2E_Download_SinceLast_MissingFormatsDontHoldBack(t *testing.T) {
+	srv := newE2EServer(t)
+	srv.MissingFormat(runalyze.FitFormat)
+	srv.MissingFormat(runalyze.TcxFormat)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+	config.SinceStr = SinceLast
+
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	state, err := LoadSyncState(NewOSFileSystem(), filepath.Join(saveDir, SyncStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := e2eMonday.AddDate(0, 0, 7); !state.HighWaterMark.Equal(want) {
+		t.Errorf("HighWaterMark = %s, want %s", state.HighWaterMark, want)
+	}
+}
+
+func TestE2E_DownloadActivities_Concurrently(t *testing.T) {
+	srv := newE2EServer(t)
+	for i := range 6 {
+		srv.AddActivity(runalyzetest.Activity{ID: strconv.Itoa(400 + i), Date: e2eMonday.AddDate(0, 0, -i).Add(12 * time.Hour), Sport: "Running", DistanceKm: 10})
+	}
+	srv.Latency(10 * time.Millisecond)
+	client := newE2EClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	saveDir := t.TempDir()
+
+	// The order the activities are listed in
+	var want []string
+	listing := NewActivityIteratorWithSince(client, e2eMonday, e2eMonday.AddDate(0, 0, -14))
+	for activity, ok := listing.Next(); ok; activity, ok = listing.Next() {
+		want = append(want, activity.ID)
+	}
+
+	catalog, err := OpenCatalog(NewOSFileSystem(), filepath.Join(saveDir, "catalog.jsonl"), saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewOSFileSystem()
+	service := NewDownloadService(client, fs, &MockLogger{})
+	service.SetConcurrency(4)
+	service.SetCatalog(catalog)
+	service.SetTombstones(NewTombstoneService(fs, &MockLogger{}, saveDir, catalog, RemoteDeleteKeep))
+
+	iter := NewActivityIteratorWithSince(client, e2eMonday, e2eMonday.AddDate(0, 0, -14))
+	iter.SetPrefetch(2)
+	defer iter.Close()
+	summary, err := service.DownloadActivities(context.Background(), iter, saveDir)
+	if err != nil {
+		t.Fatalf("DownloadActivities: %v", err)
+	}
+
+	var got []string
+	for _, result := range summary.Results {
+		got = append(got, result.ActivityID)
+		if !result.Success {
+			t.Errorf("activity %s: %v", result.ActivityID, result.Error)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("results in order %v, want listing order %v", got, want)
+	}
+	if len(catalog.Entries()) != len(want) {
+		t.Errorf("recorded %d catalog entries, want %d", len(catalog.Entries()), len(want))
+	}
+}
+
+func TestE2E_Download_Concurrency(t *testing.T) {
+	srv := newE2EServer(t)
+	for i := range 6 {
+		srv.AddActivity(runalyzetest.Activity{ID: strconv.Itoa(400 + i), Date: e2eMonday.AddDate(0, 0, -i).Add(12 * time.Hour), Sport: "Running", DistanceKm: 10})
+	}
+	srv.Latency(20 * time.Millisecond)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+	config.Concurrency = 4
+
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if peak := srv.PeakExportsInFlight(); peak < 2 {
+		t.Errorf("at most %d export in flight, want concurrent downloads", peak)
+	}
+	if files, _ := filepath.Glob(filepath.Join(saveDir, "*.fit")); len(files) != 9 {
+		t.Errorf("got %d activities, want 9", len(files))
+	}
+}
+
+func TestE2E_DownloadActivities_ConcurrentlyInterrupted(t *testing.T) {
+	srv := newE2EServer(t)
+	client := newE2EClient(t, srv)
+	if err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Latency(10 * time.Millisecond)
+
+	service := NewDownloadService(client, NewOSFileSystem(), &MockLogger{})
+	service.SetConcurrency(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancel while the first export is being served, the others in flight
+	srv.OnExport(func(activityID, format string) { cancel() })
+
+	iter := NewActivityIteratorWithSince(client, e2eMonday, e2eMonday.AddDate(0, 0, -14))
+	summary, err := service.DownloadActivities(ctx, iter, t.TempDir())
+	if err != nil {
+		t.Fatalf("DownloadActivities: %v", err)
+	}
+	if !summary.Interrupted || summary.Errors != 0 {
+		t.Errorf("summary = %+v, want interrupted without errors", summary)
+	}
+}
+
+func TestE2E_Download_Layout(t *testing.T) {
+	srv := newE2EServer(t)
+	saveDir := t.TempDir()
+	config := e2eConfig(srv, saveDir)
+	config.Layout = "{year}/{month}/{date}_{sport}_{id}.{ext}"
+	config.OnRemoteDelete = "trash"
+
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	ride := filepath.Join("2025", "05", "2025-05-28_cycling_302.fit")
+	if _, err := os.Stat(filepath.Join(saveDir, ride)); err != nil {
+		t.Errorf("ride not saved by the layout: %v", err)
+	}
+
+	// Deleted upstream: the file is found through the catalog
+	srv.DeleteActivity("302")
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("second Download: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, TrashDir, ride)); err != nil {
+		t.Errorf("deleted ride not moved to the trash: %v", err)
+	}
+
+	// Back to the flat layout, without downloading anything again
+	err := Reorganize(ReorganizeConfig{
+		SaveDir:     saveDir,
+		CatalogPath: config.CatalogPath,
+		From:        config.Layout,
+		To:          DefaultLayout,
+		JSONMode:    true,
+	})
+	if err != nil {
+		t.Fatalf("Reorganize: %v", err)
+	}
+	config.Layout = ""
+	if err := Download(context.Background(), config); err != nil {
+		t.Fatalf("third Download: %v", err)
+	}
+	for _, id := range []string{"301", "201"} {
+		if _, err := os.Stat(filepath.Join(saveDir, id+".fit")); err != nil {
+			t.Errorf("activity %s not moved back: %v", id, err)
+		}
+		if n := srv.ExportsServed(id, runalyze.FitFormat); n != 1 {
+			t.Errorf("activity %s served %d times, want 1", id, n)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package sw
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// EditConfig holds the configuration of the edit command: either the
+// changes to a single activity, or a CSV of edits
+type EditConfig struct {
+	ClientConfig
+	ActivityID string
+	Changes    map[EditField]string
+	CSVPath    string
+	DryRun     bool // show what would change without saving
+	JSONMode   bool
+}
+
+// ActivityEdit is a set of changes to the metadata of an activity. Fields
+// missing from Changes are left as they are.
+type ActivityEdit struct {
+	ActivityID string
+	Changes    map[EditField]string
+}
+
+// FieldChange is a field whose value an edit changes
+type FieldChange struct {
+	Field EditField
+	Old   string
+	New   string
+}
+
+// EditResult is the outcome of editing a single activity
+type EditResult struct {
+	ActivityID string
+	Changes    []FieldChange // empty if the activity already had the values
+	Saved      bool
+	Error      error
+}
+
+// EditSummary is the outcome of an edit run
+type EditSummary struct {
+	Results     []EditResult
+	DryRun      bool
+	Interrupted bool
+}
+
+// Count returns the number of saved (or, in a dry run, changed), unchanged
+// and failed edits
+func (s *EditSummary) Count() (changed, unchanged, failed int) {
+	for _, r := range s.Results {
+		switch {
+		case r.Error != nil:
+			failed++
+		case len(r.Changes) == 0:
+			unchanged++
+		default:
+			changed++
+		}
+	}
+	return changed, unchanged, failed
+}
+
+// LoadEditsCSV reads edits from CSV with an "id" column and a column per
+// field to change (title, notes, sport, type, equipment, privacy). Empty
+// cells leave the field as it is.
+func LoadEditsCSV(r io.Reader) ([]ActivityEdit, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	idColumn := -1
+	fields := make([]EditField, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "id" {
+			idColumn = i
+			continue
+		}
+		if !isEditField(EditField(name)) {
+			return nil, fmt.Errorf("unknown CSV column %q (want id, %s)", name, joinEditFields(", "))
+		}
+		fields[i] = EditField(name)
+	}
+	if idColumn < 0 {
+		return nil, fmt.Errorf("CSV has no id column")
+	}
+
+	var edits []ActivityEdit
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return edits, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		edit := ActivityEdit{ActivityID: strings.TrimSpace(record[idColumn]), Changes: make(map[EditField]string)}
+		if edit.ActivityID == "" {
+			line, _ := reader.FieldPos(idColumn)
+			return nil, fmt.Errorf("CSV line %d has no activity id", line)
+		}
+		for i, value := range record {
+			if fields[i] != "" && value != "" {
+				edit.Changes[fields[i]] = value
+			}
+		}
+		edits = append(edits, edit)
+	}
+}
+
+func isEditField(field EditField) bool {
+	for _, f := range EditFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func joinEditFields(sep string) string {
+	names := make([]string, len(EditFields))
+	for i, f := range EditFields {
+		names[i] = string(f)
+	}
+	return strings.Join(names, sep)
+}
+
+// EditService changes activity metadata through the Runalyze edit form
+type EditService struct {
+	client RunalyzeClient
+	logger Logger
+}
+
+// NewEditService creates a new edit service
+func NewEditService(client RunalyzeClient, logger Logger) *EditService {
+	return &EditService{
+		client: client,
+		logger: logger,
+	}
+}
+
+// Apply applies edit to the edit form of its activity and saves the form,
+// unless nothing changes or dryRun is set
+func (e *EditService) Apply(ctx context.Context, edit ActivityEdit, dryRun bool) EditResult {
+	result := EditResult{ActivityID: edit.ActivityID}
+
+	page, err := e.client.GetActivityEditPageContext(ctx, edit.ActivityID)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to get edit form: %w", err)
+		return result
+	}
+	form, err := ParseActivityEditForm(page, edit.ActivityID)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	for _, field := range EditFields {
+		value, ok := edit.Changes[field]
+		if !ok {
+			continue
+		}
+		old := form.Get(field)
+		if err := form.Set(field, value); err != nil {
+			result.Error = err
+			return result
+		}
+		if updated := form.Get(field); updated != old {
+			result.Changes = append(result.Changes, FieldChange{Field: field, Old: old, New: updated})
+		}
+	}
+
+	if dryRun || len(result.Changes) == 0 {
+		return result
+	}
+	if err := e.client.SaveActivityContext(ctx, edit.ActivityID, form.Values); err != nil {
+		result.Error = err
+		return result
+	}
+	result.Saved = true
+	e.logger.Debug("saved activity", "activity_id", edit.ActivityID, "changes", len(result.Changes))
+	return result
+}
+
+// ApplyAll applies edits one by one, calling onResult after each. Being
+// logged out stops the run; other failures are recorded and the next edit
+// is tried.
+func (e *EditService) ApplyAll(ctx context.Context, edits []ActivityEdit, dryRun bool, onResult func(EditResult)) (*EditSummary, error) {
+	summary := &EditSummary{DryRun: dryRun}
+	for _, edit := range edits {
+		result := e.Apply(ctx, edit, dryRun)
+		if ctx.Err() != nil {
+			summary.Interrupted = true
+			return summary, nil
+		}
+		if errors.Is(result.Error, runalyze.ErrRedirectedToLogin) {
+			return summary, result.Error
+		}
+		summary.Results = append(summary.Results, result)
+		if onResult != nil {
+			onResult(result)
+		}
+	}
+	return summary, nil
+}
+
+// Edit applies the edit in config, or the edits in config.CSVPath, and
+// reports what changed
+func Edit(ctx context.Context, config EditConfig) error {
+	var edits []ActivityEdit
+	if config.CSVPath != "" {
+		path, err := homedir.Expand(config.CSVPath)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		edits, err = LoadEditsCSV(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", config.CSVPath, err)
+		}
+	} else {
+		if config.ActivityID == "" {
+			return fmt.Errorf("an activity ID or --csv is required")
+		}
+		if len(config.Changes) == 0 {
+			return fmt.Errorf("nothing to change: use --%s", joinEditFields(", --"))
+		}
+		edits = []ActivityEdit{{ActivityID: config.ActivityID, Changes: config.Changes}}
+	}
+
+	ol, logger, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+	logger = ol.Component("edit")
+
+	if err := validateCredentials(config.ClientConfig); err != nil {
+		return err
+	}
+
+	client, err := createAndAuthenticateClient(ctx, config.ClientConfig, ol, logger, presentation)
+	if err != nil {
+		return err
+	}
+
+	showResult := func(result EditResult) { presentation.ShowEditResult(result, config.DryRun) }
+	summary, err := NewEditService(client, logger).ApplyAll(ctx, edits, config.DryRun, showResult)
+	if err != nil {
+		presentation.ShowError(err, "Editing stopped")
+		return err
+	}
+	presentation.ShowEditResults(summary)
+	if summary.Interrupted {
+		return fmt.Errorf("editing interrupted: %w", ctx.Err())
+	}
+	if _, _, failed := summary.Count(); failed > 0 {
+		return fmt.Errorf("%d activities failed to update", failed)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package sw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Equipment is a shoe, bike etc. from the Runalyze equipment overview
+type Equipment struct {
+	ID         string        `json:"id,omitempty"`
+	Name       string        `json:"name"`
+	Category   string        `json:"category"`    // e.g. "Shoes"
+	DistanceKm float64       `json:"distance_km"` // accumulated by Runalyze over all activities
+	Duration   time.Duration `json:"duration"`
+	Since      string        `json:"since,omitempty"` // YYYY-MM-DD
+	Retired    bool          `json:"retired"`
+	RetiredAt  string        `json:"retired_at,omitempty"` // YYYY-MM-DD
+}
+
+// IsShoe reports whether e is in a shoe category
+func (e Equipment) IsShoe() bool {
+	return strings.Contains(strings.ToLower(e.Category), "shoe")
+}
+
+// EquipmentAssignment is the gear used for an activity, with the activity
+// metrics needed to compute mileage locally
+type EquipmentAssignment struct {
+	Date       string        `json:"date,omitempty"` // YYYY-MM-DD
+	Sport      string        `json:"sport,omitempty"`
+	DistanceKm float64       `json:"distance_km"`
+	Duration   time.Duration `json:"duration"`
+	Equipment  []string      `json:"equipment"`
+}
+
+// EquipmentInventory is the content of equipment.json in the archive
+type EquipmentInventory struct {
+	Updated   time.Time   `json:"updated"`
+	Equipment []Equipment `json:"equipment"`
+	// Activities maps activity IDs to the gear used
+	Activities map[string]EquipmentAssignment `json:"activities"`
+}
+
+// EquipmentMileage is the use of a piece of gear summed over the local archive
+type EquipmentMileage struct {
+	DistanceKm float64
+	Duration   time.Duration
+	Activities int
+}
+
+// LoadEquipmentInventory reads equipment.json from path through fs. A
+// missing file is an empty inventory.
+func LoadEquipmentInventory(fs FileSystem, path string) (*EquipmentInventory, error) {
+	inventory := &EquipmentInventory{Activities: make(map[string]EquipmentAssignment)}
+
+	data, err := fs.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return inventory, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read equipment inventory: %w", err)
+	}
+	if err := json.Unmarshal(data, inventory); err != nil {
+		return nil, fmt.Errorf("failed to parse equipment inventory %s: %w", path, err)
+	}
+	if inventory.Activities == nil {
+		inventory.Activities = make(map[string]EquipmentAssignment)
+	}
+	return inventory, nil
+}
+
+// Save writes the inventory to path through fs
+func (inv *EquipmentInventory) Save(fs FileSystem, path string) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fs.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save equipment inventory: %w", err)
+	}
+	return nil
+}
+
+// Mileage sums the activities assigned to each piece of gear, by name
+func (inv *EquipmentInventory) Mileage() map[string]EquipmentMileage {
+	mileage := make(map[string]EquipmentMileage)
+	for _, assignment := range inv.Activities {
+		for _, name := range assignment.Equipment {
+			m := mileage[name]
+			m.DistanceKm += assignment.DistanceKm
+			m.Duration += assignment.Duration
+			m.Activities++
+			mileage[name] = m
+		}
+	}
+	return mileage
+}
+
+// ParseEquipmentPage parses the equipment overview: a table per category,
+// with columns found by their header ("Name", "Distance", "Time", "Since",
+// "Retired"). Rows grayed out as unimportant are retired gear too.
+func ParseEquipmentPage(htmlContent []byte) ([]Equipment, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse equipment page: %w", err)
+	}
+
+	var equipment []Equipment
+	doc.Find("table").Each(func(_ int, table *goquery.Selection) {
+		category := normalizeSpaces(table.Closest(".equipment-category").Find("h2, h3").First().Text())
+		if category == "" {
+			category = normalizeSpaces(table.PrevAllFiltered("h2, h3").First().Text())
+		}
+
+		var columns []string
+		table.Find("thead tr").First().Children().Each(func(_ int, th *goquery.Selection) {
+			columns = append(columns, normalizeSpaces(th.Text()))
+		})
+
+		table.Find("tbody tr").Each(func(_ int, row *goquery.Selection) {
+			e := Equipment{Category: category, ID: row.AttrOr("data-equipment-id", "")}
+			row.Children().Each(func(i int, td *goquery.Selection) {
+				if i >= len(columns) {
+					return
+				}
+				text := cellText(td)
+				switch columns[i] {
+				case "Name":
+					e.Name = text
+				case "Distance":
+					var info ActivityInfo
+					applyMetric(&info, metricDistance, td)
+					e.DistanceKm = info.DistanceKm
+				case "Time", "Duration":
+					var info ActivityInfo
+					applyMetric(&info, metricDuration, td)
+					e.Duration = info.Duration
+				case "Since", "First use":
+					e.Since = isoDate(text)
+				case "Retired", "Until":
+					e.RetiredAt = isoDate(text)
+				}
+			})
+			if e.Name == "" {
+				return
+			}
+			e.Retired = e.RetiredAt != "" || row.HasClass("unimportant")
+			equipment = append(equipment, e)
+		})
+	})
+	return equipment, nil
+}
+
+// isoDate turns "26.05.2025" into "2025-05-26", or "" if s isn't a date
+func isoDate(s string) string {
+	t, err := time.Parse("02.01.2006", strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
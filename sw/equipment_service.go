@@ -0,0 +1,243 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// EquipmentFile is the name of the equipment inventory in the save directory
+const EquipmentFile = "equipment.json"
+
+// DefaultShoeWarnKm is the distance after which shoes are reported as worn out
+const DefaultShoeWarnKm = 800
+
+// EquipmentConfig holds the configuration of the equipment commands
+type EquipmentConfig struct {
+	ClientConfig
+	UntilStr   string
+	SinceStr   string
+	SaveDir    string
+	ShoeWarnKm float64 // 0 means DefaultShoeWarnKm
+	// PrefetchWeeks is how many databrowser weeks sync fetches ahead; zero
+	// fetches each week when it is reached
+	PrefetchWeeks int
+	JSONMode      bool
+}
+
+// EquipmentService keeps an EquipmentInventory up to date
+type EquipmentService struct {
+	client RunalyzeClient
+	logger Logger
+	now    func() time.Time
+}
+
+// NewEquipmentService creates a new equipment service
+func NewEquipmentService(client RunalyzeClient, logger Logger) *EquipmentService {
+	return &EquipmentService{
+		client: client,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// UpdateEquipment replaces the gear in inv with the equipment overview
+func (s *EquipmentService) UpdateEquipment(ctx context.Context, inv *EquipmentInventory) error {
+	page, err := s.client.GetEquipmentPageContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get equipment page: %w", err)
+	}
+	equipment, err := ParseEquipmentPage(page)
+	if err != nil {
+		return err
+	}
+	inv.Equipment = equipment
+	inv.Updated = s.now()
+	s.logger.Debug("updated equipment", "count", len(equipment))
+	return nil
+}
+
+// AssignActivity records the gear used for activity, read from its activity
+// page. Activities already in inv are skipped; it reports whether the
+// activity page was fetched.
+func (s *EquipmentService) AssignActivity(ctx context.Context, inv *EquipmentInventory, activity ActivityInfo) (bool, error) {
+	if _, ok := inv.Activities[activity.ID]; ok {
+		return false, nil
+	}
+
+	details, err := FetchActivityDetails(ctx, s.client, activity.ID)
+	if err != nil {
+		return false, err
+	}
+
+	assignment := EquipmentAssignment{
+		Date:       activity.Date,
+		Sport:      firstNonEmpty(details.Sport, activity.Type),
+		DistanceKm: firstNonZero(details.DistanceKm, activity.DistanceKm),
+		Duration:   time.Duration(firstNonZero(float64(details.Duration), float64(activity.Duration))),
+		Equipment:  details.Equipment,
+	}
+	if assignment.Equipment == nil {
+		assignment.Equipment = []string{}
+	}
+	inv.Activities[activity.ID] = assignment
+	return true, nil
+}
+
+// WornShoes returns the shoes in use whose distance, from Runalyze or from
+// the local archive, whichever is higher, reached warnKm
+func WornShoes(inv *EquipmentInventory, warnKm float64) []Equipment {
+	mileage := inv.Mileage()
+	var worn []Equipment
+	for _, e := range inv.Equipment {
+		if !e.IsShoe() || e.Retired {
+			continue
+		}
+		if max(e.DistanceKm, mileage[e.Name].DistanceKm) >= warnKm {
+			worn = append(worn, e)
+		}
+	}
+	return worn
+}
+
+// SyncEquipment updates equipment.json in the save directory with the
+// equipment overview and the gear of every activity in the date range
+func SyncEquipment(ctx context.Context, config EquipmentConfig) error {
+	since, until, err := ValidateAndParseDates(config.UntilStr, config.SinceStr)
+	if err != nil {
+		return err
+	}
+
+	ol, _, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+	logger := ol.Component("equipment")
+
+	if err := validateCredentials(config.ClientConfig); err != nil {
+		return err
+	}
+
+	fs := NewOSFileSystem()
+	path, err := equipmentPath(config.SaveDir, fs)
+	if err != nil {
+		return err
+	}
+	inv, err := LoadEquipmentInventory(fs, path)
+	if err != nil {
+		presentation.ShowError(err, "Failed to read the equipment inventory")
+		return err
+	}
+
+	client, err := createAndAuthenticateClient(ctx, config.ClientConfig, ol, logger, presentation)
+	if err != nil {
+		return err
+	}
+
+	service := NewEquipmentService(client, logger)
+	if err := service.UpdateEquipment(ctx, inv); err != nil {
+		presentation.ShowError(err, "Failed to fetch the equipment overview")
+		return err
+	}
+
+	presentation.ShowStatus("Reading the equipment of activities from %s to %s", since.Format("2006-01-02"), until.Format("2006-01-02"))
+	iter := NewActivityIteratorWithSince(client, until, since)
+	iter.SetLogger(logger)
+	iter.SetContext(ctx)
+	iter.SetPrefetch(config.PrefetchWeeks)
+	defer iter.Close()
+
+	fetched := 0
+	for activity, ok := iter.Next(); ok; activity, ok = iter.Next() {
+		assigned, err := service.AssignActivity(ctx, inv, activity)
+		if ctx.Err() != nil {
+			break
+		}
+		if errors.Is(err, runalyze.ErrRedirectedToLogin) {
+			presentation.ShowError(err, "Logged out while reading activities, stopping early")
+			break
+		}
+		if err != nil {
+			logger.Warn("failed to read activity equipment", "activity_id", activity.ID, "error", err)
+			continue
+		}
+		if assigned {
+			fetched++
+		}
+	}
+	if err := iter.Err(); err != nil && ctx.Err() == nil {
+		presentation.ShowError(err, "Failed to fetch activity list, stopping early")
+	}
+
+	// Save what was read, even when interrupted
+	if err := inv.Save(fs, path); err != nil {
+		presentation.ShowError(err, "Failed to save the equipment inventory")
+		return err
+	}
+
+	presentation.ShowStatus("Read the equipment of %d new activities into %s", fetched, path)
+	presentation.ShowEquipment(inv, shoeWarnKm(config.ShoeWarnKm))
+	if ctx.Err() != nil {
+		return fmt.Errorf("equipment sync interrupted: %w", ctx.Err())
+	}
+	return nil
+}
+
+// ListEquipment shows the gear in equipment.json with its mileage in the
+// local archive, without contacting Runalyze
+func ListEquipment(config EquipmentConfig) error {
+	_, _, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+
+	saveDir, err := homedir.Expand(config.SaveDir)
+	if err != nil {
+		return err
+	}
+	inv, err := LoadEquipmentInventory(NewOSFileSystem(), filepath.Join(saveDir, EquipmentFile))
+	if err != nil {
+		presentation.ShowError(err, "Failed to read the equipment inventory")
+		return err
+	}
+	if len(inv.Equipment) == 0 {
+		presentation.ShowProgress("No equipment yet, run 'syncwich equipment sync' first")
+	}
+
+	presentation.ShowEquipment(inv, shoeWarnKm(config.ShoeWarnKm))
+	return nil
+}
+
+// equipmentPath expands the save directory, creates it and returns the
+// path of equipment.json in it
+func equipmentPath(saveDir string, fs FileSystem) (string, error) {
+	dir, err := homedir.Expand(saveDir)
+	if err != nil {
+		return "", err
+	}
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, EquipmentFile), nil
+}
+
+func shoeWarnKm(km float64) float64 {
+	if km <= 0 {
+		return DefaultShoeWarnKm
+	}
+	return km
+}
+
+func firstNonZero(values ...float64) float64 {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
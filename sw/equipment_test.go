@@ -0,0 +1,132 @@
+package sw
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const equipmentPageHTML = `<html><body>
+<div class="equipment-category">
+	<h2>Shoes</h2>
+	<table>
+		<thead><tr><th>Name</th><th>Distance</th><th>Time</th><th>Since</th><th>Retired</th></tr></thead>
+		<tbody>
+			<tr data-equipment-id="12"><td><a href="/my/equipment/12">Pegasus 40</a></td><td>1&nbsp;023,4&nbsp;km</td><td>92:10:05</td><td>01.01.2025</td><td></td></tr>
+			<tr data-equipment-id="7" class="unimportant"><td><a href="/my/equipment/7">Old trail shoes</a></td><td>655,0&nbsp;km</td><td>70:00:00</td><td>03.03.2023</td><td></td></tr>
+		</tbody>
+	</table>
+</div>
+<div class="equipment-category">
+	<h2>Bikes</h2>
+	<table>
+		<thead><tr><th>Name</th><th>Distance</th></tr></thead>
+		<tbody>
+			<tr data-equipment-id="3"><td>Gravel bike</td><td>4&nbsp;210,0&nbsp;km</td></tr>
+		</tbody>
+	</table>
+</div>
+</body></html>`
+
+func TestParseEquipmentPage(t *testing.T) {
+	equipment, err := ParseEquipmentPage([]byte(equipmentPageHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Equipment{
+		{ID: "12", Name: "Pegasus 40", Category: "Shoes", DistanceKm: 1023.4, Duration: 92*time.Hour + 10*time.Minute + 5*time.Second, Since: "2025-01-01"},
+		{ID: "7", Name: "Old trail shoes", Category: "Shoes", DistanceKm: 655, Duration: 70 * time.Hour, Since: "2023-03-03", Retired: true},
+		{ID: "3", Name: "Gravel bike", Category: "Bikes", DistanceKm: 4210},
+	}
+	if !reflect.DeepEqual(equipment, want) {
+		t.Errorf("ParseEquipmentPage =\n%+v\nwant\n%+v", equipment, want)
+	}
+}
+
+func TestEquipmentInventory_MileageAndWornShoes(t *testing.T) {
+	inv := &EquipmentInventory{
+		Equipment: []Equipment{
+			{Name: "Pegasus 40", Category: "Shoes", DistanceKm: 120},
+			{Name: "Old trail shoes", Category: "Shoes", DistanceKm: 900, Retired: true},
+			{Name: "Gravel bike", Category: "Bikes", DistanceKm: 4210},
+		},
+		Activities: map[string]EquipmentAssignment{
+			"1": {DistanceKm: 500, Duration: time.Hour, Equipment: []string{"Pegasus 40"}},
+			"2": {DistanceKm: 350, Duration: time.Hour, Equipment: []string{"Pegasus 40"}},
+			"3": {DistanceKm: 60, Equipment: []string{"Gravel bike"}},
+		},
+	}
+
+	mileage := inv.Mileage()
+	if got := mileage["Pegasus 40"]; got.DistanceKm != 850 || got.Activities != 2 || got.Duration != 2*time.Hour {
+		t.Errorf("Mileage of Pegasus 40 = %+v", got)
+	}
+
+	// The local archive knows more than Runalyze's own counter here;
+	// retired shoes and bikes are never reported
+	worn := WornShoes(inv, 800)
+	if len(worn) != 1 || worn[0].Name != "Pegasus 40" {
+		t.Errorf("WornShoes = %+v, want Pegasus 40", worn)
+	}
+	if worn := WornShoes(inv, 1000); len(worn) != 0 {
+		t.Errorf("WornShoes = %+v, want none below the threshold", worn)
+	}
+}
+
+func TestEquipmentInventory_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), EquipmentFile)
+
+	empty, err := LoadEquipmentInventory(NewOSFileSystem(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Equipment) != 0 || empty.Activities == nil {
+		t.Errorf("Expected an empty inventory, got %+v", empty)
+	}
+
+	inv := &EquipmentInventory{
+		Updated:    time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		Equipment:  []Equipment{{Name: "Pegasus 40", Category: "Shoes", DistanceKm: 120}},
+		Activities: map[string]EquipmentAssignment{"1": {Date: "2025-05-26", DistanceKm: 10, Equipment: []string{"Pegasus 40"}}},
+	}
+	if err := inv.Save(NewOSFileSystem(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadEquipmentInventory(NewOSFileSystem(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, inv) {
+		t.Errorf("Loaded inventory =\n%+v\nwant\n%+v", loaded, inv)
+	}
+}
+
+func TestEquipmentService_AssignActivity_SkipsKnownActivities(t *testing.T) {
+	client := &MockRunalyzeClient{
+		ActivityPages: map[string][]byte{
+			"1": []byte(`<table class="activity-details"><tr><th>Equipment</th><td><a href="/my/equipment/12">Pegasus 40</a></td></tr></table>`),
+		},
+	}
+	service := NewEquipmentService(client, &MockLogger{})
+	inv := &EquipmentInventory{Activities: map[string]EquipmentAssignment{
+		"2": {Equipment: []string{}},
+	}}
+
+	fetched, err := service.AssignActivity(context.Background(), inv, ActivityInfo{ID: "1", Date: "2025-05-26", DistanceKm: 8.2})
+	if err != nil || !fetched {
+		t.Fatalf("AssignActivity = %v, %v", fetched, err)
+	}
+	if got := inv.Activities["1"]; got.DistanceKm != 8.2 || !reflect.DeepEqual(got.Equipment, []string{"Pegasus 40"}) {
+		t.Errorf("Assignment = %+v", got)
+	}
+
+	// Activity 2 has no page in the mock, so fetching it would fail
+	fetched, err = service.AssignActivity(context.Background(), inv, ActivityInfo{ID: "2"})
+	if err != nil || fetched {
+		t.Errorf("Expected a known activity to be skipped, got %v, %v", fetched, err)
+	}
+}
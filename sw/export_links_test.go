@@ -82,7 +82,7 @@ func TestExtractExportLinks_Fixtures(t *testing.T) {
 }
 
 // TestClientExportFormatsMatchActivityPage ties the format strings the
-// runalyze client sends (GetFit, GetTcx) to the export links a real activity
+// runalyze client sends (GetExport and friends) to the export links a real activity
 // page advertises. If Runalyze renames a format (e.g. "fit" → "fit-original"),
 // this fails loudly instead of silently 403-ing at download time.
 func TestClientExportFormatsMatchActivityPage(t *testing.T) {
@@ -111,6 +111,12 @@ func TestClientExportFormatsMatchActivityPage(t *testing.T) {
 		{"FIT", runalyze.FitFormat},
 		{"TCX", runalyze.TcxFormat},
 	}
+	for _, format := range runalyze.ExportFormats {
+		cases = append(cases, struct {
+			name   string
+			format string
+		}{formatLabel(format), format})
+	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -1,7 +1,10 @@
 package sw
 
 import (
+	"bytes"
+	"io"
 	"os"
+	"path/filepath"
 )
 
 // OSFileSystem is a concrete implementation of FileSystem using the OS
@@ -12,9 +15,62 @@ func NewOSFileSystem() *OSFileSystem {
 	return &OSFileSystem{}
 }
 
-// WriteFile writes data to a file
+// WriteFile writes data to a file atomically, see WriteFileFrom
 func (fs *OSFileSystem) WriteFile(path string, data []byte, perm int) error {
-	return os.WriteFile(path, data, os.FileMode(perm))
+	return fs.WriteFileFrom(path, perm, func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(data))
+		return err
+	})
+}
+
+// WriteFileFrom streams what write produces to a file. The data goes to a
+// temp file in the same directory which is then renamed into place, so an
+// interrupted run never leaves a truncated file that a later run would
+// mistake for a finished one.
+func (fs *OSFileSystem) WriteFileFrom(path string, perm int, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, os.FileMode(perm)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// AppendFile appends data to a file, creating it if needed. Unlike
+// WriteFile it isn't atomic; a crash can leave a partly written append.
+func (fs *OSFileSystem) AppendFile(path string, data []byte, perm int) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(perm))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadFile reads a whole file
+func (fs *OSFileSystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
 }
 
 // Exists checks if a file exists
@@ -23,7 +79,19 @@ func (fs *OSFileSystem) Exists(path string) bool {
 	return err == nil
 }
 
+// Rename moves a file, replacing newpath if it exists
+func (fs *OSFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
 // MkdirAll creates directories recursively
 func (fs *OSFileSystem) MkdirAll(path string, perm int) error {
 	return os.MkdirAll(path, os.FileMode(perm))
 }
+
+// withinDir reports whether path is inside dir, so an absolute path from
+// elsewhere, e.g. the catalog, can't point outside of it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
@@ -0,0 +1,82 @@
+package sw
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// DefaultFormats downloads FIT, falling back to TCX when Runalyze has no FIT
+// for the activity (e.g. manually entered or imported from TCX).
+const DefaultFormats = runalyze.FitFormat + "|" + runalyze.TcxFormat
+
+// FormatGroup is one entry of the format preference list: export formats to
+// try in order until one is available. Each group yields one file per
+// activity.
+type FormatGroup []string
+
+// String renders the group the way it is written in --formats.
+func (g FormatGroup) String() string {
+	return strings.Join(g, "|")
+}
+
+// formatAliases lets users write the file extension instead of the export
+// URL segment.
+var formatAliases = map[string]string{
+	"fit": runalyze.FitFormat,
+}
+
+// ParseFormats parses a format preference list such as
+// "fit-original|tcx,gpx,csv". Commas separate formats that are each
+// downloaded; a pipe separates fallbacks within one entry.
+func ParseFormats(spec string) ([]FormatGroup, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = DefaultFormats
+	}
+
+	var groups []FormatGroup
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		var group FormatGroup
+		for _, format := range strings.Split(entry, "|") {
+			format = strings.ToLower(strings.TrimSpace(format))
+			if alias, ok := formatAliases[format]; ok {
+				format = alias
+			}
+			if format == "" {
+				continue
+			}
+			if !slices.Contains(runalyze.ExportFormats, format) {
+				return nil, fmt.Errorf("unknown export format %q (available: %s)", format, strings.Join(runalyze.ExportFormats, ", "))
+			}
+			if seen[format] {
+				return nil, fmt.Errorf("export format %q listed more than once", format)
+			}
+			seen[format] = true
+			group = append(group, format)
+		}
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no export formats given")
+	}
+	return groups, nil
+}
+
+// formatExtension returns the file extension used when saving an export.
+func formatExtension(format string) string {
+	if format == runalyze.FitFormat {
+		return "fit"
+	}
+	return format
+}
+
+// formatLabel returns the short upper-case label shown for a format, e.g. "FIT".
+func formatLabel(format string) string {
+	return strings.ToUpper(formatExtension(format))
+}
@@ -0,0 +1,53 @@
+package sw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []FormatGroup
+		wantErr bool
+	}{
+		{
+			name: "empty uses default FIT with TCX fallback",
+			spec: "",
+			want: []FormatGroup{{"fit-original", "tcx"}},
+		},
+		{
+			name: "independent formats",
+			spec: "fit-original,gpx,csv",
+			want: []FormatGroup{{"fit-original"}, {"gpx"}, {"csv"}},
+		},
+		{
+			name: "fallbacks, aliases and whitespace",
+			spec: " FIT | tcx , kml,fitlog ",
+			want: []FormatGroup{{"fit-original", "tcx"}, {"kml"}, {"fitlog"}},
+		},
+		{
+			name:    "unknown format",
+			spec:    "fit-original,pdf",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate format",
+			spec:    "gpx,fit-original|gpx",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormats(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormats(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFormats(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
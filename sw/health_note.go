@@ -0,0 +1,87 @@
+package sw
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// HealthNote is a day of body data from Runalyze's health notes. Zero
+// means the value wasn't entered.
+type HealthNote struct {
+	Date             string  `json:"date"` // YYYY-MM-DD
+	RestingHeartRate int     `json:"resting_hr,omitempty"`
+	MaxHeartRate     int     `json:"max_hr,omitempty"`
+	WeightKg         float64 `json:"weight_kg,omitempty"`
+	BodyFatPct       float64 `json:"body_fat_pct,omitempty"`
+	WaterPct         float64 `json:"water_pct,omitempty"`
+	MusclePct        float64 `json:"muscle_pct,omitempty"`
+	SleepMinutes     int     `json:"sleep_minutes,omitempty"`
+	HRV              float64 `json:"hrv_ms,omitempty"`
+	Notes            string  `json:"notes,omitempty"`
+}
+
+// IsEmpty reports whether nothing was entered for the day
+func (n HealthNote) IsEmpty() bool {
+	return n == HealthNote{Date: n.Date}
+}
+
+// fieldNameRe picks "weight" out of form field names like "health_note[weight]"
+var fieldNameRe = regexp.MustCompile(`(?:^|\[)([a-z_]+)\]?$`)
+
+// sleepClockRe matches sleep given as "7:30" instead of minutes
+var sleepClockRe = regexp.MustCompile(`^(\d+):(\d{2})$`)
+
+// ParseHealthNote parses the health note form of day (YYYY-MM-DD). Fields
+// are found by their form field names, so their order and markup don't
+// matter.
+func ParseHealthNote(htmlContent []byte, day string) (HealthNote, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(htmlContent)))
+	if err != nil {
+		return HealthNote{}, fmt.Errorf("failed to parse health note: %w", err)
+	}
+
+	note := HealthNote{Date: day}
+	doc.Find("input[name], textarea[name]").Each(func(_ int, field *goquery.Selection) {
+		match := fieldNameRe.FindStringSubmatch(field.AttrOr("name", ""))
+		if match == nil {
+			return
+		}
+		value := strings.TrimSpace(field.AttrOr("value", ""))
+		if goquery.NodeName(field) == "textarea" {
+			value = strings.TrimSpace(field.Text())
+		}
+		if value == "" {
+			return
+		}
+
+		switch match[1] {
+		case "pulse_rest":
+			note.RestingHeartRate = int(parseDecimal(value))
+		case "pulse_max":
+			note.MaxHeartRate = int(parseDecimal(value))
+		case "weight":
+			note.WeightKg = parseDecimal(value)
+		case "fat":
+			note.BodyFatPct = parseDecimal(value)
+		case "water":
+			note.WaterPct = parseDecimal(value)
+		case "muscles":
+			note.MusclePct = parseDecimal(value)
+		case "sleep_duration":
+			if clock := sleepClockRe.FindStringSubmatch(value); clock != nil {
+				note.SleepMinutes = int(parseClock(clock[1], clock[2], "0").Minutes())
+			} else {
+				note.SleepMinutes = int(parseDecimal(value))
+			}
+		case "hrv":
+			note.HRV = parseDecimal(value)
+		case "notes":
+			note.Notes = value
+		}
+	})
+
+	return note, nil
+}
@@ -0,0 +1,158 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// HealthConfig holds the configuration of the health download command
+type HealthConfig struct {
+	ClientConfig
+	UntilStr string
+	SinceStr string
+	SaveDir  string
+	Format   string // "jsonl" (default) or "csv"
+	JSONMode bool
+}
+
+// HealthSummary is the outcome of a health sync
+type HealthSummary struct {
+	Fetched     int // days fetched and stored
+	Skipped     int // days already in the timeline
+	Empty       int // days without a note yet, fetched again on the next run
+	Errors      int
+	Interrupted bool
+}
+
+// HealthService syncs health notes into a HealthTimeline
+type HealthService struct {
+	client RunalyzeClient
+	logger Logger
+	now    func() time.Time
+}
+
+// NewHealthService creates a new health service
+func NewHealthService(client RunalyzeClient, logger Logger) *HealthService {
+	return &HealthService{
+		client: client,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Sync fetches the health note of every day from since up to until (or
+// today, whichever is earlier; today's note is usually still being filled
+// in) that isn't in timeline yet, and appends it. Empty notes aren't
+// stored, since they're often filled in days later. Being logged out stops
+// the sync; other failures are counted and the next day is tried.
+func (h *HealthService) Sync(ctx context.Context, since, until time.Time, timeline *HealthTimeline) (*HealthSummary, error) {
+	now := h.now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, since.Location())
+	if until.After(today) {
+		until = today
+	}
+
+	summary := &HealthSummary{}
+	for day := since; day.Before(until); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if timeline.Has(date) {
+			summary.Skipped++
+			continue
+		}
+
+		page, err := h.client.GetHealthNoteContext(ctx, day)
+		if ctx.Err() != nil {
+			summary.Interrupted = true
+			return summary, nil
+		}
+		if errors.Is(err, runalyze.ErrRedirectedToLogin) {
+			return summary, err
+		}
+		if err != nil {
+			summary.Errors++
+			h.logger.Warn("failed to fetch health note", "date", date, "error", err)
+			continue
+		}
+
+		note, err := ParseHealthNote(page, date)
+		if err != nil {
+			summary.Errors++
+			h.logger.Warn("failed to parse health note", "date", date, "error", err)
+			continue
+		}
+		if note.IsEmpty() {
+			summary.Empty++
+			h.logger.Debug("health note is empty", "date", date)
+			continue
+		}
+		if err := timeline.Append(note); err != nil {
+			return summary, err
+		}
+		summary.Fetched++
+		h.logger.Debug("stored health note", "date", date)
+	}
+	return summary, nil
+}
+
+// DownloadHealth syncs the health notes in the configured date range into
+// health.jsonl (or health.csv) in the save directory
+func DownloadHealth(ctx context.Context, config HealthConfig) error {
+	since, until, err := ValidateAndParseDates(config.UntilStr, config.SinceStr)
+	if err != nil {
+		return err
+	}
+
+	var filename string
+	switch config.Format {
+	case "", "jsonl":
+		filename = "health.jsonl"
+	case "csv":
+		filename = "health.csv"
+	default:
+		return fmt.Errorf("unknown health timeline format %q (want jsonl or csv)", config.Format)
+	}
+
+	ol, logger, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+	logger = ol.Component("health")
+
+	if err := validateCredentials(config.ClientConfig); err != nil {
+		return err
+	}
+
+	saveDir, err := homedir.Expand(config.SaveDir)
+	if err != nil {
+		return err
+	}
+	timeline, err := OpenHealthTimeline(filepath.Join(saveDir, filename))
+	if err != nil {
+		presentation.ShowError(err, "Failed to read the health timeline")
+		return err
+	}
+
+	client, err := createAndAuthenticateClient(ctx, config.ClientConfig, ol, logger, presentation)
+	if err != nil {
+		return err
+	}
+
+	presentation.ShowStatus("Syncing health notes from %s to %s", since.Format("2006-01-02"), until.Format("2006-01-02"))
+	summary, err := NewHealthService(client, logger).Sync(ctx, since, until, timeline)
+	if err != nil {
+		presentation.ShowError(err, "Failed to sync health notes")
+		return err
+	}
+
+	presentation.ShowHealthResults(summary, timeline.Path())
+	if summary.Interrupted {
+		return fmt.Errorf("health sync interrupted: %w", ctx.Err())
+	}
+	return nil
+}
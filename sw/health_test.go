@@ -0,0 +1,178 @@
+package sw
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/runalyze"
+)
+
+func TestParseHealthNote(t *testing.T) {
+	html := `<form class="health-note">
+		<input type="number" name="health_note[pulse_rest]" value="48">
+		<input type="number" name="health_note[pulse_max]" value="">
+		<input type="number" step="0.1" name="health_note[weight]" value="72,4">
+		<input type="number" name="health_note[fat]" value="14.5">
+		<input type="text" name="health_note[sleep_duration]" value="7:30">
+		<input type="number" name="health_note[hrv]" value="62">
+		<input type="hidden" name="health_note[_token]" value="abc">
+		<textarea name="health_note[notes]">
+			Slept badly, cold coming
+		</textarea>
+	</form>`
+
+	note, err := ParseHealthNote([]byte(html), "2025-05-26")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := HealthNote{
+		Date:             "2025-05-26",
+		RestingHeartRate: 48,
+		WeightKg:         72.4,
+		BodyFatPct:       14.5,
+		SleepMinutes:     450,
+		HRV:              62,
+		Notes:            "Slept badly, cold coming",
+	}
+	if note != want {
+		t.Errorf("ParseHealthNote =\n%+v\nwant\n%+v", note, want)
+	}
+
+	empty, err := ParseHealthNote([]byte(`<form><input name="health_note[weight]" value=""></form>`), "2025-05-27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty.IsEmpty() {
+		t.Errorf("Expected an empty note, got %+v", empty)
+	}
+}
+
+func TestHealthTimeline_Incremental(t *testing.T) {
+	for _, name := range []string{"health.jsonl", "health.csv"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sub", name)
+
+			timeline, err := OpenHealthTimeline(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := timeline.Append(HealthNote{Date: "2025-05-26", WeightKg: 72.4, Notes: "a, \"quoted\" note"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := timeline.Append(HealthNote{Date: "2025-05-27", RestingHeartRate: 50}); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened, err := OpenHealthTimeline(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reopened.Days(), []string{"2025-05-26", "2025-05-27"}) {
+				t.Errorf("Days = %v", reopened.Days())
+			}
+			if reopened.Has("2025-05-28") {
+				t.Error("Expected 2025-05-28 not to be stored")
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Count(string(data), "\n"); strings.HasSuffix(name, ".csv") && lines != 3 || strings.HasSuffix(name, ".jsonl") && lines != 2 {
+				t.Errorf("Unexpected timeline file:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestHealthService_Sync_SkipsStoredDaysAndToday(t *testing.T) {
+	client := &MockRunalyzeClient{
+		HealthNotes: map[string][]byte{
+			"2025-05-27": []byte(`<input name="health_note[pulse_rest]" value="51">`),
+		},
+	}
+	timeline, err := OpenHealthTimeline(filepath.Join(t.TempDir(), "health.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := timeline.Append(HealthNote{Date: "2025-05-26", RestingHeartRate: 49}); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewHealthService(client, &MockLogger{})
+	service.now = func() time.Time { return time.Date(2025, 5, 29, 9, 0, 0, 0, time.UTC) }
+
+	since := time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	summary, err := service.Sync(context.Background(), since, until, timeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The 26th is stored already, the 29th is today
+	if !reflect.DeepEqual(client.HealthNoteCalls, []string{"2025-05-27", "2025-05-28"}) {
+		t.Errorf("HealthNoteCalls = %v", client.HealthNoteCalls)
+	}
+	if summary.Fetched != 1 || summary.Skipped != 1 || summary.Empty != 1 || summary.Errors != 0 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	// A second run only asks for the empty 28th again, which was filled in
+	client.HealthNoteCalls = nil
+	client.HealthNotes["2025-05-28"] = []byte(`<input name="health_note[weight]" value="71.5">`)
+	summary, err = service.Sync(context.Background(), since, until, timeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(client.HealthNoteCalls, []string{"2025-05-28"}) || summary.Fetched != 1 || summary.Skipped != 2 {
+		t.Errorf("Expected only the empty day fetched again, got calls %v and summary %+v", client.HealthNoteCalls, summary)
+	}
+}
+
+func TestOpenHealthTimeline_EmptyDaysArentSynced(t *testing.T) {
+	for _, name := range []string{"health.jsonl", "health.csv"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			timeline, err := OpenHealthTimeline(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Stored by versions that kept empty days
+			for _, note := range []HealthNote{{Date: "2025-05-26", WeightKg: 71.5}, {Date: "2025-05-27"}} {
+				if err := timeline.Append(note); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reopened, err := OpenHealthTimeline(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reopened.Has("2025-05-26") || reopened.Has("2025-05-27") {
+				t.Errorf("Days() = %v, want only the day with a note", reopened.Days())
+			}
+		})
+	}
+}
+
+func TestHealthService_Sync_StopsWhenLoggedOut(t *testing.T) {
+	client := &MockRunalyzeClient{HealthNoteError: runalyze.ErrRedirectedToLogin}
+	timeline, err := OpenHealthTimeline(filepath.Join(t.TempDir(), "health.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+	_, err = NewHealthService(client, &MockLogger{}).Sync(context.Background(), since, since.AddDate(0, 0, 7), timeline)
+	if err != runalyze.ErrRedirectedToLogin {
+		t.Errorf("Expected ErrRedirectedToLogin, got %v", err)
+	}
+	if len(client.HealthNoteCalls) != 1 {
+		t.Errorf("Expected the sync to stop after the first day, got %v", client.HealthNoteCalls)
+	}
+}
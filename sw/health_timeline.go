@@ -0,0 +1,175 @@
+package sw
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// healthCSVHeader is the header row of CSV health timelines
+var healthCSVHeader = []string{"date", "resting_hr", "max_hr", "weight_kg", "body_fat_pct", "water_pct", "muscle_pct", "sleep_minutes", "hrv_ms", "notes"}
+
+// HealthTimeline is a local file of health notes, one day per line, as JSON
+// Lines (.jsonl) or CSV (.csv). Days are only ever appended, so a synced day
+// is never fetched again. Empty notes are ignored when reading, so their
+// days don't count as synced.
+type HealthTimeline struct {
+	path string
+	csv  bool
+	days map[string]bool
+}
+
+// OpenHealthTimeline reads the days already stored in the timeline at path.
+// The format follows the extension; a missing file is an empty timeline.
+func OpenHealthTimeline(path string) (*HealthTimeline, error) {
+	t := &HealthTimeline{
+		path: path,
+		csv:  strings.EqualFold(filepath.Ext(path), ".csv"),
+		days: make(map[string]bool),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open health timeline: %w", err)
+	}
+	defer f.Close()
+
+	if t.csv {
+		err = t.readCSV(f)
+	} else {
+		err = t.readJSONL(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health timeline %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func (t *HealthTimeline) readJSONL(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var note HealthNote
+		if err := json.Unmarshal([]byte(line), &note); err != nil {
+			return err
+		}
+		if !note.IsEmpty() {
+			t.days[note.Date] = true
+		}
+	}
+	return scanner.Err()
+}
+
+func (t *HealthTimeline) readCSV(r io.Reader) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && record[0] == healthCSVHeader[0] {
+			continue
+		}
+		if len(record) > 0 && strings.Join(record[1:], "") != "" {
+			t.days[record[0]] = true
+		}
+	}
+	return nil
+}
+
+// Path returns the file the timeline is stored in
+func (t *HealthTimeline) Path() string {
+	return t.path
+}
+
+// Has reports whether day (YYYY-MM-DD) is already stored
+func (t *HealthTimeline) Has(day string) bool {
+	return t.days[day]
+}
+
+// Days returns the stored days in order
+func (t *HealthTimeline) Days() []string {
+	days := make([]string, 0, len(t.days))
+	for day := range t.days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// Append adds a day to the end of the timeline file
+func (t *HealthTimeline) Append(note HealthNote) error {
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create health timeline directory: %w", err)
+	}
+
+	_, statErr := os.Stat(t.path)
+	isNew := errors.Is(statErr, os.ErrNotExist)
+
+	f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open health timeline: %w", err)
+	}
+
+	if t.csv {
+		w := csv.NewWriter(f)
+		if isNew {
+			_ = w.Write(healthCSVHeader)
+		}
+		_ = w.Write(healthCSVRecord(note))
+		w.Flush()
+		err = w.Error()
+	} else {
+		var line []byte
+		line, err = json.Marshal(note)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append to health timeline: %w", err)
+	}
+
+	t.days[note.Date] = true
+	return nil
+}
+
+// healthCSVRecord renders note in the column order of healthCSVHeader,
+// leaving values that weren't entered empty
+func healthCSVRecord(note HealthNote) []string {
+	num := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return []string{
+		note.Date,
+		num(float64(note.RestingHeartRate)),
+		num(float64(note.MaxHeartRate)),
+		num(note.WeightKg),
+		num(note.BodyFatPct),
+		num(note.WaterPct),
+		num(note.MusclePct),
+		num(float64(note.SleepMinutes)),
+		num(note.HRV),
+		note.Notes,
+	}
+}
@@ -1,23 +1,51 @@
 package sw
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
 	"time"
+
+	"github.com/roessland/syncwich/runalyze"
 )
 
 // RunalyzeClient interface abstracts the Runalyze client for testing
 type RunalyzeClient interface {
-	GetFit(id string) ([]byte, string, error)
-	GetTcx(id string) ([]byte, string, error)
-	GetDataBrowser(date time.Time) ([]byte, error)
-	Login() error
+	StreamExportContext(ctx context.Context, id, format string, w io.Writer, progress runalyze.ProgressFunc) (string, error)
+	GetDataBrowserContext(ctx context.Context, date time.Time) ([]byte, error)
+	GetActivityPageContext(ctx context.Context, activityID string) ([]byte, error)
+	GetHealthNoteContext(ctx context.Context, day time.Time) ([]byte, error)
+	GetEquipmentPageContext(ctx context.Context) ([]byte, error)
+	GetActivityEditPageContext(ctx context.Context, activityID string) ([]byte, error)
+	SaveActivityContext(ctx context.Context, activityID string, form url.Values) error
+	UploadActivityContext(ctx context.Context, filename string, r io.Reader) (*runalyze.UploadResult, error)
+	GetAccountPageContext(ctx context.Context) ([]byte, error)
+	LoginContext(ctx context.Context) error
+	LogoutContext(ctx context.Context) error
 	PersistCookies() error
+	Cookies() []*http.Cookie
+	ClearCookies() error
+	ResetCookies() error
 }
 
 // FileSystem interface abstracts file operations for testing
 type FileSystem interface {
 	WriteFile(path string, data []byte, perm int) error
+	// WriteFileFrom creates path with the data write produces. Nothing is
+	// left at path if write fails.
+	WriteFileFrom(path string, perm int, write func(w io.Writer) error) error
+	// AppendFile appends data to path, creating it if it doesn't exist
+	AppendFile(path string, data []byte, perm int) error
+	// ReadFile returns the content of path. The error is os.ErrNotExist
+	// if there is no such file.
+	ReadFile(path string) ([]byte, error)
 	Exists(path string) bool
 	MkdirAll(path string, perm int) error
+	// Rename moves a file, replacing newpath if it exists
+	Rename(oldpath, newpath string) error
 }
 
 // Logger interface abstracts logging for testing
@@ -31,17 +59,44 @@ type Logger interface {
 type DownloadResult struct {
 	ActivityID string
 	Success    bool
-	FileType   string // "FIT", "TCX", or "NONE"
+	Format     string // export format, e.g. "fit-original"; the whole group (e.g. "fit-original|tcx") when FileType is "NONE"
+	FileType   string // label of Format, e.g. "FIT", "TCX", "GPX", or "NONE" if no format of the group was available
 	FilePath   string
 	Error      error
 	Existed    bool // true if file already existed
+	// Updated is true if the file was downloaded again because the activity
+	// changed upstream; PreviousPath is where the earlier version was kept
+	Updated      bool
+	PreviousPath string
+	Size         int64  // bytes written (0 if nothing was downloaded)
+	SHA256       string // hex digest of the written file
+	Attempts     int    // HTTP attempts made, including retries (0 if nothing was fetched)
+	Transient    bool   // true if Error is a transient failure (429/502/503, connection reset) that outlasted the retries
+}
+
+// Retryable reports whether a failed result may succeed in a later run: a
+// transient failure, an expired session or a file that couldn't be saved.
+// Formats Runalyze doesn't have and other permanent errors (404, parse
+// failures) won't get better by scanning the week again.
+func (r DownloadResult) Retryable() bool {
+	if r.Success || r.FileType == "NONE" || runalyze.IsNotFound(r.Error) {
+		return false
+	}
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	return r.Transient || errors.Is(r.Error, runalyze.ErrRedirectedToLogin) ||
+		errors.As(r.Error, &pathErr) || errors.As(r.Error, &linkErr)
 }
 
 // DownloadSummary represents the overall download results
 type DownloadSummary struct {
-	Processed int
-	Errors    int
-	Since     time.Time
-	Until     time.Time
-	Results   []DownloadResult
+	Processed   int // activities processed
+	Errors      int // failed results (one activity can fail in several formats)
+	Retryable   int // failed results a later run may fix, see DownloadResult.Retryable
+	Since       time.Time
+	Until       time.Time
+	Results     []DownloadResult // one per activity and format group
+	Interrupted bool             // true if the run was cancelled before the date range was exhausted
+	Tombstones  []Tombstone      // local activities found deleted upstream
+	ListError   error            // set if listing the activities stopped early
 }
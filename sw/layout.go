@@ -0,0 +1,206 @@
+package sw
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// DefaultLayout keeps every export in the save directory, named after the
+// activity ID
+const DefaultLayout = "{id}.{ext}"
+
+// layoutFieldRe matches the placeholders of a layout template
+var layoutFieldRe = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// layoutFields are the placeholders a layout may use, with the pattern
+// their values match when reading paths back
+var layoutFields = map[string]string{
+	"id":    `[0-9]+`,
+	"ext":   `[a-z0-9]+`,
+	"date":  `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+	"year":  `[0-9]{4}`,
+	"month": `[0-9]{2}`,
+	"day":   `[0-9]{2}`,
+	"sport": `[a-z0-9-]+`,
+}
+
+// Layout is where exports are saved in the save directory, given as a
+// template like "{year}/{month}/{date}_{sport}_{id}.{ext}". Directories are
+// separated by "/" on every OS.
+type Layout struct {
+	template string
+	re       *regexp.Regexp // matches paths the template produces
+}
+
+// ParseLayout parses a layout template. Empty means DefaultLayout. The
+// template must contain {id} and {ext}, so every export gets its own path,
+// and stay inside the save directory.
+func ParseLayout(template string) (Layout, error) {
+	if template == "" {
+		template = DefaultLayout
+	}
+	invalid := func(format string, args ...any) (Layout, error) {
+		return Layout{}, fmt.Errorf("invalid layout %q: %s", template, fmt.Sprintf(format, args...))
+	}
+
+	if strings.HasPrefix(template, "/") || filepath.IsAbs(template) {
+		return invalid("must be relative to the save directory")
+	}
+	for _, dir := range strings.Split(template, "/") {
+		switch dir {
+		case "", ".", "..":
+			return invalid("empty, '.' or '..' path element")
+		case TrashDir, VersionsDir:
+			return invalid("%s/ is reserved", dir)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, m := range layoutFieldRe.FindAllStringSubmatchIndex(template, -1) {
+		field := template[m[2]:m[3]]
+		fieldPattern, ok := layoutFields[field]
+		if !ok {
+			return invalid("unknown field {%s}", field)
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[last:m[0]]))
+		if seen[field] {
+			pattern.WriteString("(?:" + fieldPattern + ")")
+		} else {
+			pattern.WriteString("(?P<" + field + ">" + fieldPattern + ")")
+		}
+		seen[field] = true
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]) + "$")
+
+	if !seen["id"] || !seen["ext"] {
+		return invalid("must contain {id} and {ext}")
+	}
+	if strings.ContainsAny(layoutFieldRe.ReplaceAllString(template, ""), "{}") {
+		return invalid("unbalanced braces")
+	}
+	return Layout{template: template, re: regexp.MustCompile(pattern.String())}, nil
+}
+
+// String returns the template of the layout
+func (l Layout) String() string {
+	return l.template
+}
+
+// Path returns where the export of activity in format is saved
+func (l Layout) Path(saveDir string, activity ActivityInfo, format string) string {
+	date := activity.Date
+	if len(date) != len("2006-01-02") {
+		date = activity.WeekStart.Format("2006-01-02")
+	}
+	values := map[string]string{
+		"id":    activity.ID,
+		"ext":   formatExtension(format),
+		"date":  date,
+		"year":  date[:4],
+		"month": date[5:7],
+		"day":   date[8:10],
+		"sport": activitySport(activity),
+	}
+	rel := layoutFieldRe.ReplaceAllStringFunc(l.template, func(field string) string {
+		return values[field[1:len(field)-1]]
+	})
+	return filepath.Join(saveDir, filepath.FromSlash(rel))
+}
+
+// Match reads the activity ID and export format back from a path relative
+// to the save directory. ok is false if the layout can't produce rel.
+func (l Layout) Match(rel string) (activityID, format string, ok bool) {
+	m := l.re.FindStringSubmatch(filepath.ToSlash(rel))
+	if m == nil {
+		return "", "", false
+	}
+	ext := m[l.re.SubexpIndex("ext")]
+	return m[l.re.SubexpIndex("id")], extensionFormat(ext), true
+}
+
+// matchInfo is Match that also reads back what rel says about the
+// activity: its date, from {date} or {year}, {month} and {day}, and its
+// sport. What the layout doesn't have is left empty.
+func (l Layout) matchInfo(rel string) (activity ActivityInfo, format string, ok bool) {
+	m := l.re.FindStringSubmatch(filepath.ToSlash(rel))
+	if m == nil {
+		return ActivityInfo{}, "", false
+	}
+	field := func(name string) string {
+		if i := l.re.SubexpIndex(name); i >= 0 {
+			return m[i]
+		}
+		return ""
+	}
+	activity.ID = field("id")
+	activity.Type = field("sport")
+	activity.Date = field("date")
+	if year, month, day := field("year"), field("month"), field("day"); activity.Date == "" && year != "" && month != "" && day != "" {
+		activity.Date = year + "-" + month + "-" + day
+	}
+	return activity, extensionFormat(field("ext")), true
+}
+
+// usesDate reports whether paths of the layout depend on the activity date
+func (l Layout) usesDate() bool {
+	for _, field := range []string{"{date}", "{year}", "{month}", "{day}"} {
+		if strings.Contains(l.template, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTail is Match for a path whose save directory isn't known: it
+// matches the last path elements, as many as the layout has
+func (l Layout) MatchTail(p string) (activityID, format string, ok bool) {
+	elems := strings.Split(filepath.ToSlash(p), "/")
+	if n := strings.Count(l.template, "/") + 1; len(elems) > n {
+		elems = elems[len(elems)-n:]
+	}
+	return l.Match(strings.Join(elems, "/"))
+}
+
+// activitySport turns the databrowser icon of an activity into a name fit
+// for paths, e.g. "icons8-Regular-Biking" into "biking"
+func activitySport(activity ActivityInfo) string {
+	sport := strings.ToLower(activity.Type)
+	sport = strings.TrimPrefix(sport, "icons8-")
+	sport = strings.TrimPrefix(sport, "regular-")
+	sport = strings.Trim(nonSlugRe.ReplaceAllString(sport, "-"), "-")
+	if sport == "" {
+		return "unknown"
+	}
+	return sport
+}
+
+// nonSlugRe matches runs of characters that aren't used in path values
+var nonSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// extensionFormat is the export format saved with a file extension, the
+// inverse of formatExtension
+func extensionFormat(ext string) string {
+	if ext == formatExtension(runalyze.FitFormat) {
+		return runalyze.FitFormat
+	}
+	return ext
+}
+
+// layoutRel returns path relative to saveDir with "/" separators, for
+// showing and matching
+func layoutRel(saveDir, p string) string {
+	rel, err := filepath.Rel(saveDir, p)
+	if err != nil {
+		return p
+	}
+	return path.Clean(filepath.ToSlash(rel))
+}
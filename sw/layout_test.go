@@ -0,0 +1,66 @@
+package sw
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/runalyze"
+)
+
+func TestParseLayout(t *testing.T) {
+	valid := []string{"", DefaultLayout, "{year}/{month}/{date}_{sport}_{id}.{ext}", "{sport}/{id}/{id}.{ext}"}
+	for _, template := range valid {
+		if _, err := ParseLayout(template); err != nil {
+			t.Errorf("ParseLayout(%q): %v", template, err)
+		}
+	}
+
+	invalid := []string{
+		"{date}.{ext}",        // no {id}
+		"{id}",                // no {ext}
+		"/archive/{id}.{ext}", // absolute
+		"../{id}.{ext}",
+		"{year}//{id}.{ext}",
+		"trash/{id}.{ext}",
+		"{title}/{id}.{ext}",
+		"{id}.{ext}}",
+	}
+	for _, template := range invalid {
+		if _, err := ParseLayout(template); err == nil {
+			t.Errorf("ParseLayout(%q) succeeded", template)
+		}
+	}
+}
+
+func TestLayout_PathAndMatch(t *testing.T) {
+	layout, err := ParseLayout("{year}/{month}/{date}_{sport}_{id}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveDir := t.TempDir()
+	activity := ActivityInfo{ID: "135061341", Type: "icons8-Regular-Biking", Date: "2025-05-28"}
+
+	path := layout.Path(saveDir, activity, runalyze.FitFormat)
+	if want := filepath.Join(saveDir, "2025", "05", "2025-05-28_biking_135061341.fit"); path != want {
+		t.Errorf("Path() = %s, want %s", path, want)
+	}
+
+	id, format, ok := layout.Match(layoutRel(saveDir, path))
+	if !ok || id != "135061341" || format != runalyze.FitFormat {
+		t.Errorf("Match() = %q, %q, %v", id, format, ok)
+	}
+	if _, _, ok := layout.Match("135061341.fit"); ok {
+		t.Error("Match() accepted a path of another layout")
+	}
+	if id, _, ok := layout.MatchTail("/backup/2025/05/2025-05-28_biking_135061341.fit"); !ok || id != "135061341" {
+		t.Errorf("MatchTail() = %q, %v", id, ok)
+	}
+
+	// Without a date the week is used, without a sport "unknown"
+	week := time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+	path = layout.Path(saveDir, ActivityInfo{ID: "1", WeekStart: week}, "gpx")
+	if want := filepath.Join(saveDir, "2025", "05", "2025-05-26_unknown_1.gpx"); path != want {
+		t.Errorf("Path() = %s, want %s", path, want)
+	}
+}
@@ -1,8 +1,16 @@
 package sw
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
 	"time"
+
+	"github.com/roessland/syncwich/runalyze"
 )
 
 // MockRunalyzeClient implements RunalyzeClient for testing
@@ -16,34 +24,203 @@ type MockRunalyzeClient struct {
 	LoginCalled        bool
 	PersistCalled      bool
 	GetDataBrowserFunc func(date time.Time) ([]byte, error) // Allow custom behavior
+	// Exports and ExportErrors cover formats other than FIT and TCX.
+	// Formats missing from both return a 404.
+	Exports      map[string][]byte
+	ExportErrors map[string]error
+	ExportCalls  []string
+	// ActivityPages maps activity IDs to their activity page. Missing IDs
+	// return a 404.
+	ActivityPages map[string][]byte
+	// HealthNotes maps days (YYYY-MM-DD) to their health note. Missing
+	// days get an empty form.
+	HealthNotes     map[string][]byte
+	HealthNoteError error
+	HealthNoteCalls []string
+	EquipmentPage   []byte
+	// UploadResults maps filenames to the result of uploading them. Missing
+	// files are imported as activity "1".
+	UploadResults map[string]*runalyze.UploadResult
+	UploadError   error
+	UploadCalls   []string
+	// EditPages maps activity IDs to their edit form. Missing IDs return
+	// a 404.
+	EditPages  map[string][]byte
+	SavedForms map[string]url.Values
+	SaveError  error
+	// Session is what Cookies returns until ClearCookies or ResetCookies
+	// is called
+	Session       []*http.Cookie
+	AccountPage   []byte
+	LogoutError   error
+	LogoutCalled  bool
+	ClearedCookie bool
+	ResetCookie   bool
 }
 
-func (m *MockRunalyzeClient) GetFit(id string) ([]byte, string, error) {
-	if m.FitError != nil {
-		return nil, "", m.FitError
+func (m *MockRunalyzeClient) StreamExportContext(ctx context.Context, id, format string, w io.Writer, progress runalyze.ProgressFunc) (string, error) {
+	data, filename, err := m.getExport(ctx, id, format)
+	if err != nil {
+		return "", err
+	}
+	if progress != nil {
+		progress(0, int64(len(data)))
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
 	}
-	return m.FitData, "application/octet-stream", nil
+	if progress != nil {
+		progress(int64(len(data)), int64(len(data)))
+	}
+	return filename, nil
 }
 
-func (m *MockRunalyzeClient) GetTcx(id string) ([]byte, string, error) {
-	if m.TcxError != nil {
-		return nil, "", m.TcxError
+func (m *MockRunalyzeClient) getExport(ctx context.Context, id, format string) ([]byte, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	countAttempt(ctx)
+	m.ExportCalls = append(m.ExportCalls, format)
+	switch format {
+	case runalyze.FitFormat:
+		if m.FitError != nil {
+			return nil, "", m.FitError
+		}
+		return m.FitData, id + ".fit", nil
+	case runalyze.TcxFormat:
+		if m.TcxError != nil {
+			return nil, "", m.TcxError
+		}
+		return m.TcxData, id + ".tcx", nil
 	}
-	return m.TcxData, "application/xml", nil
+	if err := m.ExportErrors[format]; err != nil {
+		return nil, "", err
+	}
+	if data, ok := m.Exports[format]; ok {
+		return data, id + "." + format, nil
+	}
+	return nil, "", createNotFoundError()
 }
 
-func (m *MockRunalyzeClient) GetDataBrowser(date time.Time) ([]byte, error) {
+func (m *MockRunalyzeClient) GetDataBrowserContext(ctx context.Context, date time.Time) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if m.GetDataBrowserFunc != nil {
 		return m.GetDataBrowserFunc(date)
 	}
 	return []byte("<html>test</html>"), m.BrowserError
 }
 
-func (m *MockRunalyzeClient) Login() error {
+func (m *MockRunalyzeClient) GetActivityPageContext(ctx context.Context, activityID string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if page, ok := m.ActivityPages[activityID]; ok {
+		return page, nil
+	}
+	return nil, createNotFoundError()
+}
+
+func (m *MockRunalyzeClient) GetHealthNoteContext(ctx context.Context, day time.Time) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	date := day.Format("2006-01-02")
+	m.HealthNoteCalls = append(m.HealthNoteCalls, date)
+	if m.HealthNoteError != nil {
+		return nil, m.HealthNoteError
+	}
+	if page, ok := m.HealthNotes[date]; ok {
+		return page, nil
+	}
+	return []byte(`<form><input name="health_note[weight]" value=""></form>`), nil
+}
+
+func (m *MockRunalyzeClient) GetEquipmentPageContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.EquipmentPage, nil
+}
+
+func (m *MockRunalyzeClient) GetActivityEditPageContext(ctx context.Context, activityID string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if page, ok := m.EditPages[activityID]; ok {
+		return page, nil
+	}
+	return nil, createNotFoundError()
+}
+
+func (m *MockRunalyzeClient) SaveActivityContext(ctx context.Context, activityID string, form url.Values) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.SaveError != nil {
+		return m.SaveError
+	}
+	if m.SavedForms == nil {
+		m.SavedForms = make(map[string]url.Values)
+	}
+	m.SavedForms[activityID] = form
+	return nil
+}
+
+func (m *MockRunalyzeClient) UploadActivityContext(ctx context.Context, filename string, r io.Reader) (*runalyze.UploadResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.UploadCalls = append(m.UploadCalls, filename)
+	if m.UploadError != nil {
+		return nil, m.UploadError
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		return nil, err
+	}
+	if result, ok := m.UploadResults[filename]; ok {
+		return result, nil
+	}
+	return &runalyze.UploadResult{Status: runalyze.UploadImported, ActivityID: "1"}, nil
+}
+
+func (m *MockRunalyzeClient) LoginContext(ctx context.Context) error {
 	m.LoginCalled = true
 	return m.LoginError
 }
 
+func (m *MockRunalyzeClient) LogoutContext(ctx context.Context) error {
+	m.LogoutCalled = true
+	return m.LogoutError
+}
+
+func (m *MockRunalyzeClient) GetAccountPageContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.AccountPage == nil {
+		return nil, runalyze.ErrRedirectedToLogin
+	}
+	return m.AccountPage, nil
+}
+
+func (m *MockRunalyzeClient) Cookies() []*http.Cookie {
+	return m.Session
+}
+
+func (m *MockRunalyzeClient) ClearCookies() error {
+	m.ClearedCookie = true
+	m.Session = nil
+	return nil
+}
+
+func (m *MockRunalyzeClient) ResetCookies() error {
+	m.ResetCookie = true
+	m.Session = nil
+	return nil
+}
+
 func (m *MockRunalyzeClient) PersistCookies() error {
 	m.PersistCalled = true
 	return nil
@@ -79,11 +256,45 @@ func (m *MockFileSystem) WriteFile(path string, data []byte, perm int) error {
 	return nil
 }
 
+func (m *MockFileSystem) WriteFileFrom(path string, perm int, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	return m.WriteFile(path, buf.Bytes(), perm)
+}
+
+func (m *MockFileSystem) AppendFile(path string, data []byte, perm int) error {
+	if m.WriteError != nil {
+		return m.WriteError
+	}
+	m.Files[path] = append(m.Files[path], data...)
+	return nil
+}
+
+func (m *MockFileSystem) ReadFile(path string) ([]byte, error) {
+	data, ok := m.Files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
 func (m *MockFileSystem) Exists(path string) bool {
 	_, exists := m.Files[path]
 	return exists
 }
 
+func (m *MockFileSystem) Rename(oldpath, newpath string) error {
+	data, ok := m.Files[oldpath]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(m.Files, oldpath)
+	m.Files[newpath] = data
+	return nil
+}
+
 func (m *MockFileSystem) MkdirAll(path string, perm int) error {
 	m.MkdirCalls = append(m.MkdirCalls, path)
 	return m.MkdirError
@@ -94,6 +305,8 @@ type MockLogger struct {
 	InfoCalls  []LogCall
 	DebugCalls []LogCall
 	WarnCalls  []LogCall
+
+	mu sync.Mutex // download workers log concurrently
 }
 
 type LogCall struct {
@@ -102,18 +315,36 @@ type LogCall struct {
 }
 
 func (m *MockLogger) Info(msg string, args ...any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.InfoCalls = append(m.InfoCalls, LogCall{Message: msg, Args: args})
 }
 
 func (m *MockLogger) Debug(msg string, args ...any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.DebugCalls = append(m.DebugCalls, LogCall{Message: msg, Args: args})
 }
 
 func (m *MockLogger) Warn(msg string, args ...any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.WarnCalls = append(m.WarnCalls, LogCall{Message: msg, Args: args})
 }
 
+// countAttempt mimics the real client recording into runalyze.RequestStats
+func countAttempt(ctx context.Context) {
+	if stats := runalyze.RequestStatsFromContext(ctx); stats != nil {
+		stats.Attempts++
+	}
+}
+
 // Helper function to create a not found error (404)
 func createNotFoundError() error {
-	return fmt.Errorf("unexpected status code: 404")
+	return &runalyze.StatusError{StatusCode: http.StatusNotFound}
+}
+
+// Helper function to create a WAF bad gateway error (502)
+func createBadGatewayError() error {
+	return &runalyze.StatusError{StatusCode: http.StatusBadGateway}
 }
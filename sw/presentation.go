@@ -1,17 +1,32 @@
 package sw
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/pterm/pterm"
 	"github.com/roessland/syncwich/pkg/errs"
 	"github.com/roessland/syncwich/pkg/output"
 )
 
 // PresentationService handles all presentation logic
 type PresentationService struct {
-	ol *output.OutputLogger
+	ol   *output.OutputLogger
+	live *liveDownload
 }
 
+// liveDownload is the activity line updated in place while an export downloads
+type liveDownload struct {
+	activityID string
+	area       *pterm.AreaPrinter
+	step       int64 // last progress step shown, to avoid redrawing on every write
+}
+
+// unknownSizeStep is how often progress of an export of unknown size is redrawn
+const unknownSizeStep = 256 * 1024
+
 // NewPresentationService creates a new presentation service
 func NewPresentationService(ol *output.OutputLogger) *PresentationService {
 	return &PresentationService{ol: ol}
@@ -32,63 +47,556 @@ func (ps *PresentationService) ShowError(err error, msg string, args ...any) {
 	ps.ol.LogAndShowError(err, msg, args...)
 }
 
+// ShowWarning displays a warning
+func (ps *PresentationService) ShowWarning(msg string, args ...any) {
+	ps.ol.Warning(msg, args...)
+}
+
 // ShowWeekHeader displays a week header
 func (ps *PresentationService) ShowWeekHeader(weekStart, weekEnd time.Time) {
 	ps.ol.WeekHeader(weekStart, weekEnd)
 }
 
-// ShowActivityResult displays the result of downloading an activity
-func (ps *PresentationService) ShowActivityResult(activity ActivityInfo, result DownloadResult) {
-	if result.Existed {
-		// File already existed
-		ps.ol.ActivityLine(activity.TypeEmoji, activity.ID, output.FileInfo{
-			Type:  result.FileType,
-			State: output.StateExists,
-		})
-		return
+// ShowDownloadProgress updates the activity line of an export that is
+// downloading. It has the signature of DownloadProgressFunc.
+func (ps *PresentationService) ShowDownloadProgress(activity ActivityInfo, format string, written, total int64) {
+	if ps.ol.JSONMode() {
+		return // the result is logged when the download finishes
 	}
 
-	if !result.Success {
-		if result.FileType == "NONE" {
-			// Neither format available
-			ps.ol.ActivityLine(activity.TypeEmoji, activity.ID, output.FileInfo{
-				Type:  "FIT/TCX",
-				State: output.StateNotAvailable,
-			})
-		} else {
-			// Download or save error
-			ps.ol.ActivityLine(activity.TypeEmoji, activity.ID, output.FileInfo{
-				Type:  result.FileType,
-				State: output.StateError,
-			})
+	info := output.FileInfo{Type: formatLabel(format), State: output.StateDownloading, Progress: -1, Bytes: written}
+	step := written / unknownSizeStep
+	if total > 0 {
+		info.Progress = int(written * 100 / total)
+		step = int64(info.Progress)
+	}
+
+	if ps.live == nil || ps.live.activityID != activity.ID {
+		ps.live = &liveDownload{
+			activityID: activity.ID,
+			area:       ps.ol.ActivityLine(activity.TypeEmoji, activity.ID, info),
+			step:       step,
 		}
 		return
 	}
+	if step == ps.live.step {
+		return
+	}
+	ps.live.step = step
+	ps.ol.UpdateActivityLine(ps.live.area, activity.TypeEmoji, activity.ID, info)
+}
+
+// ShowActivityResult displays the result of downloading an activity
+func (ps *PresentationService) ShowActivityResult(activity ActivityInfo, result DownloadResult) {
+	if live := ps.live; live != nil && live.activityID == activity.ID {
+		// Finish the line that showed the download progress
+		ps.live = nil
+		ps.ol.UpdateActivityLine(live.area, activity.TypeEmoji, activity.ID, resultFileInfo(result))
+		return
+	}
 
-	// Successfully downloaded
-	ps.ol.ActivityLine(activity.TypeEmoji, activity.ID, output.FileInfo{
-		Type:  result.FileType,
-		State: output.StateDownloaded,
-	})
+	ps.ol.ActivityLine(activity.TypeEmoji, activity.ID, resultFileInfo(result))
+}
+
+// resultFileInfo is the final state of a result's activity line
+func resultFileInfo(result DownloadResult) output.FileInfo {
+	switch {
+	case result.Existed:
+		return output.FileInfo{Type: result.FileType, State: output.StateExists}
+	case result.Updated:
+		return output.FileInfo{Type: result.FileType, State: output.StateUpdated}
+	case result.Success:
+		return output.FileInfo{Type: result.FileType, State: output.StateDownloaded}
+	case result.FileType == "NONE":
+		return output.FileInfo{Type: groupLabel(strings.Split(result.Format, "|")), State: output.StateNotAvailable}
+	default:
+		return output.FileInfo{Type: result.FileType, State: output.StateError}
+	}
 }
 
 // ShowFinalResults displays the final download summary
 func (ps *PresentationService) ShowFinalResults(summary *DownloadSummary) {
+	ps.showTombstones(summary.Tombstones)
+	if summary.Interrupted {
+		ps.ol.Result("Download interrupted: %d processed, %d errors", summary.Processed, summary.Errors)
+		return
+	}
 	ps.ol.Result("Download complete: %d processed, %d errors", summary.Processed, summary.Errors)
 }
 
+// showTombstones lists the local activities that were deleted upstream
+func (ps *PresentationService) showTombstones(tombstones []Tombstone) {
+	if ps.ol.JSONMode() || len(tombstones) == 0 {
+		return
+	}
+	ps.ol.Warning("%d local activities were deleted in Runalyze:", len(tombstones))
+	for _, t := range tombstones {
+		switch {
+		case t.Error != nil:
+			ps.ol.Error("  %s (%s): %v", t.ActivityID, t.Date, t.Error)
+		case t.Action == RemoteDeleteTrash:
+			ps.ol.Status("  %s (%s): moved %d files to %s/", t.ActivityID, t.Date, len(t.Files), TrashDir)
+		case t.Action == RemoteDeleteKeep:
+			ps.ol.Status("  %s (%s): kept %d files, marked as tombstoned", t.ActivityID, t.Date, len(t.Files))
+		default:
+			ps.ol.Status("  %s (%s): %d files", t.ActivityID, t.Date, len(t.Files))
+		}
+	}
+}
+
 // ShowJSONResults outputs structured JSON results
 func (ps *PresentationService) ShowJSONResults(summary *DownloadSummary, jsonMode bool) {
 	if jsonMode {
 		errs.Check(ps.ol.JSON(map[string]any{
-			"summary": map[string]int{
-				"processed": summary.Processed,
-				"errors":    summary.Errors,
+			"summary": map[string]any{
+				"processed":   summary.Processed,
+				"errors":      summary.Errors,
+				"interrupted": summary.Interrupted,
 			},
 			"date_range": map[string]string{
 				"since": summary.Since.Format("2006-01-02"),
 				"until": summary.Until.Format("2006-01-02"),
 			},
+			"files":            jsonResults(summary.Results),
+			"deleted_upstream": jsonTombstones(summary.Tombstones),
 		}))
 	}
 }
+
+// jsonResults renders one entry per activity and format so automation can
+// see exactly which files each run wrote
+func jsonResults(results []DownloadResult) []map[string]any {
+	entries := make([]map[string]any, 0, len(results))
+	for _, r := range results {
+		entry := map[string]any{
+			"activity_id": r.ActivityID,
+			"format":      r.Format,
+			"file_type":   r.FileType,
+			"success":     r.Success,
+			"existed":     r.Existed,
+			"updated":     r.Updated,
+			"attempts":    r.Attempts,
+		}
+		if r.FilePath != "" {
+			entry["path"] = r.FilePath
+		}
+		if r.PreviousPath != "" {
+			entry["previous_path"] = r.PreviousPath
+		}
+		if r.SHA256 != "" {
+			entry["size"] = r.Size
+			entry["sha256"] = r.SHA256
+		}
+		if r.Error != nil {
+			entry["error"] = r.Error.Error()
+			entry["transient"] = r.Transient
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// jsonTombstones renders the local activities that were deleted upstream
+func jsonTombstones(tombstones []Tombstone) []map[string]any {
+	entries := make([]map[string]any, 0, len(tombstones))
+	for _, t := range tombstones {
+		entry := map[string]any{
+			"activity_id": t.ActivityID,
+			"date":        t.Date,
+			"files":       t.Files,
+			"action":      t.Action,
+		}
+		if t.Error != nil {
+			entry["error"] = t.Error.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// ShowActivityDetails prints the details of an activity as tables, or as a
+// JSON object in JSON mode
+func (ps *PresentationService) ShowActivityDetails(details *ActivityDetails) {
+	if ps.ol.JSONMode() {
+		errs.Check(ps.ol.JSON(details))
+		return
+	}
+
+	rows := [][]string{{"Field", "Value"}}
+	add := func(field, value string) {
+		if value != "" {
+			rows = append(rows, []string{field, value})
+		}
+	}
+	add("ID", details.ID)
+	add("Title", details.Title)
+	add("Sport", firstNonEmpty(details.Sport, strings.TrimPrefix(details.SportIcon, "icons8-")))
+	add("Type", details.TrainingType)
+	add("Start", formatTime(details.StartTime))
+	if details.DistanceKm > 0 {
+		add("Distance", fmt.Sprintf("%.2f km", details.DistanceKm))
+	}
+	if details.Duration > 0 {
+		add("Duration", formatClock(details.Duration))
+	}
+	if e := details.Elevation; e.AscentM > 0 || e.DescentM > 0 {
+		add("Elevation", fmt.Sprintf("↑ %d m ↓ %d m", e.AscentM, e.DescentM))
+	}
+	if e := details.Elevation; e.MinM != 0 || e.MaxM != 0 {
+		add("Min/max elevation", fmt.Sprintf("%d m / %d m", e.MinM, e.MaxM))
+	}
+	if details.VO2max.Value > 0 {
+		vo2max := fmt.Sprintf("%.2f", details.VO2max.Value)
+		if !details.VO2max.UsedForShape {
+			vo2max += " (not used for shape)"
+		}
+		add("VO2max", vo2max)
+	}
+	add("Equipment", strings.Join(details.Equipment, ", "))
+	add("Created", formatTime(details.Created))
+	add("Edited", formatTime(details.Edited))
+	add("Exports", strings.Join(details.ExportFormats, ", "))
+	add("Notes", details.Notes)
+	ps.ol.Table(rows)
+
+	if len(details.Laps) == 0 {
+		return
+	}
+	laps := [][]string{{"Lap", "Distance", "Time", "Pace", "HR", "Asc."}}
+	for _, lap := range details.Laps {
+		pace := ""
+		switch {
+		case lap.PacePerKm > 0:
+			pace = formatClock(lap.PacePerKm) + "/km"
+		case lap.SpeedKmh > 0:
+			pace = fmt.Sprintf("%.1f km/h", lap.SpeedKmh)
+		}
+		heartRate := ""
+		if lap.AvgHeartRate > 0 {
+			heartRate = fmt.Sprintf("%d bpm", lap.AvgHeartRate)
+		}
+		laps = append(laps, []string{
+			fmt.Sprint(lap.Number),
+			fmt.Sprintf("%.2f km", lap.DistanceKm),
+			formatClock(lap.Duration),
+			pace,
+			heartRate,
+			fmt.Sprintf("%d m", lap.AscentM),
+		})
+	}
+	ps.ol.Table(laps)
+}
+
+// formatClock renders d as Runalyze does: "38:45" or "1:02:03"
+func formatClock(d time.Duration) string {
+	total := int(d.Round(time.Second).Seconds())
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// formatTime renders t as "2006-01-02 15:04", or "" if t is zero
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ShowHealthResults displays the outcome of a health sync
+func (ps *PresentationService) ShowHealthResults(summary *HealthSummary, path string) {
+	if ps.ol.JSONMode() {
+		errs.Check(ps.ol.JSON(map[string]any{
+			"health": map[string]any{
+				"fetched":     summary.Fetched,
+				"skipped":     summary.Skipped,
+				"empty":       summary.Empty,
+				"errors":      summary.Errors,
+				"interrupted": summary.Interrupted,
+				"path":        path,
+			},
+		}))
+		return
+	}
+	verb := "complete"
+	if summary.Interrupted {
+		verb = "interrupted"
+	}
+	ps.ol.Result("Health sync %s: %d new days, %d already stored, %d empty, %d errors (%s)", verb, summary.Fetched, summary.Skipped, summary.Empty, summary.Errors, path)
+}
+
+// ShowEquipment lists the gear in inv with its Runalyze and local mileage,
+// warning about shoes in use that reached warnKm
+func (ps *PresentationService) ShowEquipment(inv *EquipmentInventory, warnKm float64) {
+	mileage := inv.Mileage()
+	worn := WornShoes(inv, warnKm)
+
+	if ps.ol.JSONMode() {
+		entries := make([]map[string]any, 0, len(inv.Equipment))
+		for _, e := range inv.Equipment {
+			entries = append(entries, map[string]any{
+				"name":              e.Name,
+				"category":          e.Category,
+				"distance_km":       e.DistanceKm,
+				"local_distance_km": mileage[e.Name].DistanceKm,
+				"local_activities":  mileage[e.Name].Activities,
+				"retired":           e.Retired,
+			})
+		}
+		wornNames := make([]string, 0, len(worn))
+		for _, e := range worn {
+			wornNames = append(wornNames, e.Name)
+		}
+		errs.Check(ps.ol.JSON(map[string]any{"equipment": entries, "worn_shoes": wornNames, "warn_km": warnKm}))
+		return
+	}
+
+	rows := [][]string{{"Name", "Category", "Runalyze", "Local archive", "Activities", "Status"}}
+	for _, e := range inv.Equipment {
+		status := "in use"
+		if e.Retired {
+			status = "retired"
+		}
+		m := mileage[e.Name]
+		rows = append(rows, []string{
+			e.Name,
+			e.Category,
+			fmt.Sprintf("%.1f km", e.DistanceKm),
+			fmt.Sprintf("%.1f km", m.DistanceKm),
+			fmt.Sprint(m.Activities),
+			status,
+		})
+	}
+	if len(inv.Equipment) > 0 {
+		ps.ol.Table(rows)
+	}
+
+	for _, e := range worn {
+		ps.ol.Warning("%s has run %.0f km, past the %.0f km warning threshold", e.Name, max(e.DistanceKm, mileage[e.Name].DistanceKm), warnKm)
+	}
+}
+
+// ShowUploadResult displays the outcome of uploading a single file
+func (ps *PresentationService) ShowUploadResult(result FileUploadResult) {
+	if ps.ol.JSONMode() {
+		return
+	}
+	name := filepath.Base(result.Path)
+	switch result.Outcome {
+	case UploadImported:
+		ps.ol.Result("%s imported as activity %s", name, result.ActivityID)
+	case UploadSkipped:
+		ps.ol.Status("%s skipped, activity %s is already in the account", name, result.ActivityID)
+	case UploadDuplicate:
+		ps.ol.Warning("%s is a duplicate: %s", name, result.Message)
+	case UploadRejected:
+		ps.ol.Warning("%s was rejected: %s", name, result.Message)
+	default:
+		ps.ol.Error("%s failed to upload: %v", name, result.Error)
+	}
+}
+
+// ShowUploadResults displays the outcome of an upload run
+func (ps *PresentationService) ShowUploadResults(summary *UploadSummary) {
+	if ps.ol.JSONMode() {
+		files := make([]map[string]any, 0, len(summary.Results))
+		for _, r := range summary.Results {
+			entry := map[string]any{
+				"path":        r.Path,
+				"outcome":     r.Outcome,
+				"activity_id": r.ActivityID,
+			}
+			if r.Message != "" {
+				entry["message"] = r.Message
+			}
+			if r.Error != nil {
+				entry["error"] = r.Error.Error()
+			}
+			files = append(files, entry)
+		}
+		errs.Check(ps.ol.JSON(map[string]any{
+			"upload": map[string]any{
+				"files":       files,
+				"interrupted": summary.Interrupted,
+			},
+		}))
+		return
+	}
+	verb := "complete"
+	if summary.Interrupted {
+		verb = "interrupted"
+	}
+	ps.ol.Result("Upload %s: %d imported, %d duplicates, %d rejected, %d skipped, %d errors", verb,
+		summary.Count(UploadImported), summary.Count(UploadDuplicate), summary.Count(UploadRejected),
+		summary.Count(UploadSkipped), summary.Count(UploadFailed))
+}
+
+// ShowEditResult displays what an edit changed on an activity, or would
+// change in a dry run
+func (ps *PresentationService) ShowEditResult(result EditResult, dryRun bool) {
+	if ps.ol.JSONMode() {
+		return
+	}
+	switch {
+	case result.Error != nil:
+		ps.ol.Error("%s: %v", result.ActivityID, result.Error)
+		return
+	case len(result.Changes) == 0:
+		ps.ol.Status("%s unchanged", result.ActivityID)
+		return
+	case dryRun:
+		ps.ol.Status("%s would change:", result.ActivityID)
+	default:
+		ps.ol.Result("%s updated:", result.ActivityID)
+	}
+	for _, c := range result.Changes {
+		ps.ol.Status("  %s: %q → %q", c.Field, c.Old, c.New)
+	}
+}
+
+// ShowEditResults displays the outcome of an edit run
+func (ps *PresentationService) ShowEditResults(summary *EditSummary) {
+	changed, unchanged, failed := summary.Count()
+	if ps.ol.JSONMode() {
+		activities := make([]map[string]any, 0, len(summary.Results))
+		for _, r := range summary.Results {
+			changes := make([]map[string]any, 0, len(r.Changes))
+			for _, c := range r.Changes {
+				changes = append(changes, map[string]any{"field": c.Field, "old": c.Old, "new": c.New})
+			}
+			entry := map[string]any{"activity_id": r.ActivityID, "changes": changes, "saved": r.Saved}
+			if r.Error != nil {
+				entry["error"] = r.Error.Error()
+			}
+			activities = append(activities, entry)
+		}
+		errs.Check(ps.ol.JSON(map[string]any{
+			"edit": map[string]any{
+				"activities":  activities,
+				"dry_run":     summary.DryRun,
+				"interrupted": summary.Interrupted,
+			},
+		}))
+		return
+	}
+	verb := "complete"
+	if summary.Interrupted {
+		verb = "interrupted"
+	}
+	if summary.DryRun {
+		ps.ol.Result("Dry run %s: %d would change, %d unchanged, %d errors (nothing was saved)", verb, changed, unchanged, failed)
+		return
+	}
+	ps.ol.Result("Edit %s: %d updated, %d unchanged, %d errors", verb, changed, unchanged, failed)
+}
+
+// ShowReorganizeResults lists the exports moved from one layout to another,
+// or that would be in a dry run
+func (ps *PresentationService) ShowReorganizeResults(summary *ReorganizeSummary, saveDir string, from, to Layout) {
+	moved, failed := summary.Count()
+	if ps.ol.JSONMode() {
+		moves := make([]map[string]any, 0, len(summary.Moves))
+		for _, m := range summary.Moves {
+			entry := map[string]any{"activity_id": m.ActivityID, "format": m.Format, "from": m.From, "to": m.To}
+			if m.Error != nil {
+				entry["error"] = m.Error.Error()
+			}
+			moves = append(moves, entry)
+		}
+		skipped := summary.Skipped
+		if skipped == nil {
+			skipped = []string{}
+		}
+		errs.Check(ps.ol.JSON(map[string]any{
+			"reorganize": map[string]any{
+				"from":    from.String(),
+				"to":      to.String(),
+				"moves":   moves,
+				"skipped": skipped,
+				"dry_run": summary.DryRun,
+			},
+		}))
+		return
+	}
+
+	ps.ol.Status("Reorganizing %s from %s to %s", saveDir, from, to)
+	for _, m := range summary.Moves {
+		if m.Error != nil {
+			ps.ol.Error("  %s: %v", layoutRel(saveDir, m.From), m.Error)
+			continue
+		}
+		ps.ol.Status("  %s → %s", layoutRel(saveDir, m.From), layoutRel(saveDir, m.To))
+	}
+	if len(summary.Skipped) > 0 {
+		ps.ol.Warning("%d files of activities syncwich has no record of were left in place, since the new layout needs their date; run 'syncwich download' over their dates first", len(summary.Skipped))
+	}
+	if summary.DryRun {
+		ps.ol.Result("Dry run complete: %d would move, %d errors (nothing was moved)", moved, failed)
+		return
+	}
+	ps.ol.Result("Reorganize complete: %d moved, %d errors", moved, failed)
+}
+
+// ShowSessionStatus lists the stored session cookies with their expiry
+// and whether Runalyze accepts the session, warning if the remember-me
+// cookie expires within warnBefore
+func (ps *PresentationService) ShowSessionStatus(status *SessionStatus, warnBefore time.Duration) {
+	if ps.ol.JSONMode() {
+		errs.Check(ps.ol.JSON(map[string]any{"session": status}))
+		return
+	}
+
+	rows := [][]string{{"Cookie", "Domain", "Expires"}}
+	for _, c := range status.Cookies {
+		expires := "end of session"
+		if !c.Expires.IsZero() {
+			expires = formatTime(c.Expires.Local())
+		}
+		rows = append(rows, []string{c.Name, c.Domain, expires})
+	}
+	if len(status.Cookies) > 0 {
+		ps.ol.Table(rows)
+	}
+
+	switch {
+	case !status.Valid:
+		ps.ol.Error("Session is not valid, run 'syncwich auth login'")
+		return
+	case status.RememberMeExpires.IsZero():
+		ps.ol.Warning("Session is valid, but there is no remember-me cookie to renew it")
+		return
+	}
+	remaining := time.Until(status.RememberMeExpires)
+	if warnBefore > 0 && remaining < warnBefore {
+		ps.ol.Warning("Session is valid, but the remember-me cookie expires in %d days", int(remaining.Hours()/24))
+		return
+	}
+	ps.ol.Result("Session is valid, remember-me cookie expires %s", status.RememberMeExpires.Local().Format("2006-01-02"))
+}
+
+// ShowAccount displays the account the session belongs to
+func (ps *PresentationService) ShowAccount(account *Account) {
+	if ps.ol.JSONMode() {
+		errs.Check(ps.ol.JSON(map[string]any{"account": account}))
+		return
+	}
+	switch {
+	case account.Name != "" && account.Email != "":
+		ps.ol.Result("Logged in as %s (%s, %s)", account.Username, account.Name, account.Email)
+	case account.Name != "":
+		ps.ol.Result("Logged in as %s (%s)", account.Username, account.Name)
+	default:
+		ps.ol.Result("Logged in as %s", account.Username)
+	}
+}
@@ -0,0 +1,206 @@
+package sw
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// ReorganizeConfig holds the configuration of the reorganize command
+type ReorganizeConfig struct {
+	SaveDir     string
+	CatalogPath string // empty means DefaultCatalogPath
+	From        string // layout the archive is in; empty means DefaultLayout
+	To          string // layout to move the archive to; empty means DefaultLayout
+	DryRun      bool
+	JSONMode    bool
+}
+
+// Move is an export that is moved from one layout to another
+type Move struct {
+	ActivityID string
+	Format     string
+	From       string
+	To         string
+	Error      error // set if the export can't be or couldn't be moved
+}
+
+// ReorganizeSummary is the outcome of a reorganize run
+type ReorganizeSummary struct {
+	Moves []Move
+	// Skipped are files of the old layout that aren't moved because the new
+	// layout needs the date of an activity that isn't in the catalog
+	Skipped []string
+	DryRun  bool
+}
+
+// Count returns how many exports were moved (or would be, in a dry run)
+// and how many failed
+func (s *ReorganizeSummary) Count() (moved, failed int) {
+	for _, m := range s.Moves {
+		if m.Error != nil {
+			failed++
+		} else {
+			moved++
+		}
+	}
+	return moved, failed
+}
+
+// ReorganizeService moves the exports in a save directory from one layout
+// to another, taking the activity metadata the new layout needs from the
+// catalog
+type ReorganizeService struct {
+	fs      FileSystem
+	logger  Logger
+	saveDir string
+	catalog *Catalog
+	now     func() time.Time
+}
+
+// NewReorganizeService creates a reorganize service for the archive in
+// saveDir, with the catalog opened for it
+func NewReorganizeService(fs FileSystem, logger Logger, saveDir string, catalog *Catalog) *ReorganizeService {
+	return &ReorganizeService{
+		fs:      fs,
+		logger:  logger,
+		saveDir: saveDir,
+		catalog: catalog,
+		now:     time.Now,
+	}
+}
+
+// Plan lists the moves that take the exports saved under from to where to
+// puts them. Activities that aren't in the catalog keep the date and sport
+// their old path shows, or get sport "unknown"; they are skipped if to
+// needs a date the old path doesn't have. Exports already in place aren't
+// listed. Moves that would overwrite a file, or another export, carry an
+// error.
+func (r *ReorganizeService) Plan(from, to Layout) (*ReorganizeSummary, error) {
+	summary := &ReorganizeSummary{Moves: []Move{}}
+	targets := make(map[string]string) // target → source
+
+	err := filepath.WalkDir(r.saveDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := layoutRel(r.saveDir, path)
+		if d.IsDir() {
+			if rel == TrashDir || rel == VersionsDir || (rel != "." && strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		activity, format, ok := from.matchInfo(rel)
+		if !ok {
+			return nil
+		}
+		if entry := r.catalog.Get(activity.ID); entry != nil {
+			activity = entry.Activity.ActivityInfo()
+		} else if activity.Date == "" && to.usesDate() {
+			// Not in the catalog, and the old path doesn't tell the date
+			r.logger.Warn("activity date unknown, not moving it", "activity_id", activity.ID, "path", path)
+			summary.Skipped = append(summary.Skipped, path)
+			return nil
+		}
+
+		target := to.Path(r.saveDir, activity, format)
+		if target == path {
+			return nil
+		}
+		move := Move{ActivityID: activity.ID, Format: format, From: path, To: target}
+		switch {
+		case targets[target] != "":
+			move.Error = fmt.Errorf("%s is also moved there", targets[target])
+		case r.fs.Exists(target):
+			move.Error = fmt.Errorf("%s already exists", target)
+		}
+		targets[target] = path
+		summary.Moves = append(summary.Moves, move)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", r.saveDir, err)
+	}
+	return summary, nil
+}
+
+// Apply moves the exports of summary that have no error, and updates
+// their paths in the catalog
+func (r *ReorganizeService) Apply(summary *ReorganizeSummary) {
+	for i := range summary.Moves {
+		move := &summary.Moves[i]
+		if move.Error != nil {
+			continue
+		}
+		if err := r.fs.MkdirAll(filepath.Dir(move.To), 0755); err != nil {
+			move.Error = fmt.Errorf("failed to create directory: %w", err)
+			continue
+		}
+		if err := r.fs.Rename(move.From, move.To); err != nil {
+			move.Error = fmt.Errorf("failed to move: %w", err)
+			continue
+		}
+		if err := r.catalog.MoveExport(move.ActivityID, move.Format, move.To, r.now()); err != nil {
+			r.logger.Warn("failed to update catalog", "activity_id", move.ActivityID, "error", err)
+		}
+	}
+	if err := r.catalog.Compact(); err != nil {
+		r.logger.Warn("failed to compact catalog", "error", err)
+	}
+}
+
+// Reorganize moves the exports in the save directory from one layout to
+// another, or shows what would move in a dry run
+func Reorganize(config ReorganizeConfig) error {
+	_, logger, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+
+	from, err := ParseLayout(config.From)
+	if err != nil {
+		return err
+	}
+	to, err := ParseLayout(config.To)
+	if err != nil {
+		return err
+	}
+	saveDir, err := homedir.Expand(config.SaveDir)
+	if err == nil {
+		saveDir, err = filepath.Abs(saveDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	fs := NewOSFileSystem()
+	catalog, err := openCatalog(fs, config.CatalogPath, saveDir)
+	if err != nil {
+		presentation.ShowError(err, "Failed to open activity catalog")
+		return err
+	}
+
+	service := NewReorganizeService(fs, logger, saveDir, catalog)
+	summary, err := service.Plan(from, to)
+	if err != nil {
+		presentation.ShowError(err, "Failed to read the archive")
+		return err
+	}
+	summary.DryRun = config.DryRun
+
+	if !config.DryRun {
+		service.Apply(summary)
+	}
+	presentation.ShowReorganizeResults(summary, saveDir, from, to)
+
+	if _, failed := summary.Count(); failed > 0 {
+		return fmt.Errorf("%d exports couldn't be moved", failed)
+	}
+	return nil
+}
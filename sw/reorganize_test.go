@@ -0,0 +1,154 @@
+package sw
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/pkg/errs"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+const nestedLayout = "{year}/{sport}/{date}_{id}.{ext}"
+
+// newReorganizeTest saves activity 1 (a run), 2 (of unknown sport, with
+// an export the catalog doesn't list) and 3 (not in the catalog) in
+// DefaultLayout
+func newReorganizeTest(t *testing.T) (*ReorganizeService, string) {
+	t.Helper()
+	saveDir := t.TempDir()
+	for _, name := range []string{"1.fit", "1.gpx", "2.tcx", "3.fit", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(saveDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	catalog, err := OpenCatalog(NewOSFileSystem(), filepath.Join(saveDir, "catalog.jsonl"), saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activity := ActivityInfo{ID: "1", Type: "icons8-Running", Date: "2025-05-26"}
+	results := []DownloadResult{{ActivityID: "1", Success: true, Format: runalyze.FitFormat, FilePath: filepath.Join(saveDir, "1.fit")}}
+	if err := catalog.Record(activity, results, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Record(ActivityInfo{ID: "2", Date: "2024-12-31"}, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewReorganizeService(NewOSFileSystem(), &MockLogger{}, saveDir, catalog), saveDir
+}
+
+func TestReorganizeService_PlanAndApply(t *testing.T) {
+	service, saveDir := newReorganizeTest(t)
+	from, to := errs.Check2(ParseLayout(DefaultLayout)), errs.Check2(ParseLayout(nestedLayout))
+
+	summary, err := service.Plan(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"1.fit": "2025/running/2025-05-26_1.fit",
+		"1.gpx": "2025/running/2025-05-26_1.gpx",
+		"2.tcx": "2024/unknown/2024-12-31_2.tcx",
+	}
+	if len(summary.Moves) != len(want) {
+		t.Fatalf("moves = %+v, want %d", summary.Moves, len(want))
+	}
+	for _, m := range summary.Moves {
+		if got := layoutRel(saveDir, m.To); got != want[layoutRel(saveDir, m.From)] || m.Error != nil {
+			t.Errorf("move %s → %s (%v)", m.From, got, m.Error)
+		}
+	}
+	if len(summary.Skipped) != 1 || filepath.Base(summary.Skipped[0]) != "3.fit" {
+		t.Errorf("Skipped = %v, want 3.fit", summary.Skipped)
+	}
+
+	service.Apply(summary)
+	for from, to := range want {
+		if _, err := os.Stat(filepath.Join(saveDir, from)); err == nil {
+			t.Errorf("%s still there", from)
+		}
+		if _, err := os.Stat(filepath.Join(saveDir, filepath.FromSlash(to))); err != nil {
+			t.Errorf("%s not moved: %v", to, err)
+		}
+	}
+
+	catalog, err := OpenCatalog(NewOSFileSystem(), service.catalog.Path(), saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export, _ := catalog.Export("1", "gpx"); export.Path != filepath.Join(saveDir, "2025", "running", "2025-05-26_1.gpx") {
+		t.Errorf("catalog has gpx export at %q", export.Path)
+	}
+
+	// Moving back restores the flat layout
+	summary, err = service.Plan(to, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Apply(summary)
+	if _, err := os.Stat(filepath.Join(saveDir, "2.tcx")); err != nil {
+		t.Errorf("2.tcx not moved back: %v", err)
+	}
+}
+
+func TestReorganizeService_PlanRefusesToOverwrite(t *testing.T) {
+	service, saveDir := newReorganizeTest(t)
+	to := errs.Check2(ParseLayout("{date}.{id}.{ext}"))
+	if err := os.WriteFile(filepath.Join(saveDir, "2025-05-26.1.fit"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := service.Plan(errs.Check2(ParseLayout(DefaultLayout)), to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Apply(summary)
+	if _, failed := summary.Count(); failed != 1 {
+		t.Errorf("%d moves failed, want 1: %+v", failed, summary.Moves)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "1.fit")); err != nil {
+		t.Errorf("1.fit was moved over an existing file: %v", err)
+	}
+}
+
+func TestReorganizeService_PlanUncatalogued(t *testing.T) {
+	service, saveDir := newReorganizeTest(t)
+
+	// 3 isn't in the catalog and its path has no date or sport
+	summary, err := service.Plan(errs.Check2(ParseLayout(DefaultLayout)), errs.Check2(ParseLayout("{sport}/{id}.{ext}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := map[string]string{}
+	for _, m := range summary.Moves {
+		moved[layoutRel(saveDir, m.From)] = layoutRel(saveDir, m.To)
+	}
+	if moved["3.fit"] != "unknown/3.fit" || len(summary.Skipped) != 0 {
+		t.Errorf("moves = %v, skipped = %v; want 3.fit moved to unknown/3.fit", moved, summary.Skipped)
+	}
+	service.Apply(summary)
+
+	// Its date and sport are read back from a path that has them
+	name := filepath.Join("2023", "cycling", "2023-04-01_4.fit")
+	if err := os.MkdirAll(filepath.Join(saveDir, "2023", "cycling"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(saveDir, name), []byte("4.fit"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary, err = service.Plan(errs.Check2(ParseLayout(nestedLayout)), errs.Check2(ParseLayout("{year}/{month}/{date}_{sport}_{id}.{ext}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range summary.Moves {
+		if m.ActivityID == "4" && layoutRel(saveDir, m.To) != "2023/04/2023-04-01_cycling_4.fit" {
+			t.Errorf("4.fit moves to %s", layoutRel(saveDir, m.To))
+		}
+	}
+	if len(summary.Moves) != 1 {
+		t.Errorf("moves = %+v, want 4.fit", summary.Moves)
+	}
+}
@@ -0,0 +1,253 @@
+package sw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// DefaultSessionWarnDays is how many days before the remember-me cookie
+// expires 'syncwich auth status' starts failing
+const DefaultSessionWarnDays = 7
+
+// ErrNotLoggedIn is returned when the stored session is gone or expired
+var ErrNotLoggedIn = errors.New("not logged in to Runalyze, run 'syncwich auth login'")
+
+// AuthConfig holds the configuration of the auth commands
+type AuthConfig struct {
+	ClientConfig
+	// WarnBefore makes status fail when the remember-me cookie expires
+	// within this long, so cron users notice before a nightly run fails
+	WarnBefore time.Duration
+	JSONMode   bool
+}
+
+// Account is the Runalyze account the session belongs to
+type Account struct {
+	Username string `json:"username"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// CookieStatus is a stored session cookie, without its value
+type CookieStatus struct {
+	Name    string    `json:"name"`
+	Domain  string    `json:"domain"`
+	Expires time.Time `json:"expires"` // zero for cookies that end with the session
+}
+
+// SessionStatus is what the cookie store knows about the session, and
+// whether Runalyze still accepts it
+type SessionStatus struct {
+	Cookies           []CookieStatus `json:"cookies"`
+	RememberMeExpires time.Time      `json:"remember_me_expires"` // zero without a remember-me cookie
+	Valid             bool           `json:"valid"`
+}
+
+// ExpiresWithin reports whether the session can't be renewed for d more:
+// there is no remember-me cookie, or it expires within d of now
+func (s *SessionStatus) ExpiresWithin(d time.Duration, now time.Time) bool {
+	return s.RememberMeExpires.IsZero() || s.RememberMeExpires.Before(now.Add(d))
+}
+
+// Login replaces the stored session, even if it is still valid: it logs
+// in with the configured credentials, checks that Runalyze accepts the new
+// session and only then persists it. A failed login leaves the store as
+// it was.
+func (a *AuthService) Login(ctx context.Context) error {
+	a.logger.Info("attempting login")
+	// Start without the old session: Runalyze redirects a client that is
+	// still logged in away from the login form
+	if err := a.client.ResetCookies(); err != nil {
+		return fmt.Errorf("failed to reset cookies: %w", err)
+	}
+	if err := a.client.LoginContext(ctx); err != nil {
+		return err
+	}
+
+	if _, err := a.client.GetDataBrowserContext(ctx, time.Now()); err != nil {
+		if errors.Is(err, runalyze.ErrRedirectedToLogin) {
+			return fmt.Errorf("login rejected, check username and password: %w", err)
+		}
+		return err
+	}
+
+	if err := a.client.PersistCookies(); err != nil {
+		return fmt.Errorf("failed to persist cookies: %w", err)
+	}
+	a.logger.Info("successfully logged in to Runalyze")
+	return nil
+}
+
+// Logout ends the session in Runalyze and wipes the cookie store. The
+// store is wiped even if Runalyze can't be reached; the error is returned
+// afterwards.
+func (a *AuthService) Logout(ctx context.Context) error {
+	logoutErr := a.client.LogoutContext(ctx)
+	if logoutErr != nil {
+		a.logger.Warn("failed to log out of Runalyze, wiping the local session anyway", "error", logoutErr)
+	}
+	if err := a.client.ClearCookies(); err != nil {
+		return fmt.Errorf("failed to wipe cookie store: %w", err)
+	}
+	if logoutErr != nil {
+		return fmt.Errorf("failed to log out of Runalyze: %w", logoutErr)
+	}
+	a.logger.Info("logged out of Runalyze")
+	return nil
+}
+
+// Status lists the stored cookies and checks the session with Runalyze,
+// without logging in
+func (a *AuthService) Status(ctx context.Context) (*SessionStatus, error) {
+	status := &SessionStatus{Cookies: []CookieStatus{}}
+	for _, c := range a.client.Cookies() {
+		status.Cookies = append(status.Cookies, CookieStatus{Name: c.Name, Domain: c.Domain, Expires: c.Expires})
+		if c.Name == runalyze.RememberMeCookie {
+			status.RememberMeExpires = c.Expires
+		}
+	}
+	sort.Slice(status.Cookies, func(i, j int) bool {
+		return status.Cookies[i].Name < status.Cookies[j].Name
+	})
+
+	_, err := a.client.GetDataBrowserContext(ctx, time.Now())
+	switch {
+	case err == nil:
+		status.Valid = true
+		// Runalyze may have renewed the session from the remember-me cookie
+		if err := a.client.PersistCookies(); err != nil {
+			a.logger.Warn("failed to persist cookies", "error", err)
+		}
+	case !errors.Is(err, runalyze.ErrRedirectedToLogin):
+		return nil, err
+	}
+	return status, nil
+}
+
+// WhoAmI returns the account the stored session belongs to, without
+// logging in
+func (a *AuthService) WhoAmI(ctx context.Context) (*Account, error) {
+	page, err := a.client.GetAccountPageContext(ctx)
+	if errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		return nil, ErrNotLoggedIn
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account settings: %w", err)
+	}
+	return ParseAccount(page)
+}
+
+// ParseAccount reads the username, name and email from the account
+// settings page
+func ParseAccount(page []byte) (*Account, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	field := func(name string) string {
+		value, _ := doc.Find(fmt.Sprintf(`input[name="account[%s]"]`, name)).Attr("value")
+		return strings.TrimSpace(value)
+	}
+	account := &Account{Username: field("username"), Name: field("name"), Email: field("mail")}
+	if account.Username == "" {
+		return nil, fmt.Errorf("username not found on account settings page")
+	}
+	return account, nil
+}
+
+// AuthLogin logs in to Runalyze and persists the session
+func AuthLogin(ctx context.Context, config AuthConfig) error {
+	presentation, auth, err := setupAuth(config)
+	if err != nil {
+		return err
+	}
+	if err := validateCredentials(config.ClientConfig); err != nil {
+		return err
+	}
+
+	presentation.ShowProgress("Logging in to Runalyze...")
+	if err := auth.Login(ctx); err != nil {
+		presentation.ShowError(err, "Failed to log in to Runalyze")
+		return err
+	}
+	presentation.ShowStatus("Logged in to Runalyze as %s", config.Username)
+	return nil
+}
+
+// AuthLogout logs out of Runalyze and wipes the cookie store
+func AuthLogout(ctx context.Context, config AuthConfig) error {
+	presentation, auth, err := setupAuth(config)
+	if err != nil {
+		return err
+	}
+	if err := auth.Logout(ctx); err != nil {
+		presentation.ShowError(err, "Failed to log out")
+		return err
+	}
+	presentation.ShowStatus("Logged out, cookie store wiped")
+	return nil
+}
+
+// AuthStatus shows the stored cookies and whether the session is valid.
+// It fails if the session is invalid or can't be renewed for
+// config.WarnBefore more.
+func AuthStatus(ctx context.Context, config AuthConfig) error {
+	presentation, auth, err := setupAuth(config)
+	if err != nil {
+		return err
+	}
+	status, err := auth.Status(ctx)
+	if err != nil {
+		presentation.ShowError(err, "Failed to check the session")
+		return err
+	}
+	presentation.ShowSessionStatus(status, config.WarnBefore)
+
+	switch {
+	case !status.Valid:
+		return ErrNotLoggedIn
+	case config.WarnBefore > 0 && status.ExpiresWithin(config.WarnBefore, time.Now()):
+		return fmt.Errorf("session can't be renewed for %s more, run 'syncwich auth login'", config.WarnBefore)
+	}
+	return nil
+}
+
+// AuthWhoAmI shows the account the stored session belongs to
+func AuthWhoAmI(ctx context.Context, config AuthConfig) error {
+	presentation, auth, err := setupAuth(config)
+	if err != nil {
+		return err
+	}
+	account, err := auth.WhoAmI(ctx)
+	if err != nil {
+		presentation.ShowError(err, "Failed to look up the account")
+		return err
+	}
+	presentation.ShowAccount(account)
+	return nil
+}
+
+// setupAuth creates the presentation service and an AuthService whose
+// client hasn't logged in yet
+func setupAuth(config AuthConfig) (*PresentationService, *AuthService, error) {
+	ol, _, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger := ol.Component("auth")
+
+	client, err := newClient(config.ClientConfig, ol)
+	if err != nil {
+		presentation.ShowError(err, "Failed to create Runalyze client")
+		return nil, nil, err
+	}
+	return presentation, NewAuthService(client, logger), nil
+}
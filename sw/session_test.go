@@ -0,0 +1,115 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/roessland/syncwich/runalyze"
+)
+
+func TestAuthService_Login_ForcesFreshLogin(t *testing.T) {
+	mockClient := &MockRunalyzeClient{Session: []*http.Cookie{{Name: "REMEMBERME", Value: "old"}}}
+	auth := NewAuthService(mockClient, &MockLogger{})
+
+	if err := auth.Login(context.Background()); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !mockClient.LoginCalled || !mockClient.PersistCalled {
+		t.Errorf("LoginCalled = %v, PersistCalled = %v; want both", mockClient.LoginCalled, mockClient.PersistCalled)
+	}
+	if !mockClient.ResetCookie || mockClient.ClearedCookie {
+		t.Errorf("ResetCookie = %v, ClearedCookie = %v; want the old session dropped in memory only", mockClient.ResetCookie, mockClient.ClearedCookie)
+	}
+}
+
+func TestAuthService_Login_Rejected(t *testing.T) {
+	mockClient := &MockRunalyzeClient{BrowserError: runalyze.ErrRedirectedToLogin}
+	auth := NewAuthService(mockClient, &MockLogger{})
+
+	err := auth.Login(context.Background())
+	if !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("err = %v, want ErrRedirectedToLogin", err)
+	}
+	if mockClient.PersistCalled || mockClient.ClearedCookie {
+		t.Errorf("PersistCalled = %v, ClearedCookie = %v; want the stored session left alone", mockClient.PersistCalled, mockClient.ClearedCookie)
+	}
+}
+
+func TestAuthService_Logout_WipesStoreEvenIfServerFails(t *testing.T) {
+	mockClient := &MockRunalyzeClient{
+		Session:     []*http.Cookie{{Name: "PHPSESSID", Value: "abc"}},
+		LogoutError: createBadGatewayError(),
+	}
+	auth := NewAuthService(mockClient, &MockLogger{})
+
+	if err := auth.Logout(context.Background()); err == nil {
+		t.Error("expected the logout error")
+	}
+	if !mockClient.ClearedCookie {
+		t.Error("cookie store not wiped")
+	}
+}
+
+func TestAuthService_Status(t *testing.T) {
+	expires := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mockClient := &MockRunalyzeClient{Session: []*http.Cookie{
+		{Name: runalyze.RememberMeCookie, Domain: "runalyze.com", Expires: expires},
+		{Name: "PHPSESSID", Domain: "runalyze.com"},
+	}}
+	auth := NewAuthService(mockClient, &MockLogger{})
+
+	status, err := auth.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Valid || !status.RememberMeExpires.Equal(expires) || len(status.Cookies) != 2 || status.Cookies[0].Name != "PHPSESSID" {
+		t.Errorf("status = %+v", status)
+	}
+	if mockClient.LoginCalled {
+		t.Error("status logged in")
+	}
+
+	now := expires.AddDate(0, 0, -3)
+	if !status.ExpiresWithin(7*24*time.Hour, now) || status.ExpiresWithin(2*24*time.Hour, now) {
+		t.Error("ExpiresWithin is off")
+	}
+}
+
+func TestAuthService_Status_Expired(t *testing.T) {
+	mockClient := &MockRunalyzeClient{BrowserError: runalyze.ErrRedirectedToLogin}
+	auth := NewAuthService(mockClient, &MockLogger{})
+
+	status, err := auth.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Valid {
+		t.Error("expired session reported as valid")
+	}
+}
+
+func TestAuthService_WhoAmI(t *testing.T) {
+	mockClient := &MockRunalyzeClient{AccountPage: []byte(`<form>
+<input name="account[username]" value="runner" disabled>
+<input name="account[name]" value=" Test Runner ">
+<input name="account[mail]" value="runner@example.com">
+</form>`)}
+	auth := NewAuthService(mockClient, &MockLogger{})
+
+	account, err := auth.WhoAmI(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Account{Username: "runner", Name: "Test Runner", Email: "runner@example.com"}
+	if *account != want {
+		t.Errorf("account = %+v, want %+v", *account, want)
+	}
+
+	mockClient.AccountPage = nil
+	if _, err := auth.WhoAmI(context.Background()); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("logged out: err = %v, want ErrNotLoggedIn", err)
+	}
+}
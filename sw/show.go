@@ -0,0 +1,49 @@
+package sw
+
+import (
+	"context"
+	"fmt"
+)
+
+// ShowConfig holds the configuration of the show command
+type ShowConfig struct {
+	ClientConfig
+	ActivityID string
+	JSONMode   bool
+}
+
+// Show fetches the activity page of config.ActivityID and presents its
+// details as a table, or as JSON in JSON mode
+func Show(ctx context.Context, config ShowConfig) error {
+	ol, logger, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+
+	if err := validateCredentials(config.ClientConfig); err != nil {
+		return err
+	}
+
+	client, err := createAndAuthenticateClient(ctx, config.ClientConfig, ol, logger, presentation)
+	if err != nil {
+		return err
+	}
+
+	details, err := FetchActivityDetails(ctx, client, config.ActivityID)
+	if err != nil {
+		presentation.ShowError(err, "Failed to fetch activity %s", config.ActivityID)
+		return err
+	}
+
+	presentation.ShowActivityDetails(details)
+	return nil
+}
+
+// FetchActivityDetails downloads and parses the activity page of activityID
+func FetchActivityDetails(ctx context.Context, client RunalyzeClient, activityID string) (*ActivityDetails, error) {
+	page, err := client.GetActivityPageContext(ctx, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activity page for %s: %w", activityID, err)
+	}
+	return ParseActivityDetails(page, activityID)
+}
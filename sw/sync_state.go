@@ -0,0 +1,112 @@
+package sw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// SinceLast is the --since value that continues from the previous run
+const SinceLast = "last"
+
+// SyncStateFile is the name of the sync state in the save directory
+const SyncStateFile = "sync_state.json"
+
+// DefaultSinceLastOverlap is how far before the high-water mark a
+// --since last run starts, to pick up activities added late to weeks that
+// were already scanned
+const DefaultSinceLastOverlap = 7 * 24 * time.Hour
+
+// minUsualGap is the smallest gap between runs that is never unusual
+const minUsualGap = 14 * 24 * time.Hour
+
+// maxRecordedRuns is how many past runs the state keeps to learn the
+// usual interval between runs
+const maxRecordedRuns = 10
+
+// SyncState is the content of sync_state.json: how far complete runs got
+type SyncState struct {
+	// HighWaterMark is the start of the newest week scanned by a run that
+	// listed every week of its range and downloaded every activity
+	HighWaterMark time.Time   `json:"high_water_mark"`
+	Runs          []time.Time `json:"runs"` // when the last complete runs finished, oldest first
+
+	path string
+}
+
+// LoadSyncState reads the sync state from path through fs. A missing file
+// is an empty state.
+func LoadSyncState(fs FileSystem, path string) (*SyncState, error) {
+	state := &SyncState{path: path}
+
+	data, err := fs.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state back to the file it was loaded from, through fs
+func (s *SyncState) Save(fs FileSystem) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fs.WriteFile(s.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
+
+// Since returns where a --since last run up to until starts: overlap
+// before the high-water mark, but at least a week before until. ok is
+// false if no complete run was recorded yet.
+func (s *SyncState) Since(until time.Time, overlap time.Duration) (since time.Time, ok bool) {
+	if s.HighWaterMark.IsZero() {
+		return time.Time{}, false
+	}
+	// Calendar arithmetic for whole days keeps since at local midnight
+	// across DST, like parseSinceDate
+	since = s.HighWaterMark.AddDate(0, 0, -int(overlap/(24*time.Hour))).Add(-(overlap % (24 * time.Hour)))
+	if latest := until.AddDate(0, 0, -7); since.After(latest) {
+		since = latest
+	}
+	return since, true
+}
+
+// UsualGap is the gap between the high-water mark and a new run that is
+// expected: twice the median interval between recorded runs, and at
+// least two weeks
+func (s *SyncState) UsualGap() time.Duration {
+	var intervals []time.Duration
+	for i := 1; i < len(s.Runs); i++ {
+		intervals = append(intervals, s.Runs[i].Sub(s.Runs[i-1]))
+	}
+	if len(intervals) == 0 {
+		return minUsualGap
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	return max(2*intervals[len(intervals)/2], minUsualGap)
+}
+
+// Advance records a complete run that scanned since up to the week
+// starting until. The mark only moves forward, and only if the run
+// continued from it, so an old date range doesn't leave a hole.
+func (s *SyncState) Advance(since, until, now time.Time) {
+	if s.HighWaterMark.IsZero() || (!since.After(s.HighWaterMark) && until.After(s.HighWaterMark)) {
+		s.HighWaterMark = until
+	}
+	s.Runs = append(s.Runs, now)
+	if len(s.Runs) > maxRecordedRuns {
+		s.Runs = s.Runs[len(s.Runs)-maxRecordedRuns:]
+	}
+}
@@ -0,0 +1,116 @@
+package sw
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncState_Since(t *testing.T) {
+	mark := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	state := &SyncState{HighWaterMark: mark}
+
+	tests := []struct {
+		name    string
+		until   time.Time
+		overlap time.Duration
+		want    time.Time
+	}{
+		{"overlap before the mark", mark.AddDate(0, 0, 21), 7 * 24 * time.Hour, mark.AddDate(0, 0, -7)},
+		{"no overlap", mark.AddDate(0, 0, 21), 0, mark},
+		{"at least a week before until", mark, 0, mark.AddDate(0, 0, -7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := state.Since(tt.until, tt.overlap)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("Since() = %s, %v, want %s", got, ok, tt.want)
+			}
+		})
+	}
+
+	if _, ok := (&SyncState{}).Since(mark, 0); ok {
+		t.Error("Since() without a mark returned ok")
+	}
+}
+
+func TestSyncState_Advance(t *testing.T) {
+	mark := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC)
+
+	state := &SyncState{}
+	state.Advance(mark.AddDate(0, 0, -28), mark, now)
+	if !state.HighWaterMark.Equal(mark) {
+		t.Fatalf("first run: mark = %s, want %s", state.HighWaterMark, mark)
+	}
+
+	// A run over an old range doesn't move the mark back
+	state.Advance(mark.AddDate(0, 0, -70), mark.AddDate(0, 0, -56), now)
+	if !state.HighWaterMark.Equal(mark) {
+		t.Errorf("old range: mark = %s, want %s", state.HighWaterMark, mark)
+	}
+
+	// A run that starts after the mark would leave a hole
+	state.Advance(mark.AddDate(0, 0, 14), mark.AddDate(0, 0, 28), now)
+	if !state.HighWaterMark.Equal(mark) {
+		t.Errorf("run after a hole: mark = %s, want %s", state.HighWaterMark, mark)
+	}
+
+	state.Advance(mark.AddDate(0, 0, -7), mark.AddDate(0, 0, 14), now)
+	if want := mark.AddDate(0, 0, 14); !state.HighWaterMark.Equal(want) {
+		t.Errorf("continued run: mark = %s, want %s", state.HighWaterMark, want)
+	}
+
+	for range maxRecordedRuns {
+		state.Advance(mark, mark, now)
+	}
+	if len(state.Runs) != maxRecordedRuns {
+		t.Errorf("len(Runs) = %d, want %d", len(state.Runs), maxRecordedRuns)
+	}
+}
+
+func TestSyncState_UsualGap(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	monthly := &SyncState{}
+	for i := range 4 {
+		monthly.Runs = append(monthly.Runs, start.AddDate(0, 0, 30*i))
+	}
+	if got, want := monthly.UsualGap(), 60*24*time.Hour; got != want {
+		t.Errorf("monthly UsualGap() = %s, want %s", got, want)
+	}
+
+	daily := &SyncState{Runs: []time.Time{start, start.AddDate(0, 0, 1), start.AddDate(0, 0, 2)}}
+	if got := daily.UsualGap(); got != minUsualGap {
+		t.Errorf("daily UsualGap() = %s, want %s", got, minUsualGap)
+	}
+}
+
+func TestSyncState_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SyncStateFile)
+
+	state, err := LoadSyncState(NewOSFileSystem(), path)
+	if err != nil {
+		t.Fatalf("LoadSyncState(NewOSFileSystem(), ) on a missing file: %v", err)
+	}
+	mark := time.Date(2025, 6, 2, 0, 0, 0, 0, time.Local)
+	state.Advance(mark.AddDate(0, 0, -28), mark, mark.AddDate(0, 0, 2))
+	if err := state.Save(NewOSFileSystem()); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadSyncState(NewOSFileSystem(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.HighWaterMark.Equal(mark) || len(loaded.Runs) != 1 {
+		t.Errorf("loaded = %+v", loaded)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSyncState(NewOSFileSystem(), path); err == nil {
+		t.Error("LoadSyncState(NewOSFileSystem(), ) on a corrupt file succeeded")
+	}
+}
@@ -0,0 +1,177 @@
+package sw
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TrashDir is where --on-remote-delete=trash moves the files of activities
+// deleted upstream, relative to the save directory
+const TrashDir = "trash"
+
+// RemoteDeleteMode says what to do with local files of activities that were
+// deleted in Runalyze
+type RemoteDeleteMode string
+
+const (
+	// RemoteDeleteKeep leaves the files and marks the activity as
+	// tombstoned in the catalog
+	RemoteDeleteKeep RemoteDeleteMode = "keep"
+	// RemoteDeleteTrash moves the files to the trash directory and marks
+	// the activity as tombstoned
+	RemoteDeleteTrash RemoteDeleteMode = "trash"
+	// RemoteDeleteReport only lists the activities in the run summary
+	RemoteDeleteReport RemoteDeleteMode = "report"
+)
+
+// ParseRemoteDeleteMode parses the --on-remote-delete option. Empty means
+// RemoteDeleteKeep.
+func ParseRemoteDeleteMode(s string) (RemoteDeleteMode, error) {
+	switch mode := RemoteDeleteMode(s); mode {
+	case "":
+		return RemoteDeleteKeep, nil
+	case RemoteDeleteKeep, RemoteDeleteTrash, RemoteDeleteReport:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid --on-remote-delete %q (want keep, trash or report)", s)
+	}
+}
+
+// Tombstone is a local activity that is gone from Runalyze
+type Tombstone struct {
+	ActivityID string
+	Date       string
+	Files      []string // local files of the activity, before any move
+	Action     RemoteDeleteMode
+	Error      error // set if the files couldn't be moved to the trash
+}
+
+// TombstoneService compares the weeks the iterator scans with the catalog
+// and deals with local activities that were deleted upstream
+type TombstoneService struct {
+	fs      FileSystem
+	logger  Logger
+	saveDir string
+	mode    RemoteDeleteMode
+	catalog *Catalog
+	now     func() time.Time
+}
+
+// NewTombstoneService checks the files in saveDir against the catalog,
+// which must be opened for saveDir
+func NewTombstoneService(fs FileSystem, logger Logger, saveDir string, catalog *Catalog, mode RemoteDeleteMode) *TombstoneService {
+	return &TombstoneService{
+		fs:      fs,
+		logger:  logger,
+		saveDir: saveDir,
+		mode:    mode,
+		catalog: catalog,
+		now:     time.Now,
+	}
+}
+
+// CheckWeek compares the activities Runalyze lists for the databrowser week
+// starting at weekStart with the catalog. Catalogued activities of that
+// week that are missing upstream and still have files are tombstoned
+// according to the mode. Activities downloaded before the catalog existed
+// aren't known until a scan sees them upstream.
+func (t *TombstoneService) CheckWeek(weekStart time.Time, remote []ActivityInfo) []Tombstone {
+	// The same range the databrowser request covers: up to the end of Sunday
+	weekEnd := weekStart.AddDate(0, 0, 7-int(weekStart.Weekday()))
+	first, last := weekStart.Format("2006-01-02"), weekEnd.Format("2006-01-02")
+
+	upstream := make(map[string]bool, len(remote))
+	for _, a := range remote {
+		upstream[a.ID] = true
+	}
+
+	var entries []*CatalogEntry
+	for _, entry := range t.catalog.Entries() {
+		date := entry.Date()
+		if date >= first && date <= last && !upstream[entry.Activity.ID] && !entry.Trashed {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Activity.ID < entries[j].Activity.ID })
+
+	var tombstones []Tombstone
+	for _, entry := range entries {
+		id := entry.Activity.ID
+		files := t.files(entry)
+		if len(files) == 0 {
+			continue
+		}
+		tombstone := Tombstone{ActivityID: id, Date: entry.Date(), Files: files, Action: t.mode}
+		t.logger.Warn("activity deleted upstream", "activity_id", id, "date", entry.Date(), "files", len(files), "action", t.mode)
+
+		switch t.mode {
+		case RemoteDeleteKeep:
+			t.tombstone(id, false)
+		case RemoteDeleteTrash:
+			if err := t.trash(files); err != nil {
+				tombstone.Error = err
+				break
+			}
+			t.tombstone(id, true)
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones
+}
+
+// files returns the local files of an activity: the exports in the catalog
+// that are still there, and files named after the activity in the save
+// directory, where DefaultLayout and syncwich before layouts put them.
+// Catalog paths outside the save directory are never touched.
+func (t *TombstoneService) files(entry *CatalogEntry) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, export := range entry.Exports {
+		if !withinDir(t.saveDir, export.Path) {
+			t.logger.Warn("ignoring catalog path outside the save directory", "activity_id", entry.Activity.ID, "path", export.Path)
+			continue
+		}
+		if !seen[export.Path] && t.fs.Exists(export.Path) {
+			seen[export.Path] = true
+			files = append(files, export.Path)
+		}
+	}
+	flat, _ := filepath.Glob(filepath.Join(t.saveDir, entry.Activity.ID+".*"))
+	for _, file := range flat {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// tombstone marks an activity as deleted upstream in the catalog
+func (t *TombstoneService) tombstone(id string, trashed bool) {
+	if err := t.catalog.Tombstone(id, trashed, t.now()); err != nil {
+		t.logger.Warn("failed to record tombstone in catalog", "activity_id", id, "error", err)
+	}
+}
+
+// trash moves files into the trash directory, keeping their path relative
+// to the save directory. Files outside the save directory are refused.
+func (t *TombstoneService) trash(files []string) error {
+	trashDir := filepath.Join(t.saveDir, TrashDir)
+	for _, file := range files {
+		rel, err := filepath.Rel(t.saveDir, file)
+		if err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("refusing to trash %s: not in the save directory", file)
+		}
+		trashed := filepath.Join(trashDir, rel)
+		if err := t.fs.MkdirAll(filepath.Dir(trashed), 0755); err != nil {
+			return fmt.Errorf("failed to create trash directory: %w", err)
+		}
+		if err := t.fs.Rename(file, trashed); err != nil {
+			return fmt.Errorf("failed to move %s to the trash: %w", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package sw
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var tombstoneMonday = time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC)
+
+// newTombstoneTest catalogs activities 1 (Monday) and 2 (Wednesday) of
+// tombstoneMonday's week, and 3 of the week before
+func newTombstoneTest(t *testing.T, mode RemoteDeleteMode) (*TombstoneService, string) {
+	t.Helper()
+	saveDir := t.TempDir()
+	catalog, err := OpenCatalog(NewOSFileSystem(), filepath.Join(saveDir, "catalog.jsonl"), saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewTombstoneService(NewOSFileSystem(), &MockLogger{}, saveDir, catalog, mode)
+	for id, date := range map[string]string{"1": "2025-05-26", "2": "2025-05-28", "3": "2025-05-20"} {
+		path := filepath.Join(saveDir, id+".fit")
+		if err := os.WriteFile(path, []byte("fit"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		results := []DownloadResult{{ActivityID: id, Success: true, Format: "fit-original", FilePath: path}}
+		if err := catalog.Record(ActivityInfo{ID: id, Date: date}, results, tombstoneMonday); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc.now = func() time.Time { return tombstoneMonday.AddDate(0, 0, 7) }
+	return svc, saveDir
+}
+
+func TestParseRemoteDeleteMode(t *testing.T) {
+	for in, want := range map[string]RemoteDeleteMode{"": RemoteDeleteKeep, "keep": RemoteDeleteKeep, "trash": RemoteDeleteTrash, "report": RemoteDeleteReport} {
+		got, err := ParseRemoteDeleteMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRemoteDeleteMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseRemoteDeleteMode("delete"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestTombstoneService_CheckWeek_Keep(t *testing.T) {
+	svc, saveDir := newTombstoneTest(t, RemoteDeleteKeep)
+
+	tombstones := svc.CheckWeek(tombstoneMonday, []ActivityInfo{{ID: "1"}})
+	if len(tombstones) != 1 || tombstones[0].ActivityID != "2" || tombstones[0].Action != RemoteDeleteKeep {
+		t.Fatalf("tombstones = %+v, want only activity 2", tombstones)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "2.fit")); err != nil {
+		t.Errorf("kept file is gone: %v", err)
+	}
+
+	catalog, err := OpenCatalog(NewOSFileSystem(), svc.catalog.Path(), saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Get("2").Tombstoned == nil {
+		t.Error("activity 2 not tombstoned in the saved catalog")
+	}
+	if catalog.Get("1").Tombstoned != nil || catalog.Get("3").Tombstoned != nil {
+		t.Error("activities still upstream or outside the week were tombstoned")
+	}
+}
+
+func TestTombstoneService_CheckWeek_Trash(t *testing.T) {
+	svc, saveDir := newTombstoneTest(t, RemoteDeleteTrash)
+
+	tombstones := svc.CheckWeek(tombstoneMonday, nil)
+	if len(tombstones) != 2 {
+		t.Fatalf("got %d tombstones, want 2", len(tombstones))
+	}
+	for _, id := range []string{"1", "2"} {
+		if _, err := os.Stat(filepath.Join(saveDir, TrashDir, id+".fit")); err != nil {
+			t.Errorf("activity %s not in the trash: %v", id, err)
+		}
+		if !svc.catalog.Get(id).Trashed {
+			t.Errorf("activity %s not marked as trashed", id)
+		}
+	}
+
+	// Trashed activities aren't reported again
+	if again := svc.CheckWeek(tombstoneMonday, nil); len(again) != 0 {
+		t.Errorf("second check returned %+v", again)
+	}
+}
+
+func TestTombstoneService_CheckWeek_Report(t *testing.T) {
+	svc, saveDir := newTombstoneTest(t, RemoteDeleteReport)
+
+	tombstones := svc.CheckWeek(tombstoneMonday.AddDate(0, 0, -7), nil)
+	if len(tombstones) != 1 || tombstones[0].ActivityID != "3" {
+		t.Fatalf("tombstones = %+v, want only activity 3", tombstones)
+	}
+	if _, err := os.Stat(filepath.Join(saveDir, "3.fit")); err != nil {
+		t.Errorf("reported file was touched: %v", err)
+	}
+	if svc.catalog.Get("3").Tombstoned != nil {
+		t.Error("report mode tombstoned the activity")
+	}
+}
+
+func TestCatalog_RecordClearsTombstone(t *testing.T) {
+	svc, _ := newTombstoneTest(t, RemoteDeleteKeep)
+	svc.CheckWeek(tombstoneMonday, nil)
+
+	if err := svc.catalog.Record(ActivityInfo{ID: "1", Date: "2025-05-26"}, nil, tombstoneMonday); err != nil {
+		t.Fatal(err)
+	}
+	if svc.catalog.Get("1").Tombstoned != nil {
+		t.Error("activity that showed up again is still tombstoned")
+	}
+}
+
+func TestTombstoneService_CheckWeek_TrashIgnoresPathsOutsideSaveDir(t *testing.T) {
+	svc, saveDir := newTombstoneTest(t, RemoteDeleteTrash)
+	outside := filepath.Join(t.TempDir(), "2.fit")
+	if err := os.WriteFile(outside, []byte("not ours"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results := []DownloadResult{{ActivityID: "2", Success: true, Format: "fit-original", FilePath: outside}}
+	if err := svc.catalog.Record(ActivityInfo{ID: "2", Date: "2025-05-28"}, results, tombstoneMonday); err != nil {
+		t.Fatal(err)
+	}
+
+	tombstones := svc.CheckWeek(tombstoneMonday, []ActivityInfo{{ID: "1"}})
+
+	if len(tombstones) != 1 || tombstones[0].Error != nil {
+		t.Fatalf("tombstones = %+v, want activity 2 trashed", tombstones)
+	}
+	if want := filepath.Join(saveDir, "2.fit"); len(tombstones[0].Files) != 1 || tombstones[0].Files[0] != want {
+		t.Errorf("files = %v, want only %s", tombstones[0].Files, want)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the save directory was moved: %v", err)
+	}
+}
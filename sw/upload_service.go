@@ -0,0 +1,267 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+// UploadConfig holds the configuration of the upload command
+type UploadConfig struct {
+	ClientConfig
+	Paths    []string // files, or directories whose activity files are uploaded
+	Layout   string   // layout of downloaded files, see ParseLayout
+	JSONMode bool
+}
+
+// UploadOutcome is what happened to a file passed to the upload command
+type UploadOutcome string
+
+const (
+	UploadImported  UploadOutcome = "imported"  // Runalyze created a new activity
+	UploadDuplicate UploadOutcome = "duplicate" // Runalyze already had the activity
+	UploadRejected  UploadOutcome = "rejected"  // Runalyze couldn't import the file
+	UploadSkipped   UploadOutcome = "skipped"   // the activity exists in the account, nothing was sent
+	UploadFailed    UploadOutcome = "error"     // the file couldn't be read or sent
+)
+
+// FileUploadResult is the outcome of uploading a single file
+type FileUploadResult struct {
+	Path       string
+	Outcome    UploadOutcome
+	ActivityID string // the new or existing activity, if known
+	Message    string // Runalyze's explanation for duplicates and rejections
+	Error      error
+}
+
+// UploadSummary is the outcome of an upload run
+type UploadSummary struct {
+	Results     []FileUploadResult
+	Interrupted bool
+}
+
+// Count returns the number of results with outcome
+func (s *UploadSummary) Count(outcome UploadOutcome) int {
+	n := 0
+	for _, r := range s.Results {
+		if r.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// uploadExtensions are the activity file types picked from directories
+var uploadExtensions = map[string]bool{".fit": true, ".tcx": true, ".gpx": true}
+
+// activityFileRe matches files syncwich downloaded, named after their
+// activity ID
+var activityFileRe = regexp.MustCompile(`^(\d+)\.[A-Za-z-]+$`)
+
+// UploadService uploads activity files to Runalyze
+type UploadService struct {
+	client RunalyzeClient
+	logger Logger
+	layout *Layout
+}
+
+// NewUploadService creates a new upload service
+func NewUploadService(client RunalyzeClient, logger Logger) *UploadService {
+	return &UploadService{
+		client: client,
+		logger: logger,
+	}
+}
+
+// SetLayout makes files saved by the layout count as named after an
+// activity ID too (optional)
+func (u *UploadService) SetLayout(layout Layout) {
+	u.layout = &layout
+}
+
+// ExpandUploadPaths returns the files to upload: files are taken as given,
+// directories contribute their .fit, .tcx and .gpx files (recursively, in
+// lexical order). The trash and versions directories of a save directory
+// and hidden directories are left out, so deleted activities and earlier
+// versions aren't uploaded again.
+func ExpandUploadPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		path, err := homedir.Expand(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				rel := layoutRel(path, p)
+				if rel == TrashDir || rel == VersionsDir || (rel != "." && strings.HasPrefix(d.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if uploadExtensions[strings.ToLower(filepath.Ext(p))] {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// activityID returns the activity a file syncwich downloaded belongs to
+func (u *UploadService) activityID(path string) (string, bool) {
+	if u.layout != nil {
+		if activityID, _, ok := u.layout.MatchTail(path); ok {
+			return activityID, true
+		}
+	}
+	if match := activityFileRe.FindStringSubmatch(filepath.Base(path)); match != nil {
+		return match[1], true
+	}
+	return "", false
+}
+
+// UploadFile uploads a single file. Files named after an activity ID (as
+// syncwich saves them) are skipped when that activity still exists in the
+// account; everything else is left to Runalyze's duplicate detection.
+func (u *UploadService) UploadFile(ctx context.Context, path string) FileUploadResult {
+	result := FileUploadResult{Path: path}
+
+	if activityID, ok := u.activityID(path); ok {
+		_, err := u.client.GetActivityPageContext(ctx, activityID)
+		switch {
+		case err == nil:
+			result.Outcome = UploadSkipped
+			result.ActivityID = activityID
+			u.logger.Debug("activity already in account, skipping upload", "path", path, "activity_id", activityID)
+			return result
+		case !runalyze.IsNotFound(err):
+			result.Outcome = UploadFailed
+			result.Error = fmt.Errorf("failed to check activity %s: %w", activityID, err)
+			return result
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		result.Outcome = UploadFailed
+		result.Error = err
+		return result
+	}
+	defer f.Close()
+
+	uploaded, err := u.client.UploadActivityContext(ctx, filepath.Base(path), f)
+	if err != nil {
+		result.Outcome = UploadFailed
+		result.Error = err
+		return result
+	}
+	result.ActivityID = uploaded.ActivityID
+	result.Message = uploaded.Message
+	switch uploaded.Status {
+	case runalyze.UploadImported:
+		result.Outcome = UploadImported
+	case runalyze.UploadDuplicate:
+		result.Outcome = UploadDuplicate
+	default:
+		result.Outcome = UploadRejected
+	}
+	u.logger.Debug("uploaded activity file", "path", path, "outcome", result.Outcome, "activity_id", result.ActivityID)
+	return result
+}
+
+// UploadFiles uploads files one by one, calling onResult after each. Being
+// logged out stops the run; other failures are recorded and the next file
+// is tried.
+func (u *UploadService) UploadFiles(ctx context.Context, files []string, onResult func(FileUploadResult)) (*UploadSummary, error) {
+	summary := &UploadSummary{}
+	for _, path := range files {
+		result := u.UploadFile(ctx, path)
+		if ctx.Err() != nil {
+			summary.Interrupted = true
+			return summary, nil
+		}
+		if errors.Is(result.Error, runalyze.ErrRedirectedToLogin) {
+			return summary, result.Error
+		}
+		summary.Results = append(summary.Results, result)
+		if onResult != nil {
+			onResult(result)
+		}
+	}
+	return summary, nil
+}
+
+// Upload uploads the files and directories in config.Paths and reports the
+// outcome of each file
+func Upload(ctx context.Context, config UploadConfig) error {
+	ol, logger, presentation, err := setupDependencies(config.JSONMode)
+	if err != nil {
+		return err
+	}
+	logger = ol.Component("upload")
+
+	files, err := ExpandUploadPaths(config.Paths)
+	if err != nil {
+		presentation.ShowError(err, "Failed to find files to upload")
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .fit, .tcx or .gpx files found in %s", strings.Join(config.Paths, ", "))
+	}
+	layout, err := ParseLayout(config.Layout)
+	if err != nil {
+		return err
+	}
+
+	if err := validateCredentials(config.ClientConfig); err != nil {
+		return err
+	}
+
+	client, err := createAndAuthenticateClient(ctx, config.ClientConfig, ol, logger, presentation)
+	if err != nil {
+		return err
+	}
+
+	presentation.ShowStatus("Uploading %d files", len(files))
+	service := NewUploadService(client, logger)
+	service.SetLayout(layout)
+	summary, err := service.UploadFiles(ctx, files, presentation.ShowUploadResult)
+	if err != nil {
+		presentation.ShowError(err, "Upload stopped")
+		return err
+	}
+	presentation.ShowUploadResults(summary)
+	if summary.Interrupted {
+		return fmt.Errorf("upload interrupted: %w", ctx.Err())
+	}
+	if n := summary.Count(UploadFailed); n > 0 {
+		return fmt.Errorf("%d files failed to upload", n)
+	}
+	return nil
+}
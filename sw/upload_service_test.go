@@ -0,0 +1,158 @@
+package sw
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/roessland/syncwich/pkg/errs"
+	"github.com/roessland/syncwich/runalyze"
+)
+
+func writeUploadFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandUploadPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeUploadFiles(t, dir, "b.fit", "a.TCX", "notes.txt", "2024/c.gpx",
+		TrashDir+"/2024/d.fit", VersionsDir+"/1/20250601T070000Z-1.fit", ".cache/e.fit")
+	single := filepath.Join(dir, "notes.txt")
+
+	files, err := ExpandUploadPaths([]string{single, dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{single, filepath.Join(dir, "2024/c.gpx"), filepath.Join(dir, "a.TCX"), filepath.Join(dir, "b.fit")}
+	if len(files) != len(want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("files[%d] = %s, want %s", i, files[i], want[i])
+		}
+	}
+
+	if _, err := ExpandUploadPaths([]string{filepath.Join(dir, "missing.fit")}); err == nil {
+		t.Error("missing path: want an error")
+	}
+}
+
+func TestUploadService_UploadFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeUploadFiles(t, dir, "135061341.fit", "135999999.fit", "dup.tcx", "bad.gpx", "new.fit")
+	client := &MockRunalyzeClient{
+		// 135061341 is still in the account, 135999999 was deleted
+		ActivityPages: map[string][]byte{"135061341": []byte("<html></html>")},
+		UploadResults: map[string]*runalyze.UploadResult{
+			"135999999.fit": {Status: runalyze.UploadImported, ActivityID: "200"},
+			"dup.tcx":       {Status: runalyze.UploadDuplicate, Message: "duplicate of 135061340"},
+			"bad.gpx":       {Status: runalyze.UploadRejected, Message: "unknown format"},
+		},
+	}
+	files, err := ExpandUploadPaths([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported int
+	summary, err := NewUploadService(client, &MockLogger{}).UploadFiles(context.Background(), files, func(FileUploadResult) { reported++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outcomes := map[string]UploadOutcome{}
+	for _, r := range summary.Results {
+		outcomes[filepath.Base(r.Path)] = r.Outcome
+	}
+	want := map[string]UploadOutcome{
+		"135061341.fit": UploadSkipped,
+		"135999999.fit": UploadImported,
+		"dup.tcx":       UploadDuplicate,
+		"bad.gpx":       UploadRejected,
+		"new.fit":       UploadImported,
+	}
+	for name, outcome := range want {
+		if outcomes[name] != outcome {
+			t.Errorf("%s: outcome %q, want %q", name, outcomes[name], outcome)
+		}
+	}
+	if reported != len(want) {
+		t.Errorf("onResult called %d times, want %d", reported, len(want))
+	}
+	for _, name := range client.UploadCalls {
+		if name == "135061341.fit" {
+			t.Error("file of an existing activity was uploaded")
+		}
+	}
+	if summary.Count(UploadImported) != 2 {
+		t.Errorf("Count(imported) = %d, want 2", summary.Count(UploadImported))
+	}
+}
+
+func TestUploadService_SkipsFilesOfLayout(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join("2025", "05", "2025-05-28_running_135061341.fit")
+	writeUploadFiles(t, dir, name)
+	client := &MockRunalyzeClient{ActivityPages: map[string][]byte{"135061341": []byte("<html></html>")}}
+
+	service := NewUploadService(client, &MockLogger{})
+	service.SetLayout(errs.Check2(ParseLayout("{year}/{month}/{date}_{sport}_{id}.{ext}")))
+	result := service.UploadFile(context.Background(), filepath.Join(dir, name))
+
+	if result.Outcome != UploadSkipped || result.ActivityID != "135061341" {
+		t.Errorf("result = %+v, want skipped as activity 135061341", result)
+	}
+}
+
+func TestUploadService_StopsWhenLoggedOut(t *testing.T) {
+	dir := t.TempDir()
+	writeUploadFiles(t, dir, "a.fit", "b.fit")
+	client := &MockRunalyzeClient{UploadError: runalyze.ErrRedirectedToLogin}
+
+	summary, err := NewUploadService(client, &MockLogger{}).UploadFiles(context.Background(), []string{filepath.Join(dir, "a.fit"), filepath.Join(dir, "b.fit")}, nil)
+
+	if !errors.Is(err, runalyze.ErrRedirectedToLogin) {
+		t.Fatalf("err = %v, want ErrRedirectedToLogin", err)
+	}
+	if len(client.UploadCalls) != 1 || len(summary.Results) != 0 {
+		t.Errorf("UploadCalls = %v, Results = %+v; want one attempt and no results", client.UploadCalls, summary.Results)
+	}
+}
+
+func TestUploadService_CheckFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeUploadFiles(t, dir, "123.fit")
+	client := &MockRunalyzeClient{}
+
+	// A failing existence check is an error for that file, not an upload
+	result := NewUploadService(&failingPageClient{client}, &MockLogger{}).UploadFile(context.Background(), filepath.Join(dir, "123.fit"))
+
+	if result.Outcome != UploadFailed || result.Error == nil {
+		t.Errorf("result = %+v, want an error", result)
+	}
+	if len(client.UploadCalls) != 0 {
+		t.Errorf("UploadCalls = %v, want none", client.UploadCalls)
+	}
+}
+
+// failingPageClient fails every activity page request with a 502
+type failingPageClient struct {
+	*MockRunalyzeClient
+}
+
+func (c *failingPageClient) GetActivityPageContext(ctx context.Context, activityID string) ([]byte, error) {
+	return nil, createBadGatewayError()
+}
@@ -0,0 +1,77 @@
+package sw
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionsDir is where earlier versions of exports that were downloaded
+// again are kept, relative to the save directory
+const VersionsDir = "versions"
+
+// ActivityFingerprint lists the databrowser metrics that change when an
+// activity is corrected in Runalyze: a cropped track changes distance,
+// duration and elevation, a sport change the type, merged data the heart
+// rate. Derived values like VO2max and TRIMP are left out, since Runalyze
+// recalculates them when settings change.
+//
+// The fields are separated by "|", and a metric that reads as zero is
+// left empty: a hidden databrowser column, or one a localized header
+// didn't name, isn't a change. See fingerprintsDiffer.
+func ActivityFingerprint(activity ActivityInfo) string {
+	number := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	distance := ""
+	if activity.DistanceKm != 0 {
+		distance = fmt.Sprintf("%.3f", activity.DistanceKm)
+	}
+	return strings.Join([]string{
+		activity.Type,
+		activity.Date,
+		distance,
+		number(int(activity.Duration / time.Second)),
+		number(activity.AscentM),
+		number(activity.DescentM),
+		number(activity.AvgHeartRate),
+		number(activity.EnergyKcal),
+	}, "|")
+}
+
+// fingerprintsDiffer compares two ActivityFingerprints field by field,
+// skipping fields that are empty in either. A correction that clears a
+// metric therefore goes unnoticed. Fingerprints of a different shape,
+// e.g. from an older syncwich, don't differ.
+func fingerprintsDiffer(a, b string) bool {
+	fieldsA, fieldsB := strings.Split(a, "|"), strings.Split(b, "|")
+	if len(fieldsA) != len(fieldsB) {
+		return false
+	}
+	for i := range fieldsA {
+		if fieldsA[i] != "" && fieldsB[i] != "" && fieldsA[i] != fieldsB[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// changedUpstream reports whether activity differs from when its exports
+// were last downloaded. Activities without a fingerprint, like those
+// downloaded before the catalog existed, are taken as unchanged.
+func (c *Catalog) changedUpstream(activity ActivityInfo) bool {
+	entry := c.entries[activity.ID]
+	return entry != nil && entry.Fingerprint != "" && fingerprintsDiffer(entry.Fingerprint, ActivityFingerprint(activity))
+}
+
+// versionPath returns where the version of an export at path that is
+// replaced at time at is kept, e.g. versions/123/20250526T070000Z-123.fit
+func versionPath(saveDir, activityID, path string, at time.Time) string {
+	name := at.UTC().Format("20060102T150405Z") + "-" + filepath.Base(path)
+	return filepath.Join(saveDir, VersionsDir, activityID, name)
+}
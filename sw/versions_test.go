@@ -0,0 +1,166 @@
+package sw
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newVersioningService downloads activity once into a mock file system
+// with a catalog, so the next download can see changes
+func newVersioningService(t *testing.T, client *MockRunalyzeClient, activity ActivityInfo) (*DownloadService, *MockFileSystem) {
+	t.Helper()
+	fs := NewMockFileSystem()
+	service := NewDownloadService(client, fs, &MockLogger{})
+	service.SetCatalog(NewMemoryCatalog("/tmp/activities"))
+	service.now = func() time.Time { return time.Date(2025, 6, 1, 7, 0, 0, 0, time.UTC) }
+
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+	if !result.Success || result.SHA256 == "" || result.Size != int64(len(client.FitData)) {
+		t.Fatalf("first download: %+v", result)
+	}
+	return service, fs
+}
+
+func TestActivityFingerprint(t *testing.T) {
+	a := ActivityInfo{ID: "1", Type: "running", Date: "2025-05-26", DistanceKm: 10, Duration: 50 * time.Minute, VO2max: 50}
+	b := a
+	b.VO2max = 51
+	b.TRIMP = 120
+	if ActivityFingerprint(a) != ActivityFingerprint(b) {
+		t.Error("derived metrics changed the fingerprint")
+	}
+	b.DistanceKm = 9.2
+	if ActivityFingerprint(a) == ActivityFingerprint(b) {
+		t.Error("cropped distance didn't change the fingerprint")
+	}
+}
+
+func TestFingerprintsDiffer(t *testing.T) {
+	a := ActivityInfo{ID: "1", Type: "running", Date: "2025-05-26", DistanceKm: 10, Duration: 50 * time.Minute, AvgHeartRate: 150}
+
+	// A hidden column, or one a localized header didn't name, reads as zero
+	hidden := a
+	hidden.AvgHeartRate = 0
+	if fingerprintsDiffer(ActivityFingerprint(a), ActivityFingerprint(hidden)) || fingerprintsDiffer(ActivityFingerprint(hidden), ActivityFingerprint(a)) {
+		t.Error("hidden heart rate column counted as a change")
+	}
+
+	cropped := hidden
+	cropped.Duration = 45 * time.Minute
+	if !fingerprintsDiffer(ActivityFingerprint(a), ActivityFingerprint(cropped)) {
+		t.Error("cropped duration not counted as a change")
+	}
+
+	// Fingerprints of an older syncwich aren't compared
+	if fingerprintsDiffer("0123456789abcdef", ActivityFingerprint(a)) {
+		t.Error("older fingerprint counted as a change")
+	}
+}
+
+func TestDownloadActivity_UnavailableFormatStoresFingerprint(t *testing.T) {
+	// GPX is missing from both Exports and ExportErrors, so it's a 404
+	client := &MockRunalyzeClient{FitData: []byte("v1")}
+	service := NewDownloadService(client, NewMockFileSystem(), &MockLogger{})
+	formats, err := ParseFormats("fit-original,gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.SetFormats(formats)
+	service.SetCatalog(NewMemoryCatalog("/tmp/activities"))
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26", DistanceKm: 10}
+
+	results := service.DownloadActivity(context.Background(), activity, "/tmp/activities")
+	if len(results) != 2 || !results[0].Success || results[1].FileType != "NONE" {
+		t.Fatalf("results = %+v", results)
+	}
+	if got := service.catalog.Get("12345").Fingerprint; got != ActivityFingerprint(activity) {
+		t.Errorf("Fingerprint = %q, want it stored although GPX isn't available", got)
+	}
+}
+
+func TestDownloadActivity_Unchanged_NotDownloadedAgain(t *testing.T) {
+	client := &MockRunalyzeClient{FitData: []byte("v1")}
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26", DistanceKm: 10}
+	service, _ := newVersioningService(t, client, activity)
+
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+	if !result.Existed || len(client.ExportCalls) != 1 {
+		t.Errorf("unchanged activity fetched again: %+v, calls %v", result, client.ExportCalls)
+	}
+}
+
+func TestDownloadActivity_ChangedUpstream_KeepsVersion(t *testing.T) {
+	client := &MockRunalyzeClient{FitData: []byte("v1")}
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26", DistanceKm: 10}
+	service, fs := newVersioningService(t, client, activity)
+
+	// The track was cropped
+	client.FitData = []byte("v2, cropped")
+	activity.DistanceKm = 9.2
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+
+	if !result.Success || !result.Updated {
+		t.Fatalf("expected updated result, got %+v", result)
+	}
+	want := filepath.Join("/tmp/activities", VersionsDir, "12345", "20250601T070000Z-12345.fit")
+	if result.PreviousPath != want {
+		t.Errorf("PreviousPath = %q, want %q", result.PreviousPath, want)
+	}
+	if string(fs.Files[want]) != "v1" {
+		t.Errorf("earlier version = %q, want v1", fs.Files[want])
+	}
+	if string(fs.Files[result.FilePath]) != "v2, cropped" {
+		t.Errorf("current file = %q", fs.Files[result.FilePath])
+	}
+
+	entry := service.catalog.Get("12345")
+	if entry.Fingerprint != ActivityFingerprint(activity) || entry.Exports["fit-original"].Size != int64(len("v2, cropped")) {
+		t.Errorf("catalog not updated: %+v", entry)
+	}
+}
+
+func TestDownloadActivity_ChangedUpstream_IdenticalExport(t *testing.T) {
+	client := &MockRunalyzeClient{FitData: []byte("v1")}
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26", DistanceKm: 10}
+	service, fs := newVersioningService(t, client, activity)
+
+	// Only the databrowser changed, the export is the same
+	activity.Type = "hiking"
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+
+	if !result.Success || result.Updated || !result.Existed {
+		t.Fatalf("expected unchanged result, got %+v", result)
+	}
+	for path := range fs.Files {
+		if strings.Contains(path, VersionsDir) {
+			t.Errorf("identical export kept as version %s", path)
+		}
+	}
+	if string(fs.Files[result.FilePath]) != "v1" {
+		t.Errorf("current file = %q", fs.Files[result.FilePath])
+	}
+}
+
+func TestDownloadActivity_ChangedUpstream_FailedDownloadRestores(t *testing.T) {
+	client := &MockRunalyzeClient{FitData: []byte("v1")}
+	activity := ActivityInfo{ID: "12345", Type: "running", Date: "2025-05-26", DistanceKm: 10}
+	service, fs := newVersioningService(t, client, activity)
+	fingerprint := service.catalog.Get("12345").Fingerprint
+
+	client.FitError = createBadGatewayError()
+	activity.DistanceKm = 9.2
+	result := singleResult(t, service.DownloadActivity(context.Background(), activity, "/tmp/activities"))
+
+	if result.Success {
+		t.Fatal("expected failure")
+	}
+	if string(fs.Files[filepath.Join("/tmp/activities", "12345.fit")]) != "v1" {
+		t.Error("earlier file not restored after failed download")
+	}
+	if service.catalog.Get("12345").Fingerprint != fingerprint {
+		t.Error("fingerprint updated although the download failed")
+	}
+}